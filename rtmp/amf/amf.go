@@ -0,0 +1,146 @@
+// Package amf encodes and decodes Action Message Format, AMF0 and AMF3.
+//
+// Values decode to these Go types:
+//
+//	null                         nil
+//	undefined, unsupported       Undefined
+//	number, AMF3 double          float64
+//	AMF3 integer                 int
+//	boolean                      bool
+//	string, long string          string
+//	anonymous object             map[string]interface{}
+//	typed object                 *TypedObject
+//	ECMA array, AMF3 assoc array ECMAArray
+//	strict array, AMF3 array     []interface{}
+//	date                         time.Time
+//	XML document                 XMLDocument
+//	AMF3 XML                     XML
+//	AMF3 ByteArray               []byte
+//	AMF3 vectors                 VectorInt, VectorUint, VectorDouble, *VectorObject
+//	AMF3 Dictionary              Dictionary
+//	AMF3 externalizable object   the registered Externalizable
+//
+// Marshal and Unmarshal map Go structs to objects by their exported fields,
+// named by the `amf:"name"` tag or else the field name. A tag of "-" skips
+// the field and the omitempty option leaves out a zero value. Structs that
+// implement ClassNamer are written as typed objects.
+//
+// AMF0 has no ByteArray, vector, Dictionary or externalizable object; the
+// encoder writes them as AMF3 values behind the avmplus-object marker.
+package amf
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+type Version uint8
+
+const (
+	AMF0 Version = 0
+	AMF3 Version = 3
+)
+
+// maxDepth limits the nesting of values, so a hostile payload cannot
+// exhaust the stack.
+const maxDepth = 512
+
+// Undefined is the undefined value, which AMF keeps apart from null.
+type Undefined struct{}
+
+// ECMAArray is an associative array. AMF3 arrays with both dense and
+// associative parts decode to an ECMAArray keyed by "0", "1", ... for the
+// dense part.
+type ECMAArray map[string]interface{}
+
+// TypedObject is an object of a named class.
+type TypedObject struct {
+	ClassName  string
+	Properties map[string]interface{}
+}
+
+type XMLDocument string
+
+type XML string
+
+type VectorInt []int32
+
+type VectorUint []uint32
+
+type VectorDouble []float64
+
+type VectorObject struct {
+	TypeName string
+	Fixed    bool
+	Items    []interface{}
+}
+
+// Dictionary keeps its entries in order, as AMF3 keys may be of any type.
+type Dictionary []DictionaryEntry
+
+type DictionaryEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// ClassNamer names the class of a struct written as a typed object.
+type ClassNamer interface {
+	AMFClassName() string
+}
+
+// Externalizable is an AMF3 object that writes its own body. Classes must
+// be registered with RegisterExternalizable to be decoded.
+type Externalizable interface {
+	ClassNamer
+	ReadExternal(d *Decoder) error
+	WriteExternal(e *Encoder) error
+}
+
+var (
+	externalizablesMu sync.RWMutex
+	externalizables   = map[string]func() Externalizable{}
+)
+
+// RegisterExternalizable makes the decoder create objects of className
+// with newFunc.
+func RegisterExternalizable(className string, newFunc func() Externalizable) {
+	externalizablesMu.Lock()
+	defer externalizablesMu.Unlock()
+	externalizables[className] = newFunc
+}
+
+func newExternalizable(className string) (Externalizable, bool) {
+	externalizablesMu.RLock()
+	defer externalizablesMu.RUnlock()
+	f, ok := externalizables[className]
+	if !ok {
+		return nil, false
+	}
+	return f(), true
+}
+
+// Marshal returns the AMF0 encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	b := &bytes.Buffer{}
+	if err := NewEncoder(b, AMF0).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal decodes the first AMF0 value of data into v.
+func Unmarshal(data []byte, v interface{}) error {
+	return NewDecoder(bytes.NewReader(data), AMF0).Decode(v)
+}
+
+// UnmarshalTypeError is returned for a value that does not fit its Go type.
+type UnmarshalTypeError struct {
+	Value interface{}
+	Type  reflect.Type
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("amf: cannot unmarshal %T into Go value of type %s", e.Value, e.Type)
+}
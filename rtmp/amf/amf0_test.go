@@ -0,0 +1,144 @@
+package amf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAMF0Encode(t *testing.T) {
+	testCases := []struct {
+		name string
+		v    interface{}
+		want []byte
+	}{
+		{"number", 1, []byte{0x00, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0}},
+		{"boolean", true, []byte{0x01, 0x01}},
+		{"string", "connect", append([]byte{0x02, 0x00, 0x07}, "connect"...)},
+		{"null", nil, []byte{0x05}},
+		{"undefined", Undefined{}, []byte{0x06}},
+		{
+			"object",
+			map[string]interface{}{"app": "live"},
+			[]byte{0x03, 0x00, 0x03, 'a', 'p', 'p', 0x02, 0x00, 0x04, 'l', 'i', 'v', 'e', 0x00, 0x00, 0x09},
+		},
+		{
+			"ECMA array",
+			ECMAArray{"a": nil},
+			[]byte{0x08, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 'a', 0x05, 0x00, 0x00, 0x09},
+		},
+		{
+			"strict array",
+			[]interface{}{false, nil},
+			[]byte{0x0a, 0x00, 0x00, 0x00, 0x02, 0x01, 0x00, 0x05},
+		},
+		{
+			"date",
+			time.Unix(1, 0),
+			[]byte{0x0b, 0x40, 0x8f, 0x40, 0, 0, 0, 0, 0, 0x00, 0x00},
+		},
+		{
+			"typed object",
+			&TypedObject{ClassName: "C", Properties: map[string]interface{}{}},
+			[]byte{0x10, 0x00, 0x01, 'C', 0x00, 0x00, 0x09},
+		},
+		{"XML document", XMLDocument("<a/>"), append([]byte{0x0f, 0x00, 0x00, 0x00, 0x04}, "<a/>"...)},
+		{"byte array switches to AMF3", []byte{0xff}, []byte{0x11, 0x0c, 0x03, 0xff}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Marshal(tc.v)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestAMF0LongString(t *testing.T) {
+	s := string(bytes.Repeat([]byte{'a'}, 0x10000))
+	b, err := Marshal(s)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0c, 0x00, 0x01, 0x00, 0x00}, b[:5])
+
+	var got string
+	assert.NoError(t, Unmarshal(b, &got))
+	assert.Equal(t, s, got)
+}
+
+func TestAMF0References(t *testing.T) {
+	shared := map[string]interface{}{"x": 1.0}
+	b, err := Marshal([]interface{}{shared, shared})
+	assert.NoError(t, err)
+	// the array is reference 0 and the object reference 1
+	assert.Equal(t, []byte{0x07, 0x00, 0x01}, b[len(b)-3:])
+
+	v, err := NewDecoder(bytes.NewReader(b), AMF0).DecodeValue()
+	assert.NoError(t, err)
+	a := v.([]interface{})
+	assert.Equal(t, shared, a[0])
+	assert.Equal(t, shared, a[1])
+
+	_, err = NewDecoder(bytes.NewReader([]byte{0x07, 0x00, 0x00}), AMF0).DecodeValue()
+	assert.Error(t, err)
+}
+
+func TestAMF0Decode(t *testing.T) {
+	b := &bytes.Buffer{}
+	e := NewEncoder(b, AMF0)
+	date := time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	values := []interface{}{
+		"_result",
+		1.0,
+		nil,
+		Undefined{},
+		map[string]interface{}{
+			"code":  "NetConnection.Connect.Success",
+			"date":  date,
+			"array": []interface{}{"a", true},
+			"ecma":  ECMAArray{"k": "v"},
+			"typed": &TypedObject{ClassName: "C", Properties: map[string]interface{}{"p": 2.0}},
+			"xml":   XMLDocument("<a/>"),
+			"bytes": []byte{1, 2},
+		},
+	}
+	for _, v := range values {
+		assert.NoError(t, e.Encode(v))
+	}
+	d := NewDecoder(b, AMF0)
+	for _, want := range values {
+		got, err := d.DecodeValue()
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := d.DecodeValue()
+	assert.Error(t, err)
+}
+
+func TestAMF0DecodeMalformed(t *testing.T) {
+	testCases := []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"short number", []byte{0x00, 0x3f}},
+		{"short string", []byte{0x02, 0x00, 0x05, 'a'}},
+		{"missing object end", []byte{0x03, 0x00, 0x01, 'a', 0x05}},
+		{"bad object end", []byte{0x03, 0x00, 0x00, 0x05}},
+		{"stray object end", []byte{0x09}},
+		{"movie clip", []byte{0x04}},
+		{"long strict array", []byte{0x0a, 0xff, 0xff, 0xff, 0xff, 0x05}},
+		{"forged long string", []byte{0x0c, 0x7f, 0xff, 0xff, 0xff, 'a'}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDecoder(bytes.NewReader(tc.b), AMF0).DecodeValue()
+			assert.Error(t, err)
+		})
+	}
+
+	nested := bytes.Repeat([]byte{0x0a, 0x00, 0x00, 0x00, 0x01}, maxDepth+1)
+	_, err := NewDecoder(bytes.NewReader(nested), AMF0).DecodeValue()
+	assert.Error(t, err)
+}
@@ -0,0 +1,153 @@
+package amf
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func marshal3(t *testing.T, v interface{}) []byte {
+	b := &bytes.Buffer{}
+	assert.NoError(t, NewEncoder(b, AMF3).Encode(v))
+	return b.Bytes()
+}
+
+func TestAMF3Integer(t *testing.T) {
+	testCases := []struct {
+		v    int
+		want []byte
+	}{
+		{0, []byte{0x04, 0x00}},
+		{0x7f, []byte{0x04, 0x7f}},
+		{0x80, []byte{0x04, 0x81, 0x00}},
+		{0x3fff, []byte{0x04, 0xff, 0x7f}},
+		{0x4000, []byte{0x04, 0x81, 0x80, 0x00}},
+		{0x1fffff, []byte{0x04, 0xff, 0xff, 0x7f}},
+		{0x200000, []byte{0x04, 0x80, 0xc0, 0x80, 0x00}},
+		{amf3IntegerMax, []byte{0x04, 0xbf, 0xff, 0xff, 0xff}},
+		{-1, []byte{0x04, 0xff, 0xff, 0xff, 0xff}},
+		{amf3IntegerMin, []byte{0x04, 0xc0, 0x80, 0x80, 0x00}},
+		{amf3IntegerMax + 1, []byte{0x05, 0x41, 0xb0, 0, 0, 0, 0, 0, 0}},
+	}
+	for _, tc := range testCases {
+		b := marshal3(t, tc.v)
+		assert.Equal(t, tc.want, b, "%d", tc.v)
+
+		got, err := NewDecoder(bytes.NewReader(b), AMF3).DecodeValue()
+		assert.NoError(t, err)
+		if tc.v > amf3IntegerMax {
+			assert.Equal(t, float64(tc.v), got)
+		} else {
+			assert.Equal(t, tc.v, got)
+		}
+	}
+}
+
+func TestAMF3StringAndTraitReferences(t *testing.T) {
+	type point struct {
+		X int `amf:"x"`
+		Y int `amf:"y"`
+	}
+	b := marshal3(t, []interface{}{"x", "x", point{1, 2}, point{3, 4}})
+	assert.Equal(t, []byte{
+		0x09, 0x09, 0x01, // dense array of 4
+		0x06, 0x03, 'x', // "x"
+		0x06, 0x00, // reference to "x"
+		0x0a, 0x23, 0x01, 0x00, 0x03, 'y', 0x04, 0x01, 0x04, 0x02, // sealed traits x, y
+		0x0a, 0x01, 0x04, 0x03, 0x04, 0x04, // reference to the traits
+	}, b)
+
+	d := NewDecoder(bytes.NewReader(b), AMF3)
+	var v []interface{}
+	assert.NoError(t, d.Decode(&v))
+	assert.Equal(t, []interface{}{
+		"x", "x",
+		map[string]interface{}{"x": 1, "y": 2},
+		map[string]interface{}{"x": 3, "y": 4},
+	}, v)
+
+	var got []point
+	b = marshal3(t, []point{{1, 2}, {3, 4}})
+	assert.NoError(t, NewDecoder(bytes.NewReader(b), AMF3).Decode(&got))
+	assert.Equal(t, []point{{1, 2}, {3, 4}}, got)
+}
+
+func TestAMF3RoundTrip(t *testing.T) {
+	shared := map[string]interface{}{"name": "shared"}
+	values := []interface{}{
+		Undefined{},
+		nil,
+		true,
+		false,
+		1.5,
+		"",
+		"héllo",
+		time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		XMLDocument("<doc/>"),
+		XML("<xml/>"),
+		[]byte{0x00, 0xff},
+		[]interface{}{shared, shared},
+		ECMAArray{"a": 1, "b": "c"},
+		&TypedObject{ClassName: "com.example.User", Properties: map[string]interface{}{"id": 7}},
+		VectorInt{-1, 2},
+		VectorUint{1, 0xffffffff},
+		VectorDouble{0.5},
+		&VectorObject{TypeName: "String", Fixed: true, Items: []interface{}{"a", nil}},
+		Dictionary{{Key: 1, Value: "one"}, {Key: shared, Value: true}},
+		&ArrayCollection{"a", 1},
+	}
+	b := &bytes.Buffer{}
+	e := NewEncoder(b, AMF3)
+	for _, v := range values {
+		assert.NoError(t, e.Encode(v))
+	}
+	d := NewDecoder(b, AMF3)
+	for _, want := range values {
+		got, err := d.DecodeValue()
+		if assert.NoError(t, err, "%#v", want) {
+			assert.Equal(t, want, got)
+		}
+	}
+	assert.Equal(t, 0, b.Len())
+}
+
+func TestAMF3MixedArray(t *testing.T) {
+	b := []byte{
+		0x09, 0x03, // one dense element
+		0x03, 'k', 0x06, 0x03, 'v', // "k": "v"
+		0x01,       // end of the associative part
+		0x04, 0x05, // 5
+	}
+	got, err := NewDecoder(bytes.NewReader(b), AMF3).DecodeValue()
+	assert.NoError(t, err)
+	assert.Equal(t, ECMAArray{"k": "v", "0": 5}, got)
+}
+
+func TestAMF3DecodeMalformed(t *testing.T) {
+	testCases := []struct {
+		name string
+		b    []byte
+	}{
+		{"string reference", []byte{0x06, 0x00}},
+		{"object reference", []byte{0x0a, 0x00}},
+		{"traits reference", []byte{0x0a, 0x01}},
+		{"unknown externalizable", []byte{0x0a, 0x07, 0x03, 'X'}},
+		{"short vector", []byte{0x0d, 0x05, 0x00, 0x00}},
+		{"unknown marker", []byte{0x12}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewDecoder(bytes.NewReader(tc.b), AMF3).DecodeValue()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAMF0SwitchToAMF3(t *testing.T) {
+	b := []byte{0x11, 0x0a, 0x0b, 0x01, 0x03, 'a', 0x04, 0x01, 0x01}
+	got, err := NewDecoder(bytes.NewReader(b), AMF0).DecodeValue()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"a": 1}, got)
+}
@@ -0,0 +1,268 @@
+package amf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Decoder reads AMF values. References are resolved among all values read
+// by one Decoder, so use one Decoder per message.
+type Decoder struct {
+	r       io.Reader
+	version Version
+	depth   int
+
+	refs    []interface{}
+	strings []string
+	traits  []traits3
+}
+
+type traits3 struct {
+	className      string
+	members        []string
+	dynamic        bool
+	externalizable bool
+}
+
+func NewDecoder(r io.Reader, version Version) *Decoder {
+	return &Decoder{
+		r:       r,
+		version: version,
+	}
+}
+
+// Read reads raw bytes, for Externalizable.ReadExternal.
+func (d *Decoder) Read(p []byte) (int, error) {
+	return d.r.Read(p)
+}
+
+// Decode reads the next value into the value pointed to by v.
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.Errorf("amf: Decode needs a non-nil pointer, got %T", v)
+	}
+	value, err := d.DecodeValue()
+	if err != nil {
+		return err
+	}
+	return assign(rv.Elem(), value, 0)
+}
+
+// DecodeValue reads the next value as one of the types in the package
+// documentation.
+func (d *Decoder) DecodeValue() (interface{}, error) {
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > maxDepth {
+		return nil, errors.New("amf: value nested too deeply")
+	}
+	marker, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if d.version == AMF3 {
+		return d.decode3(marker)
+	}
+	return d.decode0(marker)
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return 0, errors.Wrap(err, "amf: failed to read")
+	}
+	return b[0], nil
+}
+
+// readBytes reads n bytes. Large lengths are read as the data arrives, so a
+// forged length cannot allocate much more than the payload.
+func (d *Decoder) readBytes(n int) ([]byte, error) {
+	if n <= 1<<16 {
+		b := make([]byte, n)
+		if _, err := io.ReadFull(d.r, b); err != nil {
+			return nil, errors.Wrap(err, "amf: failed to read")
+		}
+		return b, nil
+	}
+	buf := &bytes.Buffer{}
+	if _, err := io.CopyN(buf, d.r, int64(n)); err != nil {
+		return nil, errors.Wrap(err, "amf: failed to read")
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *Decoder) readU16() (uint16, error) {
+	b, err := d.readBytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+func (d *Decoder) readU32() (uint32, error) {
+	b, err := d.readBytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b), nil
+}
+
+func (d *Decoder) readDouble() (float64, error) {
+	b, err := d.readBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+}
+
+// readUTF8 reads a string with a 16 bit length.
+func (d *Decoder) readUTF8() (string, error) {
+	n, err := d.readU16()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.readBytes(int(n))
+	return string(b), err
+}
+
+func (d *Decoder) readUTF8Long() (string, error) {
+	n, err := d.readU32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.readBytes(int(n))
+	return string(b), err
+}
+
+// decode0 reads an AMF0 value after its marker.
+func (d *Decoder) decode0(marker byte) (interface{}, error) {
+	switch marker {
+	case amf0Number:
+		return d.readDouble()
+	case amf0Boolean:
+		b, err := d.readByte()
+		return b != 0, err
+	case amf0String:
+		return d.readUTF8()
+	case amf0LongString:
+		return d.readUTF8Long()
+	case amf0Null:
+		return nil, nil
+	case amf0Undefined, amf0Unsupported:
+		return Undefined{}, nil
+	case amf0Object:
+		m := map[string]interface{}{}
+		d.refs = append(d.refs, m)
+		return m, d.readProperties0(m)
+	case amf0TypedObject:
+		className, err := d.readUTF8()
+		if err != nil {
+			return nil, err
+		}
+		o := &TypedObject{
+			ClassName:  className,
+			Properties: map[string]interface{}{},
+		}
+		d.refs = append(d.refs, o)
+		return o, d.readProperties0(o.Properties)
+	case amf0ECMAArray:
+		// the count is only a hint; the properties end with an object end
+		if _, err := d.readU32(); err != nil {
+			return nil, err
+		}
+		a := ECMAArray{}
+		d.refs = append(d.refs, a)
+		return a, d.readProperties0(a)
+	case amf0StrictArray:
+		n, err := d.readU32()
+		if err != nil {
+			return nil, err
+		}
+		i := len(d.refs)
+		d.refs = append(d.refs, nil)
+		a := make([]interface{}, 0, minInt(int(n), 1024))
+		for j := uint32(0); j < n; j++ {
+			v, err := d.DecodeValue()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		d.refs[i] = a
+		return a, nil
+	case amf0Reference:
+		i, err := d.readU16()
+		if err != nil {
+			return nil, err
+		}
+		if int(i) >= len(d.refs) {
+			return nil, errors.Errorf("amf: reference out of range: %d", i)
+		}
+		return d.refs[i], nil
+	case amf0Date:
+		ms, err := d.readDouble()
+		if err != nil {
+			return nil, err
+		}
+		// the time zone is reserved and should be ignored
+		if _, err := d.readU16(); err != nil {
+			return nil, err
+		}
+		return fromUnixMilli(ms), nil
+	case amf0XMLDocument:
+		s, err := d.readUTF8Long()
+		return XMLDocument(s), err
+	case amf0AVMPlus:
+		d3 := NewDecoder(d.r, AMF3)
+		d3.depth = d.depth
+		return d3.DecodeValue()
+	case amf0ObjectEnd:
+		return nil, errors.New("amf: unexpected object end")
+	case amf0MovieClip, amf0RecordSet:
+		return nil, errors.Errorf("amf: reserved AMF0 marker: 0x%02x", marker)
+	}
+	return nil, errors.Errorf("amf: unknown AMF0 marker: 0x%02x", marker)
+}
+
+func (d *Decoder) readProperties0(m map[string]interface{}) error {
+	for {
+		name, err := d.readUTF8()
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			marker, err := d.readByte()
+			if err != nil {
+				return err
+			}
+			if marker != amf0ObjectEnd {
+				return errors.Errorf("amf: expected object end, got 0x%02x", marker)
+			}
+			return nil
+		}
+		v, err := d.DecodeValue()
+		if err != nil {
+			return errors.Wrapf(err, "amf: failed to read property %q", name)
+		}
+		m[name] = v
+	}
+}
+
+func fromUnixMilli(ms float64) time.Time {
+	whole, frac := math.Modf(ms)
+	return time.UnixMilli(int64(whole)).Add(time.Duration(frac * float64(time.Millisecond))).UTC()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
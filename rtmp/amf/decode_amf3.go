@@ -0,0 +1,353 @@
+package amf
+
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// decode3 reads an AMF3 value after its marker.
+func (d *Decoder) decode3(marker byte) (interface{}, error) {
+	switch marker {
+	case amf3Undefined:
+		return Undefined{}, nil
+	case amf3Null:
+		return nil, nil
+	case amf3False:
+		return false, nil
+	case amf3True:
+		return true, nil
+	case amf3Integer:
+		u, err := d.readU29()
+		if err != nil {
+			return nil, err
+		}
+		// sign-extend the 29 bit integer
+		return int(int32(u<<3) >> 3), nil
+	case amf3Double:
+		return d.readDouble()
+	case amf3String:
+		return d.readString3()
+	case amf3XMLDocument, amf3XML, amf3ByteArray:
+		v, ok, err := d.readRef3()
+		if err != nil || ok {
+			return v, err
+		}
+		b, err := d.readBytes(v.(int))
+		if err != nil {
+			return nil, err
+		}
+		switch marker {
+		case amf3XMLDocument:
+			v = XMLDocument(b)
+		case amf3XML:
+			v = XML(b)
+		default:
+			v = b
+		}
+		d.refs = append(d.refs, v)
+		return v, nil
+	case amf3Date:
+		v, ok, err := d.readRef3()
+		if err != nil || ok {
+			return v, err
+		}
+		ms, err := d.readDouble()
+		if err != nil {
+			return nil, err
+		}
+		t := fromUnixMilli(ms)
+		d.refs = append(d.refs, t)
+		return t, nil
+	case amf3Array:
+		return d.readArray3()
+	case amf3Object:
+		return d.readObject3()
+	case amf3VectorInt, amf3VectorUint, amf3VectorDouble:
+		return d.readVector3(marker)
+	case amf3VectorObject:
+		v, ok, err := d.readRef3()
+		if err != nil || ok {
+			return v, err
+		}
+		n := v.(int)
+		fixed, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		typeName, err := d.readString3()
+		if err != nil {
+			return nil, err
+		}
+		o := &VectorObject{
+			TypeName: typeName,
+			Fixed:    fixed != 0,
+			Items:    make([]interface{}, 0, minInt(n, 1024)),
+		}
+		d.refs = append(d.refs, o)
+		for i := 0; i < n; i++ {
+			item, err := d.DecodeValue()
+			if err != nil {
+				return nil, err
+			}
+			o.Items = append(o.Items, item)
+		}
+		return o, nil
+	case amf3Dictionary:
+		v, ok, err := d.readRef3()
+		if err != nil || ok {
+			return v, err
+		}
+		n := v.(int)
+		// weak keys mean nothing here
+		if _, err := d.readByte(); err != nil {
+			return nil, err
+		}
+		i := len(d.refs)
+		d.refs = append(d.refs, nil)
+		dict := make(Dictionary, 0, minInt(n, 1024))
+		for j := 0; j < n; j++ {
+			k, err := d.DecodeValue()
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.DecodeValue()
+			if err != nil {
+				return nil, err
+			}
+			dict = append(dict, DictionaryEntry{Key: k, Value: v})
+		}
+		d.refs[i] = dict
+		return dict, nil
+	}
+	return nil, errors.Errorf("amf: unsupported AMF3 marker: 0x%02x", marker)
+}
+
+func (d *Decoder) readU29() (uint32, error) {
+	var v uint32
+	for i := 0; i < 3; i++ {
+		b, err := d.readByte()
+		if err != nil {
+			return 0, err
+		}
+		if b&0x80 == 0 {
+			return v<<7 | uint32(b), nil
+		}
+		v = v<<7 | uint32(b&0x7f)
+	}
+	b, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	return v<<8 | uint32(b), nil
+}
+
+// readRef3 reads a U29 header. It returns the referenced value with ok, or
+// else the inline length as an int.
+func (d *Decoder) readRef3() (v interface{}, ok bool, err error) {
+	u, err := d.readU29()
+	if err != nil {
+		return nil, false, err
+	}
+	if u&1 == 0 {
+		i := int(u >> 1)
+		if i >= len(d.refs) {
+			return nil, false, errors.Errorf("amf: object reference out of range: %d", i)
+		}
+		return d.refs[i], true, nil
+	}
+	return int(u >> 1), false, nil
+}
+
+func (d *Decoder) readString3() (string, error) {
+	u, err := d.readU29()
+	if err != nil {
+		return "", err
+	}
+	if u&1 == 0 {
+		i := int(u >> 1)
+		if i >= len(d.strings) {
+			return "", errors.Errorf("amf: string reference out of range: %d", i)
+		}
+		return d.strings[i], nil
+	}
+	b, err := d.readBytes(int(u >> 1))
+	if err != nil {
+		return "", err
+	}
+	s := string(b)
+	if s != "" {
+		d.strings = append(d.strings, s)
+	}
+	return s, nil
+}
+
+func (d *Decoder) readArray3() (interface{}, error) {
+	v, ok, err := d.readRef3()
+	if err != nil || ok {
+		return v, err
+	}
+	n := v.(int)
+	i := len(d.refs)
+	d.refs = append(d.refs, nil)
+
+	var assoc ECMAArray
+	for {
+		k, err := d.readString3()
+		if err != nil {
+			return nil, err
+		}
+		if k == "" {
+			break
+		}
+		if assoc == nil {
+			assoc = ECMAArray{}
+			d.refs[i] = assoc
+		}
+		if assoc[k], err = d.DecodeValue(); err != nil {
+			return nil, err
+		}
+	}
+	if assoc != nil {
+		for j := 0; j < n; j++ {
+			if assoc[strconv.Itoa(j)], err = d.DecodeValue(); err != nil {
+				return nil, err
+			}
+		}
+		return assoc, nil
+	}
+	a := make([]interface{}, 0, minInt(n, 1024))
+	for j := 0; j < n; j++ {
+		v, err := d.DecodeValue()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	d.refs[i] = a
+	return a, nil
+}
+
+func (d *Decoder) readObject3() (interface{}, error) {
+	u, err := d.readU29()
+	if err != nil {
+		return nil, err
+	}
+	if u&1 == 0 {
+		i := int(u >> 1)
+		if i >= len(d.refs) {
+			return nil, errors.Errorf("amf: object reference out of range: %d", i)
+		}
+		return d.refs[i], nil
+	}
+
+	var t traits3
+	if u&2 == 0 {
+		i := int(u >> 2)
+		if i >= len(d.traits) {
+			return nil, errors.Errorf("amf: traits reference out of range: %d", i)
+		}
+		t = d.traits[i]
+	} else {
+		t.externalizable = u&4 != 0
+		t.dynamic = u&8 != 0
+		if t.className, err = d.readString3(); err != nil {
+			return nil, err
+		}
+		n := int(u >> 4)
+		t.members = make([]string, 0, minInt(n, 1024))
+		for i := 0; i < n; i++ {
+			m, err := d.readString3()
+			if err != nil {
+				return nil, err
+			}
+			t.members = append(t.members, m)
+		}
+		d.traits = append(d.traits, t)
+	}
+
+	if t.externalizable {
+		x, ok := newExternalizable(t.className)
+		if !ok {
+			return nil, errors.Errorf("amf: externalizable class is not registered: %s", t.className)
+		}
+		d.refs = append(d.refs, x)
+		if err := x.ReadExternal(d); err != nil {
+			return nil, errors.Wrapf(err, "amf: failed to read %s", t.className)
+		}
+		return x, nil
+	}
+
+	props := map[string]interface{}{}
+	var v interface{} = props
+	if t.className != "" {
+		v = &TypedObject{
+			ClassName:  t.className,
+			Properties: props,
+		}
+	}
+	d.refs = append(d.refs, v)
+	for _, m := range t.members {
+		if props[m], err = d.DecodeValue(); err != nil {
+			return nil, errors.Wrapf(err, "amf: failed to read member %q", m)
+		}
+	}
+	if t.dynamic {
+		for {
+			k, err := d.readString3()
+			if err != nil {
+				return nil, err
+			}
+			if k == "" {
+				break
+			}
+			if props[k], err = d.DecodeValue(); err != nil {
+				return nil, errors.Wrapf(err, "amf: failed to read member %q", k)
+			}
+		}
+	}
+	return v, nil
+}
+
+func (d *Decoder) readVector3(marker byte) (interface{}, error) {
+	v, ok, err := d.readRef3()
+	if err != nil || ok {
+		return v, err
+	}
+	n := v.(int)
+	if _, err := d.readByte(); err != nil { // fixed
+		return nil, err
+	}
+	size := 4
+	if marker == amf3VectorDouble {
+		size = 8
+	}
+	b, err := d.readBytes(n * size)
+	if err != nil {
+		return nil, err
+	}
+	switch marker {
+	case amf3VectorInt:
+		vec := make(VectorInt, n)
+		for i := range vec {
+			vec[i] = int32(binary.BigEndian.Uint32(b[i*4:]))
+		}
+		v = vec
+	case amf3VectorUint:
+		vec := make(VectorUint, n)
+		for i := range vec {
+			vec[i] = binary.BigEndian.Uint32(b[i*4:])
+		}
+		v = vec
+	default:
+		vec := make(VectorDouble, n)
+		for i := range vec {
+			vec[i] = math.Float64frombits(binary.BigEndian.Uint64(b[i*8:]))
+		}
+		v = vec
+	}
+	d.refs = append(d.refs, v)
+	return v, nil
+}
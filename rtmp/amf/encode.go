@@ -0,0 +1,415 @@
+package amf
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	amf0Number      = 0x00
+	amf0Boolean     = 0x01
+	amf0String      = 0x02
+	amf0Object      = 0x03
+	amf0MovieClip   = 0x04
+	amf0Null        = 0x05
+	amf0Undefined   = 0x06
+	amf0Reference   = 0x07
+	amf0ECMAArray   = 0x08
+	amf0ObjectEnd   = 0x09
+	amf0StrictArray = 0x0A
+	amf0Date        = 0x0B
+	amf0LongString  = 0x0C
+	amf0Unsupported = 0x0D
+	amf0RecordSet   = 0x0E
+	amf0XMLDocument = 0x0F
+	amf0TypedObject = 0x10
+	amf0AVMPlus     = 0x11
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Encoder writes AMF values. References are shared by all values written
+// by one Encoder, so use one Encoder per message.
+type Encoder struct {
+	w       io.Writer
+	version Version
+	depth   int
+
+	// refs indexes maps and pointers by address in the reference table
+	// (AMF0) or object table (AMF3), which has nRefs entries.
+	refs    map[uintptr]int
+	nRefs   int
+	strings map[string]int
+	traits  map[string]int
+}
+
+func NewEncoder(w io.Writer, version Version) *Encoder {
+	return &Encoder{
+		w:       w,
+		version: version,
+		refs:    map[uintptr]int{},
+		strings: map[string]int{},
+		traits:  map[string]int{},
+	}
+}
+
+// Write writes raw bytes, for Externalizable.WriteExternal.
+func (e *Encoder) Write(p []byte) (int, error) {
+	return e.w.Write(p)
+}
+
+// Encode writes v.
+func (e *Encoder) Encode(v interface{}) error {
+	e.depth++
+	defer func() { e.depth-- }()
+	if e.depth > maxDepth {
+		return errors.New("amf: value nested too deeply")
+	}
+	if e.version == AMF3 {
+		return e.encode3(v)
+	}
+	return e.encode0(v)
+}
+
+func (e *Encoder) writeByte(b byte) error {
+	_, err := e.w.Write([]byte{b})
+	return err
+}
+
+func (e *Encoder) writeU16(v uint16) error {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	_, err := e.w.Write(b)
+	return err
+}
+
+func (e *Encoder) writeU32(v uint32) error {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	_, err := e.w.Write(b)
+	return err
+}
+
+func (e *Encoder) writeDouble(v float64) error {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(v))
+	_, err := e.w.Write(b)
+	return err
+}
+
+// ref returns the table index of a map or pointer written before.
+func (e *Encoder) ref(rv reflect.Value) (int, bool) {
+	if rv.Kind() != reflect.Map && rv.Kind() != reflect.Ptr {
+		return 0, false
+	}
+	i, ok := e.refs[rv.Pointer()]
+	return i, ok
+}
+
+// addRef takes the next table index, and remembers it for maps and
+// pointers.
+func (e *Encoder) addRef(rv reflect.Value) {
+	if rv.IsValid() && (rv.Kind() == reflect.Map || rv.Kind() == reflect.Ptr) {
+		e.refs[rv.Pointer()] = e.nRefs
+	}
+	e.nRefs++
+}
+
+// encode0 writes v in AMF0.
+func (e *Encoder) encode0(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		return e.writeByte(amf0Null)
+	case Undefined:
+		return e.writeByte(amf0Undefined)
+	case bool:
+		if err := e.writeByte(amf0Boolean); err != nil {
+			return err
+		}
+		if v {
+			return e.writeByte(1)
+		}
+		return e.writeByte(0)
+	case string:
+		return e.writeString0(v)
+	case time.Time:
+		if err := e.writeByte(amf0Date); err != nil {
+			return err
+		}
+		if err := e.writeDouble(unixMilli(v)); err != nil {
+			return err
+		}
+		return e.writeU16(0)
+	case XMLDocument:
+		return e.writeXML0(string(v))
+	case XML:
+		return e.writeXML0(string(v))
+	case ECMAArray:
+		rv := reflect.ValueOf(v)
+		if i, ok := e.ref(rv); ok {
+			return e.writeRef0(i)
+		}
+		e.addRef(rv)
+		if err := e.writeByte(amf0ECMAArray); err != nil {
+			return err
+		}
+		if err := e.writeU32(uint32(len(v))); err != nil {
+			return err
+		}
+		return e.writeProperties0(v)
+	case TypedObject:
+		return e.encode0(&v)
+	case *TypedObject:
+		if v == nil {
+			return e.writeByte(amf0Null)
+		}
+		rv := reflect.ValueOf(v)
+		if i, ok := e.ref(rv); ok {
+			return e.writeRef0(i)
+		}
+		e.addRef(rv)
+		if err := e.writeByte(amf0TypedObject); err != nil {
+			return err
+		}
+		if err := e.writeUTF8(v.ClassName); err != nil {
+			return err
+		}
+		return e.writeProperties0(v.Properties)
+	case []byte, VectorInt, VectorUint, VectorDouble, VectorObject, *VectorObject, Dictionary, Externalizable:
+		if err := e.writeByte(amf0AVMPlus); err != nil {
+			return err
+		}
+		return NewEncoder(e.w, AMF3).Encode(v)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return e.writeByte(amf0Null)
+		}
+		if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct && rv.Elem().Type() != timeType {
+			if i, ok := e.ref(rv); ok {
+				return e.writeRef0(i)
+			}
+			e.addRef(rv)
+			return e.writeStruct0(rv.Elem())
+		}
+		return e.Encode(rv.Elem().Interface())
+	case reflect.Bool:
+		return e.encode0(rv.Bool())
+	case reflect.String:
+		return e.writeString0(rv.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		if err := e.writeByte(amf0Number); err != nil {
+			return err
+		}
+		return e.writeDouble(toFloat(rv))
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return errors.Errorf("amf: unsupported map key type: %s", rv.Type().Key())
+		}
+		if rv.IsNil() {
+			return e.writeByte(amf0Null)
+		}
+		if i, ok := e.ref(rv); ok {
+			return e.writeRef0(i)
+		}
+		e.addRef(rv)
+		if err := e.writeByte(amf0Object); err != nil {
+			return err
+		}
+		return e.writeMap0(rv)
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return e.encode0(bytesOf(rv))
+		}
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return e.writeByte(amf0Null)
+		}
+		e.addRef(reflect.Value{})
+		if err := e.writeByte(amf0StrictArray); err != nil {
+			return err
+		}
+		if err := e.writeU32(uint32(rv.Len())); err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.Encode(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		e.addRef(reflect.Value{})
+		return e.writeStruct0(rv)
+	}
+	return errors.Errorf("amf: unsupported type: %T", v)
+}
+
+func (e *Encoder) writeRef0(i int) error {
+	if i > math.MaxUint16 {
+		return errors.Errorf("amf: reference index out of range: %d", i)
+	}
+	if err := e.writeByte(amf0Reference); err != nil {
+		return err
+	}
+	return e.writeU16(uint16(i))
+}
+
+func (e *Encoder) writeString0(s string) error {
+	if len(s) > math.MaxUint16 {
+		if err := e.writeByte(amf0LongString); err != nil {
+			return err
+		}
+		if err := e.writeU32(uint32(len(s))); err != nil {
+			return err
+		}
+		_, err := io.WriteString(e.w, s)
+		return err
+	}
+	if err := e.writeByte(amf0String); err != nil {
+		return err
+	}
+	return e.writeUTF8(s)
+}
+
+// writeUTF8 writes a string with a 16 bit length, as used for names.
+func (e *Encoder) writeUTF8(s string) error {
+	if len(s) > math.MaxUint16 {
+		return errors.Errorf("amf: string too long: %d bytes", len(s))
+	}
+	if err := e.writeU16(uint16(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, s)
+	return err
+}
+
+func (e *Encoder) writeXML0(s string) error {
+	if err := e.writeByte(amf0XMLDocument); err != nil {
+		return err
+	}
+	if err := e.writeU32(uint32(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, s)
+	return err
+}
+
+func (e *Encoder) writeObjectEnd0() error {
+	_, err := e.w.Write([]byte{0x00, 0x00, amf0ObjectEnd})
+	return err
+}
+
+func (e *Encoder) writeProperties0(m map[string]interface{}) error {
+	for _, k := range sortedKeys(m) {
+		if err := e.writeUTF8(k); err != nil {
+			return err
+		}
+		if err := e.Encode(m[k]); err != nil {
+			return err
+		}
+	}
+	return e.writeObjectEnd0()
+}
+
+func (e *Encoder) writeMap0(rv reflect.Value) error {
+	keys := rv.MapKeys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	for _, k := range keys {
+		if err := e.writeUTF8(k.String()); err != nil {
+			return err
+		}
+		if err := e.Encode(rv.MapIndex(k).Interface()); err != nil {
+			return err
+		}
+	}
+	return e.writeObjectEnd0()
+}
+
+func (e *Encoder) writeStruct0(rv reflect.Value) error {
+	if cn, ok := classNameOf(rv); ok {
+		if err := e.writeByte(amf0TypedObject); err != nil {
+			return err
+		}
+		if err := e.writeUTF8(cn); err != nil {
+			return err
+		}
+	} else if err := e.writeByte(amf0Object); err != nil {
+		return err
+	}
+	for _, f := range cachedFields(rv.Type()) {
+		fv, ok := fieldByIndex(rv, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		if err := e.writeUTF8(f.name); err != nil {
+			return err
+		}
+		if err := e.Encode(fv.Interface()); err != nil {
+			return err
+		}
+	}
+	return e.writeObjectEnd0()
+}
+
+func classNameOf(rv reflect.Value) (className string, ok bool) {
+	// AMFClassName may be promoted from a nil embedded pointer
+	defer func() {
+		if recover() != nil {
+			className, ok = "", false
+		}
+	}()
+	if rv.CanInterface() {
+		if cn, ok := rv.Interface().(ClassNamer); ok {
+			return cn.AMFClassName(), true
+		}
+	}
+	if rv.CanAddr() {
+		if cn, ok := rv.Addr().Interface().(ClassNamer); ok {
+			return cn.AMFClassName(), true
+		}
+	}
+	return "", false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func bytesOf(rv reflect.Value) []byte {
+	if rv.Kind() == reflect.Slice {
+		return rv.Bytes()
+	}
+	b := make([]byte, rv.Len())
+	reflect.Copy(reflect.ValueOf(b), rv)
+	return b
+}
+
+func toFloat(rv reflect.Value) float64 {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint())
+	}
+	return rv.Float()
+}
+
+func unixMilli(t time.Time) float64 {
+	return float64(t.Unix())*1000 + float64(t.Nanosecond())/float64(time.Millisecond)
+}
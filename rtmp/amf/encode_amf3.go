@@ -0,0 +1,433 @@
+package amf
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	amf3Undefined    = 0x00
+	amf3Null         = 0x01
+	amf3False        = 0x02
+	amf3True         = 0x03
+	amf3Integer      = 0x04
+	amf3Double       = 0x05
+	amf3String       = 0x06
+	amf3XMLDocument  = 0x07
+	amf3Date         = 0x08
+	amf3Array        = 0x09
+	amf3Object       = 0x0A
+	amf3XML          = 0x0B
+	amf3ByteArray    = 0x0C
+	amf3VectorInt    = 0x0D
+	amf3VectorUint   = 0x0E
+	amf3VectorDouble = 0x0F
+	amf3VectorObject = 0x10
+	amf3Dictionary   = 0x11
+
+	amf3IntegerMin = -1 << 28
+	amf3IntegerMax = 1<<28 - 1
+	u29Max         = 1<<29 - 1
+)
+
+// encode3 writes v in AMF3.
+func (e *Encoder) encode3(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		return e.writeByte(amf3Null)
+	case Undefined:
+		return e.writeByte(amf3Undefined)
+	case bool:
+		if v {
+			return e.writeByte(amf3True)
+		}
+		return e.writeByte(amf3False)
+	case string:
+		if err := e.writeByte(amf3String); err != nil {
+			return err
+		}
+		return e.writeString3(v)
+	case time.Time:
+		e.addRef(reflect.Value{})
+		if err := e.writeByte(amf3Date); err != nil {
+			return err
+		}
+		if err := e.writeU29(1); err != nil {
+			return err
+		}
+		return e.writeDouble(unixMilli(v))
+	case XMLDocument:
+		return e.writeInlineBytes3(amf3XMLDocument, []byte(v))
+	case XML:
+		return e.writeInlineBytes3(amf3XML, []byte(v))
+	case []byte:
+		return e.writeInlineBytes3(amf3ByteArray, v)
+	case ECMAArray:
+		rv := reflect.ValueOf(v)
+		if done, err := e.writeRef3(amf3Array, rv); done {
+			return err
+		}
+		if err := e.writeU29(1); err != nil {
+			return err
+		}
+		for _, k := range sortedKeys(v) {
+			if err := e.writeString3(k); err != nil {
+				return err
+			}
+			if err := e.Encode(v[k]); err != nil {
+				return err
+			}
+		}
+		return e.writeString3("")
+	case TypedObject:
+		return e.encode3(&v)
+	case *TypedObject:
+		if v == nil {
+			return e.writeByte(amf3Null)
+		}
+		rv := reflect.ValueOf(v)
+		if done, err := e.writeRef3(amf3Object, rv); done {
+			return err
+		}
+		names := sortedKeys(v.Properties)
+		if err := e.writeTraits3(v.ClassName, names, false, false); err != nil {
+			return err
+		}
+		for _, k := range names {
+			if err := e.Encode(v.Properties[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Externalizable:
+		rv := reflect.ValueOf(v)
+		if done, err := e.writeRef3(amf3Object, rv); done {
+			return err
+		}
+		if err := e.writeTraits3(v.AMFClassName(), nil, false, true); err != nil {
+			return err
+		}
+		return v.WriteExternal(e)
+	case VectorInt:
+		return e.writeVector3(amf3VectorInt, len(v), false, func(b []byte) {
+			for i, n := range v {
+				binary.BigEndian.PutUint32(b[i*4:], uint32(n))
+			}
+		})
+	case VectorUint:
+		return e.writeVector3(amf3VectorUint, len(v), false, func(b []byte) {
+			for i, n := range v {
+				binary.BigEndian.PutUint32(b[i*4:], n)
+			}
+		})
+	case VectorDouble:
+		return e.writeVector3(amf3VectorDouble, len(v), false, func(b []byte) {
+			for i, n := range v {
+				binary.BigEndian.PutUint64(b[i*8:], math.Float64bits(n))
+			}
+		})
+	case VectorObject:
+		return e.encode3(&v)
+	case *VectorObject:
+		if v == nil {
+			return e.writeByte(amf3Null)
+		}
+		rv := reflect.ValueOf(v)
+		if done, err := e.writeRef3(amf3VectorObject, rv); done {
+			return err
+		}
+		if err := e.writeLengthFixed3(len(v.Items), v.Fixed); err != nil {
+			return err
+		}
+		if err := e.writeString3(v.TypeName); err != nil {
+			return err
+		}
+		for _, item := range v.Items {
+			if err := e.Encode(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Dictionary:
+		e.addRef(reflect.Value{})
+		if err := e.writeByte(amf3Dictionary); err != nil {
+			return err
+		}
+		if err := e.writeLengthFixed3(len(v), false); err != nil {
+			return err
+		}
+		for _, entry := range v {
+			if err := e.Encode(entry.Key); err != nil {
+				return err
+			}
+			if err := e.Encode(entry.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return e.writeByte(amf3Null)
+		}
+		if rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct && rv.Elem().Type() != timeType {
+			if done, err := e.writeRef3(amf3Object, rv); done {
+				return err
+			}
+			return e.writeStruct3(rv.Elem())
+		}
+		return e.Encode(rv.Elem().Interface())
+	case reflect.Bool:
+		return e.encode3(rv.Bool())
+	case reflect.String:
+		return e.encode3(rv.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := rv.Int(); n >= amf3IntegerMin && n <= amf3IntegerMax {
+			if err := e.writeByte(amf3Integer); err != nil {
+				return err
+			}
+			return e.writeU29(uint32(n) & u29Max)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := rv.Uint(); n <= amf3IntegerMax {
+			if err := e.writeByte(amf3Integer); err != nil {
+				return err
+			}
+			return e.writeU29(uint32(n))
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return errors.Errorf("amf: unsupported map key type: %s", rv.Type().Key())
+		}
+		if rv.IsNil() {
+			return e.writeByte(amf3Null)
+		}
+		if done, err := e.writeRef3(amf3Object, rv); done {
+			return err
+		}
+		if err := e.writeTraits3("", nil, true, false); err != nil {
+			return err
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			if k.String() == "" {
+				continue // the empty name ends the dynamic members
+			}
+			if err := e.writeString3(k.String()); err != nil {
+				return err
+			}
+			if err := e.Encode(rv.MapIndex(k).Interface()); err != nil {
+				return err
+			}
+		}
+		return e.writeString3("")
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return e.encode3(bytesOf(rv))
+		}
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return e.writeByte(amf3Null)
+		}
+		e.addRef(reflect.Value{})
+		if err := e.writeByte(amf3Array); err != nil {
+			return err
+		}
+		if err := e.writeLength3(rv.Len()); err != nil {
+			return err
+		}
+		if err := e.writeString3(""); err != nil {
+			return err
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := e.Encode(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Struct:
+		e.addRef(reflect.Value{})
+		if err := e.writeByte(amf3Object); err != nil {
+			return err
+		}
+		return e.writeStruct3(rv)
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		if err := e.writeByte(amf3Double); err != nil {
+			return err
+		}
+		return e.writeDouble(toFloat(rv))
+	}
+	return errors.Errorf("amf: unsupported type: %T", v)
+}
+
+func (e *Encoder) writeU29(v uint32) error {
+	if v > u29Max {
+		return errors.Errorf("amf: value out of U29 range: %d", v)
+	}
+	var b []byte
+	switch {
+	case v < 0x80:
+		b = []byte{byte(v)}
+	case v < 0x4000:
+		b = []byte{byte(v>>7) | 0x80, byte(v & 0x7f)}
+	case v < 0x200000:
+		b = []byte{byte(v>>14) | 0x80, byte(v>>7) | 0x80, byte(v & 0x7f)}
+	default:
+		b = []byte{byte(v>>22) | 0x80, byte(v>>15) | 0x80, byte(v>>8) | 0x80, byte(v)}
+	}
+	_, err := e.w.Write(b)
+	return err
+}
+
+// writeLength3 writes an inline length, which is shifted past the
+// reference flag.
+func (e *Encoder) writeLength3(n int) error {
+	if n > u29Max>>1 {
+		return errors.Errorf("amf: length out of range: %d", n)
+	}
+	return e.writeU29(uint32(n)<<1 | 1)
+}
+
+func (e *Encoder) writeLengthFixed3(n int, fixed bool) error {
+	if err := e.writeLength3(n); err != nil {
+		return err
+	}
+	if fixed {
+		return e.writeByte(1)
+	}
+	return e.writeByte(0)
+}
+
+func (e *Encoder) writeString3(s string) error {
+	if s == "" {
+		return e.writeU29(1)
+	}
+	if i, ok := e.strings[s]; ok {
+		return e.writeU29(uint32(i) << 1)
+	}
+	e.strings[s] = len(e.strings)
+	if err := e.writeLength3(len(s)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, s)
+	return err
+}
+
+// writeRef3 writes the marker, and a reference if rv was written before.
+// done reports whether the value is complete.
+func (e *Encoder) writeRef3(marker byte, rv reflect.Value) (done bool, err error) {
+	if err := e.writeByte(marker); err != nil {
+		return true, err
+	}
+	if i, ok := e.ref(rv); ok {
+		return true, e.writeU29(uint32(i) << 1)
+	}
+	e.addRef(rv)
+	return false, nil
+}
+
+func (e *Encoder) writeInlineBytes3(marker byte, b []byte) error {
+	e.addRef(reflect.Value{})
+	if err := e.writeByte(marker); err != nil {
+		return err
+	}
+	if err := e.writeLength3(len(b)); err != nil {
+		return err
+	}
+	_, err := e.w.Write(b)
+	return err
+}
+
+func (e *Encoder) writeVector3(marker byte, n int, fixed bool, put func(b []byte)) error {
+	e.addRef(reflect.Value{})
+	if err := e.writeByte(marker); err != nil {
+		return err
+	}
+	if err := e.writeLengthFixed3(n, fixed); err != nil {
+		return err
+	}
+	size := 4
+	if marker == amf3VectorDouble {
+		size = 8
+	}
+	b := make([]byte, n*size)
+	put(b)
+	_, err := e.w.Write(b)
+	return err
+}
+
+// writeTraits3 writes the object header, by reference to equal traits
+// written before.
+func (e *Encoder) writeTraits3(className string, members []string, dynamic, externalizable bool) error {
+	key := className + "\x00" + strings.Join(members, "\x00")
+	if dynamic {
+		key += "\x00dynamic"
+	}
+	if externalizable {
+		key += "\x00externalizable"
+	}
+	if i, ok := e.traits[key]; ok {
+		return e.writeU29(uint32(i)<<2 | 0x01)
+	}
+	e.traits[key] = len(e.traits)
+
+	if len(members) > u29Max>>4 {
+		return errors.Errorf("amf: too many members: %d", len(members))
+	}
+	header := uint32(len(members))<<4 | 0x03
+	if externalizable {
+		header |= 0x04
+	}
+	if dynamic {
+		header |= 0x08
+	}
+	if err := e.writeU29(header); err != nil {
+		return err
+	}
+	if err := e.writeString3(className); err != nil {
+		return err
+	}
+	for _, m := range members {
+		if err := e.writeString3(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) writeStruct3(rv reflect.Value) error {
+	className, _ := classNameOf(rv)
+	var names []string
+	var values []reflect.Value
+	for _, f := range cachedFields(rv.Type()) {
+		fv, ok := fieldByIndex(rv, f.index)
+		if !ok || (f.omitEmpty && isEmptyValue(fv)) {
+			continue
+		}
+		names = append(names, f.name)
+		values = append(values, fv)
+	}
+	if err := e.writeTraits3(className, names, false, false); err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := e.Encode(v.Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
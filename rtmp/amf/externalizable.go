@@ -0,0 +1,38 @@
+package amf
+
+import "github.com/pkg/errors"
+
+func init() {
+	RegisterExternalizable(arrayCollectionClassName, func() Externalizable {
+		return &ArrayCollection{}
+	})
+}
+
+const arrayCollectionClassName = "flex.messaging.io.ArrayCollection"
+
+// ArrayCollection is the Flex collection that wraps an array.
+type ArrayCollection []interface{}
+
+func (c *ArrayCollection) AMFClassName() string {
+	return arrayCollectionClassName
+}
+
+func (c *ArrayCollection) ReadExternal(d *Decoder) error {
+	v, err := d.DecodeValue()
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case nil:
+		*c = nil
+	case []interface{}:
+		*c = v
+	default:
+		return errors.Errorf("amf: ArrayCollection source is %T", v)
+	}
+	return nil
+}
+
+func (c *ArrayCollection) WriteExternal(e *Encoder) error {
+	return e.Encode([]interface{}(*c))
+}
@@ -0,0 +1,142 @@
+package amf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type statusInfo struct {
+	Level       string `amf:"level"`
+	Code        string `amf:"code"`
+	Description string `amf:"description,omitempty"`
+	Internal    string `amf:"-"`
+	Details     *details
+}
+
+type details struct {
+	Bytes   uint32    `amf:"bytes"`
+	Start   time.Time `amf:"start"`
+	Streams []string  `amf:"streams"`
+}
+
+type user struct {
+	ID   int    `amf:"id"`
+	Name string `amf:"name"`
+}
+
+func (user) AMFClassName() string {
+	return "com.example.User"
+}
+
+// Point is exported to be embedded by pointer.
+type Point struct {
+	X int `amf:"x"`
+	Y int `amf:"y,omitempty"`
+}
+
+func (*Point) AMFClassName() string {
+	return "Point"
+}
+
+func TestMarshalStruct(t *testing.T) {
+	in := statusInfo{
+		Level:    "status",
+		Code:     "NetStream.Play.Start",
+		Internal: "secret",
+		Details: &details{
+			Bytes:   42,
+			Start:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			Streams: []string{"a", "b"},
+		},
+	}
+	b, err := Marshal(in)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var m map[string]interface{}
+	assert.NoError(t, Unmarshal(b, &m))
+	assert.Equal(t, map[string]interface{}{
+		"level": "status",
+		"code":  "NetStream.Play.Start",
+		"Details": map[string]interface{}{
+			"bytes":   42.0,
+			"start":   in.Details.Start,
+			"streams": []interface{}{"a", "b"},
+		},
+	}, m)
+
+	var out statusInfo
+	assert.NoError(t, Unmarshal(b, &out))
+	in.Internal = ""
+	assert.Equal(t, in, out)
+}
+
+func TestMarshalTypedStruct(t *testing.T) {
+	b, err := Marshal(user{ID: 7, Name: "n"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var v interface{}
+	assert.NoError(t, Unmarshal(b, &v))
+	assert.Equal(t, &TypedObject{
+		ClassName:  "com.example.User",
+		Properties: map[string]interface{}{"id": 7.0, "name": "n"},
+	}, v)
+
+	var u user
+	assert.NoError(t, Unmarshal(b, &u))
+	assert.Equal(t, user{ID: 7, Name: "n"}, u)
+}
+
+func TestMarshalEmbedded(t *testing.T) {
+	type base struct {
+		Code string `amf:"code"`
+	}
+	type info struct {
+		base
+		*Point
+		Extra int `amf:"extra"`
+	}
+	b, err := Marshal(info{base: base{Code: "c"}, Extra: 1})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var m map[string]interface{}
+	assert.NoError(t, Unmarshal(b, &m))
+	assert.Equal(t, map[string]interface{}{"code": "c", "extra": 1.0}, m)
+
+	b, err = Marshal(map[string]interface{}{"code": "c", "x": 3, "extra": 1})
+	assert.NoError(t, err)
+	var out info
+	assert.NoError(t, Unmarshal(b, &out))
+	assert.Equal(t, info{base: base{Code: "c"}, Point: &Point{X: 3}, Extra: 1}, out)
+}
+
+func TestUnmarshalTypeError(t *testing.T) {
+	b, err := Marshal(map[string]interface{}{"bytes": "many"})
+	assert.NoError(t, err)
+	var d details
+	err = Unmarshal(b, &d)
+	assert.IsType(t, &UnmarshalTypeError{}, err)
+
+	b, err = Marshal(-1)
+	assert.NoError(t, err)
+	var u uint8
+	assert.Error(t, Unmarshal(b, &u))
+
+	assert.Error(t, Unmarshal(b, u))
+}
+
+func TestUnmarshalNullAndUndefined(t *testing.T) {
+	s := "set"
+	for _, v := range []interface{}{nil, Undefined{}} {
+		b, err := Marshal(v)
+		assert.NoError(t, err)
+		p := &s
+		assert.NoError(t, Unmarshal(b, &p))
+		assert.Nil(t, p)
+	}
+}
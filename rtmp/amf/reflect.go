@@ -0,0 +1,257 @@
+package amf
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+type field struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // reflect.Type -> []field
+
+// cachedFields lists the fields of a struct type that map to properties.
+// Untagged embedded structs are flattened into their parent.
+func cachedFields(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	fs := typeFields(t, nil)
+	fieldCache.Store(t, fs)
+	return fs
+}
+
+func typeFields(t reflect.Type, index []int) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("amf")
+		if tag == "-" {
+			continue
+		}
+		idx := append(append([]int{}, index...), i)
+		name, opts := tag, ""
+		if j := strings.Index(tag, ","); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fs = append(fs, typeFields(ft, idx)...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fs = append(fs, field{
+			name:      name,
+			index:     idx,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+	return fs
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex that reports false at a nil
+// embedded pointer instead of panicking.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// fieldByIndexAlloc is fieldByIndex for decoding, allocating nil embedded
+// pointers on the way. It reports false if a pointer to an unexported type
+// cannot be allocated.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(interface{ IsZero() bool }).IsZero()
+		}
+	}
+	return false
+}
+
+// assign stores a decoded value in dst, converting it to the type of dst.
+func assign(dst reflect.Value, src interface{}, depth int) error {
+	if depth > maxDepth {
+		return &UnmarshalTypeError{Value: src, Type: dst.Type()}
+	}
+	switch src.(type) {
+	case nil, Undefined:
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dst.Type()) {
+		dst.Set(sv)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assign(dst.Elem(), src, depth+1)
+	case reflect.Bool:
+		if b, ok := src.(bool); ok {
+			dst.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := number(src); ok && !dst.OverflowInt(int64(n)) {
+			dst.SetInt(int64(n))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n, ok := number(src); ok && n >= 0 && !dst.OverflowUint(uint64(n)) {
+			dst.SetUint(uint64(n))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, ok := number(src); ok {
+			dst.SetFloat(n)
+			return nil
+		}
+	case reflect.String:
+		if sv.Kind() == reflect.String {
+			dst.SetString(sv.String())
+			return nil
+		}
+	case reflect.Struct:
+		if props, ok := properties(src); ok {
+			for _, f := range cachedFields(dst.Type()) {
+				v, ok := props[f.name]
+				if !ok {
+					continue
+				}
+				fv, ok := fieldByIndexAlloc(dst, f.index)
+				if !ok {
+					continue
+				}
+				if err := assign(fv, v, depth+1); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		props, ok := properties(src)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), len(props))
+		for k, v := range props {
+			ev := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(ev, v, depth+1); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), ev)
+		}
+		dst.Set(m)
+		return nil
+	case reflect.Slice, reflect.Array:
+		items, ok := items(src)
+		if !ok {
+			break
+		}
+		n := items.Len()
+		if dst.Kind() == reflect.Slice {
+			dst.Set(reflect.MakeSlice(dst.Type(), n, n))
+		} else if n > dst.Len() {
+			n = dst.Len()
+		}
+		for i := 0; i < n; i++ {
+			if err := assign(dst.Index(i), items.Index(i).Interface(), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return &UnmarshalTypeError{Value: src, Type: dst.Type()}
+}
+
+func number(src interface{}) (float64, bool) {
+	switch n := src.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func properties(src interface{}) (map[string]interface{}, bool) {
+	switch v := src.(type) {
+	case map[string]interface{}:
+		return v, true
+	case ECMAArray:
+		return v, true
+	case *TypedObject:
+		return v.Properties, true
+	}
+	return nil, false
+}
+
+// items returns the elements of a decoded array, vector or externalizable
+// collection.
+func items(src interface{}) (reflect.Value, bool) {
+	if v, ok := src.(*VectorObject); ok {
+		return reflect.ValueOf(v.Items), true
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Kind() == reflect.Ptr && !sv.IsNil() {
+		sv = sv.Elem()
+	}
+	if sv.Kind() != reflect.Slice {
+		return reflect.Value{}, false
+	}
+	return sv, true
+}
@@ -0,0 +1,68 @@
+package rtmp
+
+import (
+	"github.com/hori-ryota/go-rtmp/rtmp/amf"
+	"github.com/pkg/errors"
+)
+
+// The body of an AMF3 command (17), data (15) or shared object (16) message
+// is a format byte of 0x00 followed by the same AMF0 encoding as an AMF0
+// message. Values in it switch to AMF3 with the AMF0 avmplus-object marker.
+const amf3FormatSelector = 0x00
+
+// amf0StringMarker leads an AMF0 command, whose name is a string.
+const amf0StringMarker = 0x02
+
+// AMF0Payload returns the AMF0 body of a command or data message, without
+// the format byte of the AMF3 message types.
+func AMF0Payload(m Message) ([]byte, error) {
+	b := m.Payload()
+	switch m.TypeID() {
+	case MessageTypeIDCommandAMF0, MessageTypeIDDataAMF0:
+		return b, nil
+	case MessageTypeIDCommandAMF3, MessageTypeIDDataAMF3:
+		return stripFormatSelector(b)
+	}
+	return nil, errors.Errorf("not a command or data message: %s", m.TypeID())
+}
+
+// stripFormatSelector returns the AMF0 body of an AMF3 message type, shared
+// object messages included.
+func stripFormatSelector(b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errors.New("empty AMF3 message")
+	}
+	switch b[0] {
+	case amf3FormatSelector:
+		return b[1:], nil
+	case amf0StringMarker:
+		// some encoders leave out the format byte
+		return b, nil
+	}
+	return nil, errors.Errorf("unknown AMF3 format byte: 0x%02x", b[0])
+}
+
+// FrameCommand returns the message type and payload for an AMF0 encoded
+// command under the negotiated object encoding.
+func FrameCommand(encodingAMFType EncodingAMFType, b []byte) (MessageTypeID, []byte) {
+	if encodingAMFType != EncodingAMFTypeAMF3 {
+		return MessageTypeIDCommandAMF0, b
+	}
+	return MessageTypeIDCommandAMF3, append([]byte{amf3FormatSelector}, b...)
+}
+
+// FrameData is FrameCommand for data messages such as onMetaData.
+func FrameData(encodingAMFType EncodingAMFType, b []byte) (MessageTypeID, []byte) {
+	if encodingAMFType != EncodingAMFTypeAMF3 {
+		return MessageTypeIDDataAMF0, b
+	}
+	return MessageTypeIDDataAMF3, append([]byte{amf3FormatSelector}, b...)
+}
+
+// amfVersion returns the version of package amf the encoding stands for.
+func (t EncodingAMFType) amfVersion() amf.Version {
+	if t == EncodingAMFTypeAMF3 {
+		return amf.AMF3
+	}
+	return amf.AMF0
+}
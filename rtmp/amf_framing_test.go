@@ -0,0 +1,107 @@
+package rtmp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAMF0Payload(t *testing.T) {
+	body := []byte{0x02, 0x00, 0x04, 'p', 'l', 'a', 'y'}
+	testCases := []struct {
+		name    string
+		typeID  MessageTypeID
+		payload []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"AMF0 command", MessageTypeIDCommandAMF0, body, body, false},
+		{"AMF3 command", MessageTypeIDCommandAMF3, append([]byte{0x00}, body...), body, false},
+		{"AMF3 command without format byte", MessageTypeIDCommandAMF3, body, body, false},
+		{"AMF3 data", MessageTypeIDDataAMF3, append([]byte{0x00}, body...), body, false},
+		{"unknown format byte", MessageTypeIDCommandAMF3, append([]byte{0x11}, body...), nil, true},
+		{"empty", MessageTypeIDDataAMF3, nil, nil, true},
+		{"audio", MessageTypeIDAudio, body, nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := AMF0Payload(NewMessage(3, tc.typeID, 0, 0, tc.payload))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestFrameCommand(t *testing.T) {
+	body := []byte{0x02, 0x00, 0x01, 'a'}
+
+	typeID, b := FrameCommand(EncodingAMFTypeAMF0, body)
+	assert.Equal(t, MessageTypeIDCommandAMF0, typeID)
+	assert.Equal(t, body, b)
+
+	typeID, b = FrameCommand(EncodingAMFTypeAMF3, body)
+	assert.Equal(t, MessageTypeIDCommandAMF3, typeID)
+	assert.Equal(t, append([]byte{0x00}, body...), b)
+
+	typeID, b = FrameData(EncodingAMFTypeAMF3, body)
+	assert.Equal(t, MessageTypeIDDataAMF3, typeID)
+	got, err := AMF0Payload(NewMessage(3, typeID, 0, 0, b))
+	assert.NoError(t, err)
+	assert.Equal(t, body, got)
+}
+
+func TestControlMessageHandlerAMF3Command(t *testing.T) {
+	b, err := NewConnect(map[string]interface{}{
+		"app":            "live",
+		"objectEncoding": float64(3),
+	}, nil, EncodingAMFTypeAMF0).MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	typeID, b := FrameCommand(EncodingAMFTypeAMF3, b)
+
+	var got Connect
+	h := &ControlMessageHandler{
+		NetConnectionCommandHandler: NetConnectionCommandHandler{
+			ConnectHandlers: []ConnectHandler{
+				ConnectHandlerFunc(func(ctx context.Context, connect Connect) ConnError {
+					got = connect
+					return nil
+				}),
+			},
+		},
+	}
+	assert.Nil(t, h.HandleMessage(context.Background(), NewMessage(3, typeID, 0, 0, b)))
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "live", got.CommandObject()["app"])
+		assert.Equal(t, float64(3), got.CommandObject()["objectEncoding"])
+	}
+}
+
+func TestCommandBinary(t *testing.T) {
+	b, err := NewPlay("room", 0, 0, false, EncodingAMFTypeAMF0).MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	play, err := UnmarshalPlayBinary(b, EncodingAMFTypeAMF0)
+	assert.NoError(t, err)
+	assert.Equal(t, "room", play.StreamName())
+	_, err = UnmarshalPlayBinary(b[:len(b)-1], EncodingAMFTypeAMF0)
+	assert.Error(t, err)
+
+	// a call may answer with any value; only objects are kept
+	b, err = NewCallResponse("_result", 3, nil, nil, EncodingAMFTypeAMF0).MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	b = append(b[:len(b)-1], 0x02, 0x00, 0x02, 'o', 'k')
+	response, err := UnmarshalCallResponseBinary(b, EncodingAMFTypeAMF0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(3), response.TransactionID())
+	assert.Nil(t, response.Response())
+}
@@ -0,0 +1,35 @@
+package rtmp
+
+import (
+	"github.com/hori-ryota/go-rtmp/rtmp/amf"
+	"github.com/pkg/errors"
+)
+
+// The command messages decode objects to maps. marshalObject and
+// unmarshalObject convert between those maps and structs tagged for package
+// amf.
+
+func marshalObject(v interface{}) (map[string]interface{}, error) {
+	b, err := amf.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal object")
+	}
+	var o map[string]interface{}
+	if err := amf.Unmarshal(b, &o); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal object")
+	}
+	return o, nil
+}
+
+// unmarshalObject stores the properties of o in the fields of the struct
+// v points to. A property of the wrong type is an *amf.UnmarshalTypeError.
+func unmarshalObject(o map[string]interface{}, v interface{}) error {
+	b, err := amf.Marshal(o)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal object")
+	}
+	if err := amf.Unmarshal(b, v); err != nil {
+		return errors.Wrap(err, "failed to unmarshal object")
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hori-ryota/go-rtmp/rtmp"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Authenticator verifies the tokens of connects, publishes and plays.
+// It is a rtmp.StreamHandler; pass it to rtmp.WithStreamHandler to guard
+// every connection or register it on the routes of a rtmp.StreamMux.
+type Authenticator struct {
+	tokenParam     string
+	requireConnect bool
+	replay         bool
+	now            func() time.Time
+
+	mu   sync.RWMutex
+	keys []Key
+
+	nonces *nonceCache
+}
+
+type Option func(*Authenticator)
+
+// WithTokenParam changes the query parameter holding the token from
+// "token".
+func WithTokenParam(name string) Option {
+	return func(a *Authenticator) {
+		a.tokenParam = name
+	}
+}
+
+// WithRequireConnectToken rejects connects without a valid token. By
+// default a connect without a token is accepted and its publishes and
+// plays must carry one.
+func WithRequireConnectToken() Option {
+	return func(a *Authenticator) {
+		a.requireConnect = true
+	}
+}
+
+// WithReplayProtection accepts a token with a nonce only once until it
+// expires. Tokens without a nonce are rejected.
+func WithReplayProtection() Option {
+	return func(a *Authenticator) {
+		a.replay = true
+	}
+}
+
+// WithClock replaces time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(a *Authenticator) {
+		a.now = now
+	}
+}
+
+// New returns an Authenticator signing with the first of keys and
+// verifying with all of them.
+func New(keys []Key, opts ...Option) *Authenticator {
+	a := &Authenticator{
+		tokenParam: "token",
+		now:        time.Now,
+		keys:       keys,
+	}
+	for _, o := range opts {
+		o(a)
+	}
+	a.nonces = newNonceCache(a.now)
+	return a
+}
+
+// SetKeys rotates the keys. Keep the previous key after the new first one
+// until the tokens it signed expire.
+func (a *Authenticator) SetKeys(keys []Key) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keys = keys
+}
+
+// Sign returns a token for c signed with the first key.
+func (a *Authenticator) Sign(c Claims) (string, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if len(a.keys) == 0 {
+		return "", errors.New("no key to sign with")
+	}
+	return sign(a.keys[0], c)
+}
+
+// Verify checks token for action on the stream path from ip. An empty
+// action or stream skips their check, and a nil ip skips the IP check.
+func (a *Authenticator) Verify(token string, action Action, stream string, ip net.IP) (Claims, error) {
+	c, err := a.verify(token, action, stream, ip)
+	if err != nil {
+		return c, err
+	}
+	if err := a.consume(c, nil); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func (a *Authenticator) verify(token string, action Action, stream string, ip net.IP) (Claims, error) {
+	if token == "" {
+		return Claims{}, ErrNoToken
+	}
+	a.mu.RLock()
+	c, err := parse(a.keys, token)
+	a.mu.RUnlock()
+	if err != nil {
+		return c, err
+	}
+	if !a.now().Before(c.Expires) {
+		return c, ErrExpired
+	}
+	if !c.AllowsAction(action) {
+		return c, ErrActionNotAllowed
+	}
+	if stream != "" && !c.AllowsStream(stream) {
+		return c, ErrStreamNotAllowed
+	}
+	if c.IP != "" && ip != nil && !ip.Equal(net.ParseIP(c.IP)) {
+		return c, ErrIPNotAllowed
+	}
+	return c, nil
+}
+
+// consume spends the nonce of c. The nonce may be spent again by a non-nil
+// owner which spent it first.
+func (a *Authenticator) consume(c Claims, owner interface{}) error {
+	if !a.replay {
+		return nil
+	}
+	if c.Nonce == "" {
+		return ErrMalformedToken
+	}
+	if !a.nonces.add(c.KeyID+"/"+c.Nonce, c.Expires, owner) {
+		return ErrReplayed
+	}
+	return nil
+}
+
+func (a *Authenticator) ServeConnect(ctx context.Context, conn rtmp.Conn, connect rtmp.Connect) rtmp.ConnectError {
+	token := conn.ConnectParams().Query.Get(a.tokenParam)
+	if token == "" && !a.requireConnect {
+		return nil
+	}
+	// the stream is checked again on publish and play
+	if err := a.verifyConnect(conn, "", ""); err != nil {
+		a.log(conn, "connect", err)
+		return rtmp.NewConnectError(nil, rtmp.NewStatus(rtmp.StatusCodeNetConnectionConnectRejected).
+			WithDescription("authentication failed").
+			InfoObject(), rtmp.EncodingAMFTypeAMF0)
+	}
+	return nil
+}
+
+func (a *Authenticator) ServePublish(ctx context.Context, conn rtmp.Conn, publish rtmp.Publish) map[string]interface{} {
+	name := publish.PublishingName()
+	if err := a.verifyStream(conn, ActionPublish, name); err != nil {
+		a.log(conn, "publish", err, zap.String("name", name))
+		return rtmp.NewStatus(rtmp.StatusCodeNetStreamPublishBadName).
+			WithDescription("authentication failed").
+			WithDetails(name).
+			InfoObject()
+	}
+	return nil
+}
+
+func (a *Authenticator) ServePlay(ctx context.Context, conn rtmp.Conn, play rtmp.Play) map[string]interface{} {
+	name := play.StreamName()
+	if err := a.verifyStream(conn, ActionPlay, name); err != nil {
+		a.log(conn, "play", err, zap.String("name", name))
+		return rtmp.NewStatus(rtmp.StatusCodeNetStreamPlayFailed).
+			WithDescription("authentication failed").
+			WithDetails(name).
+			InfoObject()
+	}
+	return nil
+}
+
+// verifyStream verifies the token of the stream name, or else the token of
+// connect.
+func (a *Authenticator) verifyStream(conn rtmp.Conn, action Action, name string) error {
+	path := rtmp.StreamPath(conn.ConnectParams().App, name)
+	var query url.Values
+	if i := strings.IndexByte(name, '?'); i >= 0 {
+		query, _ = url.ParseQuery(name[i+1:])
+	}
+	if token := query.Get(a.tokenParam); token != "" {
+		_, err := a.Verify(token, action, path, remoteIP(conn))
+		return err
+	}
+	return a.verifyConnect(conn, action, path)
+}
+
+// verifyConnect verifies the token of connect and spends its nonce for
+// conn, so conn may use it for all its streams but no other conn can
+// replay it, whether or not the connect itself was checked.
+func (a *Authenticator) verifyConnect(conn rtmp.Conn, action Action, stream string) error {
+	c, err := a.verify(conn.ConnectParams().Query.Get(a.tokenParam), action, stream, remoteIP(conn))
+	if err != nil {
+		return err
+	}
+	return a.consume(c, conn)
+}
+
+func (a *Authenticator) log(conn rtmp.Conn, action string, err error, fields ...zap.Field) {
+	conn.Logger().Info(
+		"authentication failed",
+		append(fields, zap.String("action", action), zap.Error(err), zap.Stringer("remoteAddr", conn.RemoteAddr()))...,
+	)
+}
+
+func remoteIP(conn rtmp.Conn) net.IP {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case nil:
+		return nil
+	default:
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return nil
+		}
+		return net.ParseIP(host)
+	}
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/hori-ryota/go-rtmp/rtmp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a := New([]Key{{ID: "k1", Secret: []byte("secret1")}}, WithClock(func() time.Time { return now }))
+
+	token, err := a.Sign(Claims{
+		Expires: now.Add(time.Minute),
+		Stream:  "live/*",
+		Action:  ActionPublish,
+		IP:      "192.0.2.1",
+	})
+	assert.NoError(t, err)
+
+	c, err := a.Verify(token, ActionPublish, "live/room", net.ParseIP("192.0.2.1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "k1", c.KeyID)
+	assert.Equal(t, now.Add(time.Minute), c.Expires)
+
+	for _, tt := range []struct {
+		name   string
+		token  string
+		action Action
+		stream string
+		ip     string
+		err    error
+	}{
+		{"no token", "", ActionPublish, "live/room", "192.0.2.1", ErrNoToken},
+		{"malformed", "abc", ActionPublish, "live/room", "192.0.2.1", ErrMalformedToken},
+		{"tampered", token[:len(token)-2] + "AA", ActionPublish, "live/room", "192.0.2.1", ErrBadSignature},
+		{"action", token, ActionPlay, "live/room", "192.0.2.1", ErrActionNotAllowed},
+		{"stream", token, ActionPublish, "vod/room", "192.0.2.1", ErrStreamNotAllowed},
+		{"ip", token, ActionPublish, "live/room", "192.0.2.2", ErrIPNotAllowed},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Verify(tt.token, tt.action, tt.stream, net.ParseIP(tt.ip))
+			assert.Equal(t, tt.err, err)
+		})
+	}
+
+	now = now.Add(time.Minute)
+	_, err = a.Verify(token, ActionPublish, "live/room", nil)
+	assert.Equal(t, ErrExpired, err)
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := Key{ID: "old", Secret: []byte("old secret")}
+	a := New([]Key{old})
+	oldToken, err := a.Sign(Claims{Expires: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+
+	a.SetKeys([]Key{{ID: "new", Secret: []byte("new secret")}, old})
+	newToken, err := a.Sign(Claims{Expires: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	for _, token := range []string{oldToken, newToken} {
+		_, err := a.Verify(token, "", "", nil)
+		assert.NoError(t, err)
+	}
+
+	a.SetKeys([]Key{{ID: "new", Secret: []byte("new secret")}})
+	_, err = a.Verify(oldToken, "", "", nil)
+	assert.Equal(t, ErrUnknownKey, err)
+}
+
+func TestReplayProtection(t *testing.T) {
+	a := New([]Key{{ID: "k", Secret: []byte("s")}}, WithReplayProtection())
+	token, _ := a.Sign(Claims{Expires: time.Now().Add(time.Hour), Nonce: "n1"})
+	_, err := a.Verify(token, "", "", nil)
+	assert.NoError(t, err)
+	_, err = a.Verify(token, "", "", nil)
+	assert.Equal(t, ErrReplayed, err)
+
+	token, _ = a.Sign(Claims{Expires: time.Now().Add(time.Hour)})
+	_, err = a.Verify(token, "", "", nil)
+	assert.Equal(t, ErrMalformedToken, err)
+}
+
+type testConn struct {
+	rtmp.Conn
+	params rtmp.ConnectParams
+}
+
+func (c *testConn) ConnectParams() rtmp.ConnectParams {
+	return c.params
+}
+
+func (c *testConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 50000}
+}
+
+func (c *testConn) Logger() *zap.Logger {
+	return zap.NewNop()
+}
+
+func TestAuthenticatorStreamHandler(t *testing.T) {
+	a := New([]Key{{ID: "k", Secret: []byte("s")}})
+	ctx := context.Background()
+	publishToken, _ := a.Sign(Claims{Expires: time.Now().Add(time.Hour), Stream: "live/room", Action: ActionPublish})
+	connectToken, _ := a.Sign(Claims{Expires: time.Now().Add(time.Hour), Stream: "live/*", Action: ActionPlay, IP: "192.0.2.1"})
+
+	conn := &testConn{params: rtmp.ConnectParams{App: "live"}}
+	assert.Nil(t, a.ServeConnect(ctx, conn, nil))
+	assert.Nil(t, a.ServePublish(ctx, conn, rtmp.NewPublish("room?token="+publishToken, rtmp.PublishingTypeLive, rtmp.EncodingAMFTypeAMF0)))
+	assert.Equal(t, "NetStream.Publish.BadName",
+		a.ServePublish(ctx, conn, rtmp.NewPublish("other?token="+publishToken, rtmp.PublishingTypeLive, rtmp.EncodingAMFTypeAMF0))["code"])
+	assert.Equal(t, "NetStream.Play.Failed",
+		a.ServePlay(ctx, conn, rtmp.NewPlay("room", 0, 0, false, rtmp.EncodingAMFTypeAMF0))["code"])
+
+	conn = &testConn{params: rtmp.ConnectParams{App: "live", Query: url.Values{"token": {connectToken}}}}
+	assert.Nil(t, a.ServeConnect(ctx, conn, nil))
+	assert.Nil(t, a.ServePlay(ctx, conn, rtmp.NewPlay("room", 0, 0, false, rtmp.EncodingAMFTypeAMF0)))
+	assert.NotNil(t, a.ServePublish(ctx, conn, rtmp.NewPublish("room", rtmp.PublishingTypeLive, rtmp.EncodingAMFTypeAMF0)))
+
+	conn = &testConn{params: rtmp.ConnectParams{App: "live", Query: url.Values{"token": {"bad"}}}}
+	if connectError := a.ServeConnect(ctx, conn, nil); assert.NotNil(t, connectError) {
+		assert.Equal(t, "NetConnection.Connect.Rejected", connectError.Information()["code"])
+	}
+}
+
+func TestAuthenticatorStreamMux(t *testing.T) {
+	a := New([]Key{{ID: "k", Secret: []byte("s")}}, WithRequireConnectToken(), WithReplayProtection())
+	mux := rtmp.NewStreamMux()
+	mux.Handle("live/*", a)
+	ctx := context.Background()
+	token, _ := a.Sign(Claims{Expires: time.Now().Add(time.Hour), Stream: "live/*", Nonce: "n1"})
+
+	if connectError := mux.ServeConnect(ctx, &testConn{params: rtmp.ConnectParams{App: "live"}}, nil); assert.NotNil(t, connectError) {
+		assert.Equal(t, "NetConnection.Connect.Rejected", connectError.Information()["code"])
+	}
+
+	conn := &testConn{params: rtmp.ConnectParams{App: "live", Query: url.Values{"token": {token}}}}
+	assert.Nil(t, mux.ServeConnect(ctx, conn, nil))
+	assert.Nil(t, mux.ServePublish(ctx, conn, rtmp.NewPublish("room", rtmp.PublishingTypeLive, rtmp.EncodingAMFTypeAMF0)))
+	assert.Nil(t, mux.ServePlay(ctx, conn, rtmp.NewPlay("other", 0, 0, false, rtmp.EncodingAMFTypeAMF0)))
+
+	other := &testConn{params: rtmp.ConnectParams{App: "live", Query: url.Values{"token": {token}}}}
+	assert.NotNil(t, mux.ServeConnect(ctx, other, nil))
+	assert.NotNil(t, mux.ServePlay(ctx, other, rtmp.NewPlay("room", 0, 0, false, rtmp.EncodingAMFTypeAMF0)))
+}
+
+func TestAuthenticatorConnectTokenSpentOnStream(t *testing.T) {
+	// the connect token of a conn whose connect was not checked is spent by
+	// its first publish or play
+	a := New([]Key{{ID: "k", Secret: []byte("s")}}, WithReplayProtection())
+	ctx := context.Background()
+	token, _ := a.Sign(Claims{Expires: time.Now().Add(time.Hour), Stream: "live/*", Nonce: "n2"})
+
+	conn := &testConn{params: rtmp.ConnectParams{App: "live", Query: url.Values{"token": {token}}}}
+	assert.Nil(t, a.ServePlay(ctx, conn, rtmp.NewPlay("room", 0, 0, false, rtmp.EncodingAMFTypeAMF0)))
+	assert.Nil(t, a.ServePlay(ctx, conn, rtmp.NewPlay("room", 0, 0, false, rtmp.EncodingAMFTypeAMF0)))
+	other := &testConn{params: rtmp.ConnectParams{App: "live", Query: url.Values{"token": {token}}}}
+	assert.NotNil(t, a.ServePlay(ctx, other, rtmp.NewPlay("room", 0, 0, false, rtmp.EncodingAMFTypeAMF0)))
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// nonceCache remembers used nonces until their tokens expire.
+type nonceCache struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	nonces  map[string]nonce
+	pruneAt time.Time
+}
+
+type nonce struct {
+	expires time.Time
+	// owner may use the nonce again, e.g. the conn whose connect spent it.
+	owner interface{}
+}
+
+func newNonceCache(now func() time.Time) *nonceCache {
+	return &nonceCache{
+		now:    now,
+		nonces: map[string]nonce{},
+	}
+}
+
+// add reports false if nonce is already used, unless by owner. A nil
+// owner never matches.
+func (c *nonceCache) add(key string, expires time.Time, owner interface{}) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if now.After(c.pruneAt) {
+		for k, n := range c.nonces {
+			if !now.Before(n.expires) {
+				delete(c.nonces, k)
+			}
+		}
+		c.pruneAt = now.Add(time.Minute)
+	}
+	if n, ok := c.nonces[key]; ok && now.Before(n.expires) {
+		return owner != nil && n.owner == owner
+	}
+	c.nonces[key] = nonce{expires: expires, owner: owner}
+	return true
+}
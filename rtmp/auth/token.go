@@ -0,0 +1,135 @@
+// Package auth authenticates connects, publishes and plays with HMAC signed
+// tokens.
+//
+// A token is passed as the token query parameter of tcUrl or app, e.g.
+// rtmp://example.com/live?token=..., or of the stream name, e.g. publishing
+// "room?token=...". A token in the stream name takes precedence over the
+// one of connect.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Action string
+
+const (
+	ActionPublish Action = "publish"
+	ActionPlay    Action = "play"
+)
+
+// Claims are the grants of a token.
+type Claims struct {
+	// KeyID is the ID of the key that signed the token.
+	KeyID   string    `json:"kid,omitempty"`
+	Expires time.Time `json:"-"`
+	// Stream is the stream path, e.g. "live/room", the token is valid for.
+	// A trailing "*" allows every stream with the prefix, e.g. "live/*".
+	// Empty allows every stream.
+	Stream string `json:"stream,omitempty"`
+	// Action limits the token to publish or play. Empty allows both.
+	Action Action `json:"action,omitempty"`
+	// IP is the client address the token is valid for. Empty allows every
+	// address.
+	IP string `json:"ip,omitempty"`
+	// Nonce makes the token single use while replay protection is enabled.
+	Nonce string `json:"nonce,omitempty"`
+}
+
+type claimsJSON struct {
+	Claims
+	Exp int64 `json:"exp"`
+}
+
+func (c Claims) AllowsStream(path string) bool {
+	if c.Stream == "" || c.Stream == path {
+		return true
+	}
+	if strings.HasSuffix(c.Stream, "*") {
+		return strings.HasPrefix(path, strings.TrimSuffix(c.Stream, "*"))
+	}
+	return false
+}
+
+func (c Claims) AllowsAction(action Action) bool {
+	return c.Action == "" || action == "" || c.Action == action
+}
+
+// Key is a secret signing tokens. Keys are told apart by ID so secrets can
+// be rotated without invalidating the tokens already handed out.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+var (
+	ErrNoToken          = errors.New("no token")
+	ErrMalformedToken   = errors.New("malformed token")
+	ErrUnknownKey       = errors.New("unknown key")
+	ErrBadSignature     = errors.New("bad signature")
+	ErrExpired          = errors.New("token expired")
+	ErrStreamNotAllowed = errors.New("stream not allowed")
+	ErrActionNotAllowed = errors.New("action not allowed")
+	ErrIPNotAllowed     = errors.New("ip not allowed")
+	ErrReplayed         = errors.New("token already used")
+)
+
+var encoding = base64.RawURLEncoding
+
+func sign(key Key, c Claims) (string, error) {
+	if c.Expires.IsZero() {
+		return "", errors.New("token without expiry")
+	}
+	c.KeyID = key.ID
+	payload, err := json.Marshal(claimsJSON{Claims: c, Exp: c.Expires.Unix()})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal claims")
+	}
+	p := encoding.EncodeToString(payload)
+	return p + "." + encoding.EncodeToString(mac(key.Secret, p)), nil
+}
+
+// parse checks the signature of token with the key it names among keys.
+func parse(keys []Key, token string) (Claims, error) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return Claims{}, ErrMalformedToken
+	}
+	p, s := token[:i], token[i+1:]
+	payload, err := encoding.DecodeString(p)
+	if err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+	sig, err := encoding.DecodeString(s)
+	if err != nil {
+		return Claims{}, ErrMalformedToken
+	}
+	var c claimsJSON
+	if err := json.Unmarshal(payload, &c); err != nil || c.Exp == 0 {
+		return Claims{}, ErrMalformedToken
+	}
+	for _, key := range keys {
+		if key.ID != c.KeyID {
+			continue
+		}
+		if !hmac.Equal(sig, mac(key.Secret, p)) {
+			return Claims{}, ErrBadSignature
+		}
+		c.Claims.Expires = time.Unix(c.Exp, 0)
+		return c.Claims, nil
+	}
+	return Claims{}, ErrUnknownKey
+}
+
+func mac(secret []byte, payload string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
@@ -0,0 +1,58 @@
+package rtmp
+
+import (
+	"math/bits"
+	"sync"
+)
+
+const (
+	minPooledBufferSizeShift = 7  // 128B
+	maxPooledBufferSizeShift = 20 // 1MiB
+
+	maxPooledBufferSize = 1 << maxPooledBufferSizeShift
+)
+
+// bufferPool pools byte slices in power-of-two size classes. Buffers larger
+// than maxPooledBufferSize are allocated on demand and never retained, so a
+// single oversized message does not pin its memory after it is released.
+type bufferPool struct {
+	pools [maxPooledBufferSizeShift - minPooledBufferSizeShift + 1]sync.Pool
+}
+
+var defaultBufferPool = newBufferPool()
+
+func newBufferPool() *bufferPool {
+	p := &bufferPool{}
+	for i := range p.pools {
+		size := 1 << uint(i+minPooledBufferSizeShift)
+		p.pools[i].New = func() interface{} {
+			b := make([]byte, size)
+			return &b
+		}
+	}
+	return p
+}
+
+func (p *bufferPool) Get(size uint32) []byte {
+	if size > maxPooledBufferSize {
+		return make([]byte, size)
+	}
+	b := p.pools[sizeClass(size)].Get().(*[]byte)
+	return (*b)[:size]
+}
+
+func (p *bufferPool) Put(b []byte) {
+	c := cap(b)
+	if c == 0 || c > maxPooledBufferSize || c&(c-1) != 0 || c < 1<<minPooledBufferSizeShift {
+		return
+	}
+	b = b[:c]
+	p.pools[sizeClass(uint32(c))].Put(&b)
+}
+
+func sizeClass(size uint32) int {
+	if size <= 1<<minPooledBufferSizeShift {
+		return 0
+	}
+	return bits.Len32(size-1) - minPooledBufferSizeShift
+}
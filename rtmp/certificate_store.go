@@ -0,0 +1,111 @@
+package rtmp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CertificateStore holds certificates loaded from files and selects one by
+// SNI. Reload reads the files again, so certificates can be renewed without
+// restarting the server.
+type CertificateStore struct {
+	mu     sync.RWMutex
+	files  []certificateFiles
+	certs  []*tls.Certificate
+	byName map[string]*tls.Certificate
+}
+
+type certificateFiles struct {
+	certFile string
+	keyFile  string
+}
+
+func NewCertificateStore() *CertificateStore {
+	return &CertificateStore{
+		byName: map[string]*tls.Certificate{},
+	}
+}
+
+// Add loads a certificate and its key. The first certificate added is used
+// when no certificate matches the requested server name. Adding a pair
+// already added does nothing.
+func (s *CertificateStore) Add(certFile, keyFile string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := certificateFiles{certFile: certFile, keyFile: keyFile}
+	for _, added := range s.files {
+		if added == f {
+			return nil
+		}
+	}
+	files := append(s.files[:len(s.files):len(s.files)], f)
+	if err := s.load(files); err != nil {
+		return err
+	}
+	s.files = files
+	return nil
+}
+
+// Reload reads all certificate files again. The current certificates are
+// kept if any of them fails to load.
+func (s *CertificateStore) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(s.files)
+}
+
+func (s *CertificateStore) load(files []certificateFiles) error {
+	certs := make([]*tls.Certificate, 0, len(files))
+	byName := map[string]*tls.Certificate{}
+	for _, f := range files {
+		cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load certificate %s", f.certFile)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse certificate %s", f.certFile)
+		}
+		cert.Leaf = leaf
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, ok := byName[name]; !ok {
+				byName[name] = &cert
+			}
+		}
+		certs = append(certs, &cert)
+	}
+	s.certs = certs
+	s.byName = byName
+	return nil
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate. It matches the
+// server name exactly first, then against wildcard certificates.
+func (s *CertificateStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.certs) == 0 {
+		return nil, errors.New("no certificates")
+	}
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if name != "" {
+		if cert, ok := s.byName[name]; ok {
+			return cert, nil
+		}
+		if i := strings.Index(name, "."); i > 0 {
+			if cert, ok := s.byName["*"+name[i:]]; ok {
+				return cert, nil
+			}
+		}
+	}
+	return s.certs[0], nil
+}
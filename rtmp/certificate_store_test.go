@@ -0,0 +1,155 @@
+package rtmp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func writeTestCertificate(t *testing.T, dir string, name string, dnsNames ...string) (certFile, keyFile string, cert *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsNames[0]},
+		DNSNames:     dnsNames,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile, cert
+}
+
+func TestCertificateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defaultCertFile, defaultKeyFile, _ := writeTestCertificate(t, dir, "default", "default.example.com")
+	wildcardCertFile, wildcardKeyFile, _ := writeTestCertificate(t, dir, "wildcard", "*.live.example.com")
+
+	s := NewCertificateStore()
+	assert.NoError(t, s.Add(defaultCertFile, defaultKeyFile))
+	assert.NoError(t, s.Add(wildcardCertFile, wildcardKeyFile))
+	assert.NoError(t, s.Add(defaultCertFile, defaultKeyFile))
+	assert.Len(t, s.files, 2)
+
+	get := func(serverName string) string {
+		cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: serverName})
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		return cert.Leaf.Subject.CommonName
+	}
+	assert.Equal(t, "default.example.com", get("default.example.com"))
+	assert.Equal(t, "*.live.example.com", get("a.live.example.com"))
+	assert.Equal(t, "default.example.com", get("unknown.example.com"))
+	assert.Equal(t, "default.example.com", get(""))
+
+	t.Run("reload", func(t *testing.T) {
+		_, _, renewed := writeTestCertificate(t, dir, "default", "default.example.com")
+		assert.NoError(t, s.Reload())
+		cert, err := s.GetCertificate(&tls.ClientHelloInfo{ServerName: "default.example.com"})
+		if assert.NoError(t, err) {
+			assert.Equal(t, renewed.SerialNumber, cert.Leaf.SerialNumber)
+		}
+	})
+
+	t.Run("reload failure keeps certificates", func(t *testing.T) {
+		assert.NoError(t, os.Remove(wildcardKeyFile))
+		assert.Error(t, s.Reload())
+		assert.Equal(t, "*.live.example.com", get("a.live.example.com"))
+	})
+}
+
+func TestClient_Dial_RTMPS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, cert := writeTestCertificate(t, dir, "server", "localhost")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server := NewServer(ctx, zap.NewNop())
+	defer server.Close()
+	var l net.Listener
+	for i := 0; i < 2; i++ {
+		// every ServeTLS call shares the certificate store
+		l, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go server.ServeTLS(l, certFile, keyFile)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := NewClient(ctx, zap.NewNop())
+	defer client.Close()
+	client.TLSConfig = &tls.Config{RootCAs: roots, ServerName: "localhost"}
+
+	conn, err := client.Dial(ctx, "rtmps://"+l.Addr().String()+"/live")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	state, ok := conn.TLSConnectionState()
+	assert.True(t, ok)
+	assert.True(t, state.HandshakeComplete)
+
+	_, err = client.Dial(ctx, "http://"+l.Addr().String())
+	assert.Error(t, err)
+
+	store := server.certificateStore(false)
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	assert.Len(t, store.files, 1)
+}
@@ -12,6 +12,54 @@ type chunkStream struct {
 
 	timestamp uint32
 
+	// extendedTimestamp is the extended timestamp field of the last type 0,
+	// 1 or 2 header, which type 3 chunks that follow repeat; 0 if none.
+	extendedTimestamp uint32
+	// type3ExtendedTimestamp is whether the type 3 chunks of this chunk
+	// stream repeat extendedTimestamp, once known.
+	type3ExtendedTimestamp type3ExtendedTimestamp
+
 	buffer   []byte
 	buffered uint32
 }
+
+const (
+	controlChunkStreamID uint32 = 2
+	commandChunkStreamID uint32 = 3
+
+	// chunk streams per message stream: command/data, audio and video
+	chunkStreamsPerMessageStream = 3
+
+	// maxMessageStreamID is the highest message stream ID whose chunk
+	// streams fit in the 65599 chunk stream IDs of a 3 byte basic header.
+	maxMessageStreamID = (65599-commandChunkStreamID-chunkStreamsPerMessageStream)/chunkStreamsPerMessageStream + 1
+)
+
+// ChunkStreamIDFor returns the chunk stream ID to send a message of typeID
+// on messageStreamID with. Protocol control and user control messages share
+// chunk stream 2 and NetConnection messages chunk stream 3, while every
+// message stream gets chunk streams of its own so that its commands, audio
+// and video do not reset each other's chunk headers.
+func ChunkStreamIDFor(typeID MessageTypeID, messageStreamID uint32) uint32 {
+	switch typeID {
+	case MessageTypeIDSetChunkSize,
+		MessageTypeIDAbortMessage,
+		MessageTypeIDAcknowledgement,
+		MessageTypeIDUserControlMessages,
+		MessageTypeIDWindowAcknowledgementSize,
+		MessageTypeIDSetPeerBandwidth:
+		return controlChunkStreamID
+	}
+	if messageStreamID == 0 {
+		return commandChunkStreamID
+	}
+	base := commandChunkStreamID + 1 + (messageStreamID-1)*chunkStreamsPerMessageStream
+	switch typeID {
+	case MessageTypeIDAudio:
+		return base + 1
+	case MessageTypeIDVideo, MessageTypeIDAggregate:
+		return base + 2
+	default:
+		return base
+	}
+}
@@ -2,9 +2,15 @@ package rtmp
 
 import (
 	"context"
+	"crypto/tls"
 	"io"
 	"net"
+	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/hori-ryota/go-rtmp/rtmp/handshake"
+	"github.com/hori-ryota/go-rtmp/rtmp/rtmpt"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -14,6 +20,14 @@ type Client struct {
 	cancelFunc  context.CancelFunc
 	connOptions []ConnOption
 
+	// TLSConfig is used for rtmps. ServerName defaults to the dialed host.
+	TLSConfig *tls.Config
+	// HTTPClient is used for rtmpt. nil means http.DefaultClient.
+	HTTPClient *http.Client
+	// MaxConnectRedirects is how many connect redirects DialAndConnect
+	// follows. Zero returns the redirect as an error.
+	MaxConnectRedirects int
+
 	logger *zap.Logger
 }
 
@@ -36,7 +50,175 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// Dial connects to the host of an rtmp://, rtmps://, rtmpt:// or rtmpe://
+// URL.
+func (c *Client) Dial(ctx context.Context, rawurl string) (Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", rawurl)
+	}
+	switch u.Scheme {
+	case "rtmp":
+		return c.Connect(ctx, hostPort(u, "1935"))
+	case "rtmps":
+		return c.ConnectTLS(ctx, hostPort(u, "443"))
+	case "rtmpt":
+		nc, err := rtmpt.Dial(ctx, "http://"+hostPort(u, "80"), c.HTTPClient)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to dial %s", rawurl)
+		}
+		return c.serve(ctx, nc), nil
+	case "rtmpe":
+		nc, err := c.dial(ctx, hostPort(u, "1935"))
+		if err != nil {
+			return nil, err
+		}
+		return c.serve(ctx, nc, WithHandshaker(handshake.NewEncryptedHandshaker(false))), nil
+	default:
+		return nil, errors.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+}
+
+// DialAndConnect dials rawurl and connects to its app with rawurl as
+// tcUrl. commandObject adds to or overrides the connect command object.
+// A rejected connect is returned as a *StatusError unless it redirects to
+// another tcUrl and MaxConnectRedirects allows following it.
+func (c *Client) DialAndConnect(ctx context.Context, rawurl string, commandObject map[string]interface{}) (Conn, error) {
+	for redirects := 0; ; redirects++ {
+		conn, err := c.Dial(ctx, rawurl)
+		if err != nil {
+			return nil, err
+		}
+		err = c.connect(ctx, conn, rawurl, commandObject)
+		if err == nil {
+			return conn, nil
+		}
+		conn.Close()
+		if e, ok := errors.Cause(err).(*StatusError); ok {
+			if redirect, ok := e.Status.Redirect(); ok && redirects < c.MaxConnectRedirects {
+				c.logger.Info(
+					"connect redirected",
+					zap.String("tcUrl", rawurl),
+					zap.String("redirect", redirect),
+				)
+				rawurl = redirect
+				continue
+			}
+		}
+		return nil, err
+	}
+}
+
+func (c *Client) connect(ctx context.Context, conn Conn, tcURL string, commandObject map[string]interface{}) error {
+	u, err := url.Parse(tcURL)
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %s", tcURL)
+	}
+	app := strings.TrimPrefix(u.Path, "/")
+	if u.RawQuery != "" {
+		app += "?" + u.RawQuery
+	}
+	o, err := marshalObject(connectCommandObject{
+		App:            app,
+		TcURL:          tcURL,
+		FlashVer:       "LNX 9,0,124,2",
+		Capabilities:   15,
+		AudioCodecs:    uint32(AudioCodecFlagAac),
+		VideoCodecs:    uint32(VideoCodecFlagH264),
+		VideoFunction:  uint32(VideoFunctionFlagClientSeek),
+		ObjectEncoding: EncodingAMFTypeAMF0,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal connect command object")
+	}
+	for k, v := range commandObject {
+		o[k] = v
+	}
+
+	var span Span
+	if d, ok := conn.(*defaultConn); ok {
+		select {
+		case <-d.handshaked.Done():
+		case <-conn.Context().Done():
+			return errors.New("connection closed on handshake")
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if d.tracer != nil {
+			_, span = d.startSpan(d.ctx, SpanNameConnect, SpanAttribute{Key: SpanAttributeTcURL, Value: withoutQuery(tcURL)})
+		}
+	}
+	err = c.requestConnect(ctx, conn, o)
+	if span != nil {
+		span.End(err)
+	}
+	return err
+}
+
+func (c *Client) requestConnect(ctx context.Context, conn Conn, o map[string]interface{}) error {
+	responses := make(chan ConnectResponse, 1)
+	conn.AddConnectCallbacks(func(response ConnectResponse) ConnError {
+		responses <- response
+		return nil
+	})
+	if err := conn.Connect(ctx, o, nil); err != nil {
+		return errors.Wrap(err, "failed to Connect")
+	}
+	select {
+	case response := <-responses:
+		if e, ok := response.(interface{ CommandName() string }); ok && e.CommandName() == "_error" {
+			status, err := ParseStatus(response.(ConnectError).Information())
+			if err != nil {
+				return errors.Wrap(err, "failed to read connect error")
+			}
+			return &StatusError{Status: status}
+		}
+		return nil
+	case <-conn.Context().Done():
+		return errors.New("connection closed before the connect response")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (c *Client) Connect(ctx context.Context, addr string) (Conn, error) {
+	nc, err := c.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	return c.serve(ctx, nc), nil
+}
+
+func (c *Client) ConnectTLS(ctx context.Context, addr string) (Conn, error) {
+	if dd, ok := c.ctx.Deadline(); ok {
+		var cancel func()
+		ctx, cancel = context.WithDeadline(ctx, dd)
+		defer cancel()
+	}
+	nc, err := c.dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{}
+	if c.TLSConfig != nil {
+		config = c.TLSConfig.Clone()
+	}
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			host = addr
+		}
+		config.ServerName = host
+	}
+	tc := tls.Client(nc, config)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		nc.Close()
+		return nil, errors.Wrapf(err, "failed to TLS handshake with %s", addr)
+	}
+	return c.serve(ctx, tc), nil
+}
+
+func (c *Client) dial(ctx context.Context, addr string) (net.Conn, error) {
 	if dd, ok := c.ctx.Deadline(); ok {
 		var cancel func()
 		ctx, cancel = context.WithDeadline(ctx, dd)
@@ -50,13 +232,16 @@ func (c *Client) Connect(ctx context.Context, addr string) (Conn, error) {
 	if nc == nil {
 		return nil, errors.New("conn is nil")
 	}
+	return nc, nil
+}
 
+func (c *Client) serve(ctx context.Context, nc net.Conn, connOps ...ConnOption) Conn {
 	conn := NewDefaultConn(
 		c.ctx,
 		nc,
 		false,
 		c.logger,
-		c.connOptions...,
+		append(c.connOptions[:len(c.connOptions):len(c.connOptions)], connOps...)...,
 	)
 
 	go func() {
@@ -90,5 +275,12 @@ func (c *Client) Connect(ctx context.Context, addr string) (Conn, error) {
 			}
 		}
 	}()
-	return conn, nil
+	return conn
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), defaultPort)
 }
@@ -7,8 +7,8 @@ import (
 	"encoding"
 	"io"
 
+	"github.com/hori-ryota/go-rtmp/rtmp/amf"
 	"github.com/pkg/errors"
-	amf "github.com/zhangpeihao/goamf"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -122,53 +122,19 @@ func (m *connect) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m connect) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
+	v := m.EncodingAMFType().amfVersion()
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		if len(m.OptionalUserArguments()) != 0 {
-			_, err = amf.WriteObject(b, m.OptionalUserArguments())
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to write optionalUserArguments: type map")
-			}
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
 	if len(m.OptionalUserArguments()) != 0 {
-		_, err = amf.AMF3_WriteObject(b, m.OptionalUserArguments())
-		if err != nil {
+		if err := amf.NewEncoder(b, v).Encode(m.OptionalUserArguments()); err != nil {
 			return nil, errors.Wrap(err, "failed to write optionalUserArguments: type map")
 		}
 	}
@@ -176,66 +142,26 @@ func (m connect) MarshalBinary() ([]byte, error) {
 }
 
 func (m *connect) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.commandObject, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read commandObject: type map")
-			}
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			if errors.Cause(err) == io.EOF {
-				return nil
-			}
-			return errors.Wrap(err, "failed to read optionalUserArguments: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.optionalUserArguments, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read optionalUserArguments: type map")
-			}
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.commandObject, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.commandObject = o
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		if errors.Cause(err) == io.EOF {
 			return nil
 		}
 		return errors.Wrap(err, "failed to read optionalUserArguments: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.optionalUserArguments, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read optionalUserArguments: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.optionalUserArguments = o
 	}
 	return nil
 }
@@ -306,118 +232,41 @@ func (m *connectResult) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m connectResult) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.Properties() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.Properties())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write properties: type map")
-		}
-		if m.Information() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.Information())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write information: type map")
-		}
-		return b.Bytes(), nil
-	}
+	v := m.EncodingAMFType().amfVersion()
 
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.Properties() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.Properties())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.Properties()); err != nil {
 		return nil, errors.Wrap(err, "failed to write properties: type map")
 	}
-	if m.Information() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.Information())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.Information()); err != nil {
 		return nil, errors.Wrap(err, "failed to write information: type map")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *connectResult) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read properties: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.properties, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read properties: type map")
-			}
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read information: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.information, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read information: type map")
-			}
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read properties: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.properties, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read properties: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.properties = o
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read information: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.information, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read information: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.information = o
 	}
 	return nil
 }
@@ -488,118 +337,41 @@ func (m *connectError) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m connectError) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
+	v := m.EncodingAMFType().amfVersion()
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.Properties() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.Properties())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write properties: type map")
-		}
-		if m.Information() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.Information())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write information: type map")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.Properties() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.Properties())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.Properties()); err != nil {
 		return nil, errors.Wrap(err, "failed to write properties: type map")
 	}
-	if m.Information() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.Information())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.Information()); err != nil {
 		return nil, errors.Wrap(err, "failed to write information: type map")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *connectError) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read properties: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.properties, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read properties: type map")
-			}
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read information: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.information, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read information: type map")
-			}
-		}
-		return nil
-	}
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
 
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read properties: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.properties, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read properties: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.properties = o
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read information: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.information, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read information: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.information = o
 	}
 	return nil
 }
@@ -679,53 +451,19 @@ func (m *call) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m call) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
+	v := m.EncodingAMFType().amfVersion()
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.ProcedureName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write procedureName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		if len(m.OptionalArguments()) != 0 {
-			_, err = amf.WriteObject(b, m.OptionalArguments())
-			if err != nil {
-				return nil, errors.Wrap(err, "failed to write optionalArguments: type map")
-			}
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.ProcedureName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.ProcedureName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write procedureName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
 	if len(m.OptionalArguments()) != 0 {
-		_, err = amf.AMF3_WriteObject(b, m.OptionalArguments())
-		if err != nil {
+		if err := amf.NewEncoder(b, v).Encode(m.OptionalArguments()); err != nil {
 			return nil, errors.Wrap(err, "failed to write optionalArguments: type map")
 		}
 	}
@@ -733,68 +471,28 @@ func (m call) MarshalBinary() ([]byte, error) {
 }
 
 func (m *call) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		m.procedureName, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read procedureName: type string")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		} else {
-			m.transactionID = uint32(f)
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.commandObject, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read commandObject: type map")
-			}
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			if errors.Cause(err) == io.EOF {
-				return nil
-			}
-			return errors.Wrap(err, "failed to read optionalArguments: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.optionalArguments, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read optionalArguments: type map")
-			}
-		}
-		return nil
-	}
-
-	m.procedureName, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(&m.procedureName); err != nil {
 		return errors.Wrap(err, "failed to read procedureName: type string")
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var transactionID float64
+	if err := d.Decode(&transactionID); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
-	} else {
-		m.transactionID = uint32(f)
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	m.transactionID = uint32(transactionID)
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.commandObject, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.commandObject = o
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		if errors.Cause(err) == io.EOF {
 			return nil
 		}
 		return errors.Wrap(err, "failed to read optionalArguments: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.optionalArguments, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read optionalArguments: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.optionalArguments = o
 	}
 	return nil
 }
@@ -874,120 +572,43 @@ func (m *callResponse) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m callResponse) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
+	v := m.EncodingAMFType().amfVersion()
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		if m.Response() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.Response())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write response: type map")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	if m.Response() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.Response())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.Response()); err != nil {
 		return nil, errors.Wrap(err, "failed to write response: type map")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *callResponse) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		m.commandName, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		} else {
-			m.transactionID = uint32(f)
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.commandObject, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read commandObject: type map")
-			}
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read response: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.response, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read response: type map")
-			}
-		}
-		return nil
-	}
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
 
-	m.commandName, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(&m.commandName); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var transactionID float64
+	if err := d.Decode(&transactionID); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
-	} else {
-		m.transactionID = uint32(f)
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	m.transactionID = uint32(transactionID)
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.commandObject, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.commandObject = o
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read response: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.response, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read response: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.response = o
 	}
 	return nil
 }
@@ -1043,37 +664,18 @@ func (m *close) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m close) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
+	v := m.EncodingAMFType().amfVersion()
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *close) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
 	return nil
@@ -1137,88 +739,35 @@ func (m *createStream) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m createStream) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
+	v := m.EncodingAMFType().amfVersion()
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *createStream) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		} else {
-			m.transactionID = uint32(f)
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.commandObject, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read commandObject: type map")
-			}
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var transactionID float64
+	if err := d.Decode(&transactionID); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
-	} else {
-		m.transactionID = uint32(f)
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	m.transactionID = uint32(transactionID)
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.commandObject, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.commandObject = o
 	}
 	return nil
 }
@@ -1289,107 +838,44 @@ func (m *createStreamResult) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m createStreamResult) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
+	v := m.EncodingAMFType().amfVersion()
 
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteDouble(b, float64(m.StreamID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write streamID: type uint32")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.StreamID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.StreamID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write streamID: type uint32")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *createStreamResult) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		} else {
-			m.transactionID = uint32(f)
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.commandObject, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read commandObject: type map")
-			}
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read streamID: type uint32")
-		} else {
-			m.streamID = uint32(f)
-		}
-		return nil
-	}
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
 
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var transactionID float64
+	if err := d.Decode(&transactionID); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
-	} else {
-		m.transactionID = uint32(f)
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	m.transactionID = uint32(transactionID)
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.commandObject, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.commandObject = o
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var streamID float64
+	if err := d.Decode(&streamID); err != nil {
 		return errors.Wrap(err, "failed to read streamID: type uint32")
-	} else {
-		m.streamID = uint32(f)
 	}
+	m.streamID = uint32(streamID)
 	return nil
 }
 func UnmarshalCreateStreamResultBinary(b []byte, encodingAMFType EncodingAMFType) (CreateStreamResult, error) {
@@ -1460,107 +946,44 @@ func (m *createStreamError) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m createStreamError) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteDouble(b, float64(m.StreamID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write streamID: type uint32")
-		}
-		return b.Bytes(), nil
-	}
+	v := m.EncodingAMFType().amfVersion()
 
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.StreamID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.StreamID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write streamID: type uint32")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *createStreamError) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		} else {
-			m.transactionID = uint32(f)
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.commandObject, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read commandObject: type map")
-			}
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read streamID: type uint32")
-		} else {
-			m.streamID = uint32(f)
-		}
-		return nil
-	}
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
 
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var transactionID float64
+	if err := d.Decode(&transactionID); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
-	} else {
-		m.transactionID = uint32(f)
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	m.transactionID = uint32(transactionID)
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.commandObject, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.commandObject = o
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var streamID float64
+	if err := d.Decode(&streamID); err != nil {
 		return errors.Wrap(err, "failed to read streamID: type uint32")
-	} else {
-		m.streamID = uint32(f)
 	}
+	m.streamID = uint32(streamID)
 	return nil
 }
 func UnmarshalCreateStreamErrorBinary(b []byte, encodingAMFType EncodingAMFType) (CreateStreamError, error) {
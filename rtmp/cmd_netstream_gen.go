@@ -6,8 +6,8 @@ import (
 	"bytes"
 	"encoding"
 
+	"github.com/hori-ryota/go-rtmp/rtmp/amf"
 	"github.com/pkg/errors"
-	amf "github.com/zhangpeihao/goamf"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -67,110 +67,39 @@ func (m *onStatus) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m onStatus) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		if m.InfoObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.InfoObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write infoObject: type map")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	if m.InfoObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.InfoObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.InfoObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write infoObject: type map")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *onStatus) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read infoObject: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.infoObject, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read infoObject: type map")
-			}
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read infoObject: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.infoObject, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read infoObject: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.infoObject = o
 	}
 	return nil
 }
@@ -262,147 +191,59 @@ func (m *play) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m play) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteString(b, m.StreamName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write streamName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.Start()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write start: type uint32")
-		}
-		_, err = amf.WriteDouble(b, float64(m.Duration()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write duration: type uint32")
-		}
-		_, err = amf.WriteBoolean(b, m.Reset())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write reset: type bool")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteString(b, m.StreamName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.StreamName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write streamName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.Start()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.Start())); err != nil {
 		return nil, errors.Wrap(err, "failed to write start: type uint32")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.Duration()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.Duration())); err != nil {
 		return nil, errors.Wrap(err, "failed to write duration: type uint32")
 	}
-	_, err = amf.AMF3_WriteBoolean(b, m.Reset())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.Reset()); err != nil {
 		return nil, errors.Wrap(err, "failed to write reset: type bool")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *play) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		m.streamName, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read streamName: type string")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read start: type uint32")
-		} else {
-			m.start = uint32(f)
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read duration: type uint32")
-		} else {
-			m.duration = uint32(f)
-		}
-		m.reset, err = amf.ReadBoolean(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read reset: type bool")
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	m.streamName, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(&m.streamName); err != nil {
 		return errors.Wrap(err, "failed to read streamName: type string")
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var start float64
+	if err := d.Decode(&start); err != nil {
 		return errors.Wrap(err, "failed to read start: type uint32")
-	} else {
-		m.start = uint32(f)
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	m.start = uint32(start)
+	var duration float64
+	if err := d.Decode(&duration); err != nil {
 		return errors.Wrap(err, "failed to read duration: type uint32")
-	} else {
-		m.duration = uint32(f)
 	}
-	if mk, err := amf.ReadMarker(r); err != nil {
+	m.duration = uint32(duration)
+	if err := d.Decode(&m.reset); err != nil {
 		return errors.Wrap(err, "failed to read reset: type bool")
-	} else {
-		m.reset = mk == amf.AMF3_TRUE_MARKER
 	}
 	return nil
 }
@@ -474,110 +315,39 @@ func (m *play2) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m play2) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		if m.Parameters() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.Parameters())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write parameters: type map")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	if m.Parameters() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.Parameters())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.Parameters()); err != nil {
 		return nil, errors.Wrap(err, "failed to write parameters: type map")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *play2) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		if f, err := amf.ReadMarker(r); err != nil {
-			return errors.Wrap(err, "failed to read parameters: type map")
-		} else if f == amf.AMF0_OBJECT_MARKER {
-			m.parameters, err = amf.ReadObjectProperty(r)
-			if err != nil {
-				return errors.Wrap(err, "failed to read parameters: type map")
-			}
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	if f, err := amf.ReadMarker(r); err != nil {
+	if v, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read parameters: type map")
-	} else if f == amf.AMF3_OBJECT_MARKER {
-		m.parameters, err = amf.AMF3_ReadObjectProperty(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read parameters: type map")
-		}
+	} else if o, ok := v.(map[string]interface{}); ok {
+		m.parameters = o
 	}
 	return nil
 }
@@ -648,97 +418,40 @@ func (m *deleteStream) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m deleteStream) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteDouble(b, float64(m.StreamID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write streamID: type uint32")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.StreamID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.StreamID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write streamID: type uint32")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *deleteStream) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read streamID: type uint32")
-		} else {
-			m.streamID = uint32(f)
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var streamID float64
+	if err := d.Decode(&streamID); err != nil {
 		return errors.Wrap(err, "failed to read streamID: type uint32")
-	} else {
-		m.streamID = uint32(f)
 	}
+	m.streamID = uint32(streamID)
 	return nil
 }
 func UnmarshalDeleteStreamBinary(b []byte, encodingAMFType EncodingAMFType) (DeleteStream, error) {
@@ -806,97 +519,40 @@ func (m *closeStream) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m closeStream) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteDouble(b, float64(m.StreamID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write streamID: type uint32")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.StreamID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.StreamID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write streamID: type uint32")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *closeStream) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read streamID: type uint32")
-		} else {
-			m.streamID = uint32(f)
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var streamID float64
+	if err := d.Decode(&streamID); err != nil {
 		return errors.Wrap(err, "failed to read streamID: type uint32")
-	} else {
-		m.streamID = uint32(f)
 	}
+	m.streamID = uint32(streamID)
 	return nil
 }
 func UnmarshalCloseStreamBinary(b []byte, encodingAMFType EncodingAMFType) (CloseStream, error) {
@@ -964,95 +620,37 @@ func (m *receiveAudio) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m receiveAudio) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteBoolean(b, m.BoolFlag())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write boolFlag: type bool")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteBoolean(b, m.BoolFlag())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.BoolFlag()); err != nil {
 		return nil, errors.Wrap(err, "failed to write boolFlag: type bool")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *receiveAudio) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		m.boolFlag, err = amf.ReadBoolean(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read boolFlag: type bool")
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	if mk, err := amf.ReadMarker(r); err != nil {
+	if err := d.Decode(&m.boolFlag); err != nil {
 		return errors.Wrap(err, "failed to read boolFlag: type bool")
-	} else {
-		m.boolFlag = mk == amf.AMF3_TRUE_MARKER
 	}
 	return nil
 }
@@ -1121,95 +719,37 @@ func (m *receiveVideo) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m receiveVideo) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteBoolean(b, m.BoolFlag())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write boolFlag: type bool")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteBoolean(b, m.BoolFlag())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.BoolFlag()); err != nil {
 		return nil, errors.Wrap(err, "failed to write boolFlag: type bool")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *receiveVideo) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		m.boolFlag, err = amf.ReadBoolean(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read boolFlag: type bool")
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	if mk, err := amf.ReadMarker(r); err != nil {
+	if err := d.Decode(&m.boolFlag); err != nil {
 		return errors.Wrap(err, "failed to read boolFlag: type bool")
-	} else {
-		m.boolFlag = mk == amf.AMF3_TRUE_MARKER
 	}
 	return nil
 }
@@ -1285,114 +825,42 @@ func (m *publish) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m publish) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteString(b, m.PublishingName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write publishingName: type string")
-		}
-		_, err = amf.WriteString(b, string(m.PublishingType()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write publishingType: type publishingType")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteString(b, m.PublishingName())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.PublishingName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write publishingName: type string")
 	}
-	_, err = amf.AMF3_WriteString(b, string(m.PublishingType()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(string(m.PublishingType())); err != nil {
 		return nil, errors.Wrap(err, "failed to write publishingType: type publishingType")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *publish) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		m.publishingName, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read publishingName: type string")
-		}
-		if f, err := amf.ReadString(r); err != nil {
-			return errors.Wrap(err, "failed to read publishingType: type publishingType")
-		} else {
-			m.publishingType = PublishingType(f)
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	m.publishingName, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	if err := d.Decode(&m.publishingName); err != nil {
 		return errors.Wrap(err, "failed to read publishingName: type string")
 	}
-	if f, err := amf.AMF3_ReadString(r); err != nil {
-		return errors.Wrap(err, "failed to read publishingType: type publishingType")
-	} else {
-		m.publishingType = PublishingType(f)
-	}
-	if err != nil {
+	if err := d.Decode(&m.publishingType); err != nil {
 		return errors.Wrap(err, "failed to read publishingType: type publishingType")
 	}
 	return nil
@@ -1463,97 +931,40 @@ func (m *seek) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m seek) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteDouble(b, float64(m.MilliSeconds()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write milliSeconds: type uint32")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.MilliSeconds()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.MilliSeconds())); err != nil {
 		return nil, errors.Wrap(err, "failed to write milliSeconds: type uint32")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *seek) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read milliSeconds: type uint32")
-		} else {
-			m.milliSeconds = uint32(f)
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var milliSeconds float64
+	if err := d.Decode(&milliSeconds); err != nil {
 		return errors.Wrap(err, "failed to read milliSeconds: type uint32")
-	} else {
-		m.milliSeconds = uint32(f)
 	}
+	m.milliSeconds = uint32(milliSeconds)
 	return nil
 }
 func UnmarshalSeekBinary(b []byte, encodingAMFType EncodingAMFType) (Seek, error) {
@@ -1628,114 +1039,46 @@ func (m *pause) SetEncodingAMFType(v EncodingAMFType) {
 
 func (m pause) MarshalBinary() ([]byte, error) {
 	b := new(bytes.Buffer)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.WriteString(b, m.CommandName())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandName: type string")
-		}
-		_, err = amf.WriteDouble(b, float64(m.TransactionID()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
-		}
-		if m.CommandObject() == nil {
-			_, err = amf.WriteNull(b)
-		} else {
-			_, err = amf.WriteObject(b, m.CommandObject())
-		}
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write commandObject: type map")
-		}
-		_, err = amf.WriteBoolean(b, m.PauseUnpauseFlag())
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write pauseUnpauseFlag: type bool")
-		}
-		_, err = amf.WriteDouble(b, float64(m.MilliSeconds()))
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to write milliSeconds: type uint32")
-		}
-		return b.Bytes(), nil
-	}
-
-	_, err = amf.AMF3_WriteString(b, m.CommandName())
-	if err != nil {
+	v := m.EncodingAMFType().amfVersion()
+
+	if err := amf.NewEncoder(b, v).Encode(m.CommandName()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandName: type string")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.TransactionID()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.TransactionID())); err != nil {
 		return nil, errors.Wrap(err, "failed to write transactionID: type uint32")
 	}
-	if m.CommandObject() == nil {
-		_, err = amf.AMF3_WriteNull(b)
-	} else {
-		_, err = amf.AMF3_WriteObject(b, m.CommandObject())
-	}
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.CommandObject()); err != nil {
 		return nil, errors.Wrap(err, "failed to write commandObject: type map")
 	}
-	_, err = amf.AMF3_WriteBoolean(b, m.PauseUnpauseFlag())
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(m.PauseUnpauseFlag()); err != nil {
 		return nil, errors.Wrap(err, "failed to write pauseUnpauseFlag: type bool")
 	}
-	_, err = amf.AMF3_WriteDouble(b, float64(m.MilliSeconds()))
-	if err != nil {
+	if err := amf.NewEncoder(b, v).Encode(float64(m.MilliSeconds())); err != nil {
 		return nil, errors.Wrap(err, "failed to write milliSeconds: type uint32")
 	}
 	return b.Bytes(), nil
 }
 
 func (m *pause) UnmarshalBinary(b []byte) error {
-	r := bytes.NewReader(b)
-	var err error
-
-	if m.EncodingAMFType() == EncodingAMFTypeAMF0 {
-		_, err = amf.ReadString(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandName: type string")
-		}
-		_, err = amf.ReadDouble(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read transactionID: type uint32")
-		}
-		_, err = amf.ReadMarker(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read commandObject: type map")
-		}
-		m.pauseUnpauseFlag, err = amf.ReadBoolean(r)
-		if err != nil {
-			return errors.Wrap(err, "failed to read pauseUnpauseFlag: type bool")
-		}
-		if f, err := amf.ReadDouble(r); err != nil {
-			return errors.Wrap(err, "failed to read milliSeconds: type uint32")
-		} else {
-			m.milliSeconds = uint32(f)
-		}
-		return nil
-	}
-
-	_, err = amf.AMF3_ReadString(r)
-	if err != nil {
+	d := amf.NewDecoder(bytes.NewReader(b), m.EncodingAMFType().amfVersion())
+
+	if err := d.Decode(new(string)); err != nil {
 		return errors.Wrap(err, "failed to read commandName: type string")
 	}
-	_, err = amf.AMF3_ReadDouble(r)
-	if err != nil {
+	if err := d.Decode(new(float64)); err != nil {
 		return errors.Wrap(err, "failed to read transactionID: type uint32")
 	}
-	_, err = amf.ReadMarker(r)
-	if err != nil {
+	if _, err := d.DecodeValue(); err != nil {
 		return errors.Wrap(err, "failed to read commandObject: type map")
 	}
-	if mk, err := amf.ReadMarker(r); err != nil {
+	if err := d.Decode(&m.pauseUnpauseFlag); err != nil {
 		return errors.Wrap(err, "failed to read pauseUnpauseFlag: type bool")
-	} else {
-		m.pauseUnpauseFlag = mk == amf.AMF3_TRUE_MARKER
 	}
-	if f, err := amf.AMF3_ReadDouble(r); err != nil {
+	var milliSeconds float64
+	if err := d.Decode(&milliSeconds); err != nil {
 		return errors.Wrap(err, "failed to read milliSeconds: type uint32")
-	} else {
-		m.milliSeconds = uint32(f)
 	}
+	m.milliSeconds = uint32(milliSeconds)
 	return nil
 }
 func UnmarshalPauseBinary(b []byte, encodingAMFType EncodingAMFType) (Pause, error) {
@@ -2,8 +2,13 @@ package rtmp
 
 import (
 	"context"
+	"crypto/cipher"
+	"crypto/tls"
 	"io"
+	"io/ioutil"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hori-ryota/go-rtmp/rtmp/handshake"
@@ -16,6 +21,11 @@ type Conn interface {
 	io.Closer
 	Context() context.Context
 
+	// RemoteAddr is the address of the peer. Behind a proxyproto.Listener it
+	// is the address of the real client.
+	RemoteAddr() net.Addr
+	NetConn() net.Conn
+
 	Reader() Reader
 	SetReader(r Reader)
 
@@ -33,8 +43,27 @@ type Conn interface {
 	NetStreamCommander
 	DefaultNetStreamCommandHandler() NetStreamCommandHandler
 
+	// ConnectParams returns the parameters of the accepted connect. It is
+	// zero until connect is received.
+	ConnectParams() ConnectParams
+	// ObjectEncoding is the AMF version negotiated by connect. Commands are
+	// sent as AMF3 command messages when it is AMF3.
+	ObjectEncoding() EncodingAMFType
+
+	MessageStream(messageStreamID uint32) (MessageStream, bool)
+	MessageStreams() []MessageStream
+
+	Stats() ConnStats
+
+	// TLSConnectionState returns the negotiated TLS state of an rtmps
+	// connection. ok is false for a plain connection.
+	TLSConnectionState() (state tls.ConnectionState, ok bool)
+
 	SetCreateStreamCallbacks(transactionID uint32, f func(CreateStreamResponse) ConnError)
 	AddNetstreamCommandCallbacks(func(OnStatus) ConnError)
+	// AddConnectCallbacks calls f once with the _result or _error of the
+	// next connect.
+	AddConnectCallbacks(f func(ConnectResponse) ConnError)
 	TransactionID() uint32
 
 	Logger() *zap.Logger
@@ -44,22 +73,55 @@ type defaultConn struct {
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 	conn       net.Conn
+	closeOnce  sync.Once
+	closeErr   error
 
 	handshaker handshake.Handshaker
 
 	reader
 	writer
+	readerOptions             []ReaderOption
 	encodingAMFType           EncodingAMFType
 	bandwidthLimitType        BandwidthLimitType
 	windowAcknowledgementSize uint32
 
 	timestampPoint time.Time
 
+	pingInterval    time.Duration
+	pingTimeout     time.Duration
+	readIdleTimeout time.Duration
+	pingSentAt      int64 // unix nano of the unanswered PingRequest, 0 if none
+	rtt             int64 // time.Duration
+
 	messagePubsub
 
+	// connectMu guards connectParams and encodingAMFType, which are read
+	// by other goroutines through a Server.
+	connectMu      sync.RWMutex
+	connectParams  ConnectParams
+	messageStreams *messageStreamTable
+
+	bytesRead    uint64
+	bytesWritten uint64
+
+	metrics Metrics
+	meters  streamMeters
+
+	isServer   bool
+	tracer     Tracer
+	firstMedia firstMediaSpans
+
+	// closingAtKeyframe is set by Server.Shutdown to end Serve before the
+	// next video keyframe.
+	closingAtKeyframe int32
+
 	createStreamCallbacks     map[uint32] /* transactionID */ func(CreateStreamResponse) ConnError
 	netStreamCommandCallbacks []func(onStatus OnStatus) ConnError
 
+	// connectCallbacks are added by the goroutine dialing, not serving.
+	connectCallbacksMu sync.Mutex
+	connectCallbacks   []func(ConnectResponse) ConnError
+
 	onConnectValidators []func(
 		ctx context.Context,
 		connect Connect,
@@ -70,6 +132,21 @@ type defaultConn struct {
 		publish Publish,
 	) (errorInfo map[string]interface{})
 
+	onPlayValidators []func(
+		ctx context.Context,
+		play Play,
+	) (errorInfo map[string]interface{})
+
+	statusHandlers []func(
+		ctx context.Context,
+		messageStreamID uint32,
+		status Status,
+	) ConnError
+
+	// handshaked is done when commands can be sent.
+	handshaked    context.Context
+	handshakeDone context.CancelFunc
+
 	logger *zap.Logger
 }
 
@@ -87,22 +164,30 @@ func NewDefaultConn(
 		ctx:                       ctx,
 		cancelFunc:                cancel,
 		conn:                      nc,
-		handshaker:                handshake.NewDefaultHandshaker(isServer),
+		isServer:                  isServer,
+		handshaker:                handshake.NewComplexHandshaker(isServer),
 		encodingAMFType:           defaultEncodingAMFType,
 		bandwidthLimitType:        defaultBandwidthLimitType,
 		windowAcknowledgementSize: defaultWindowAcknowledgementSize,
 		messagePubsub:             NewDefaultMessagePubsub(),
+		messageStreams:            newMessageStreamTable(defaultMaxMessageStreams),
 
 		createStreamCallbacks: map[uint32]func(CreateStreamResponse) ConnError{},
 
 		logger: logger,
 	}
-	conn.reader = NewDefaultReader(conn, nc, conn.windowAcknowledgementSize, conn.logger)
-	conn.writer = NewDefaultWriter(conn, nc)
+	conn.ctx = context.WithValue(conn.ctx, connContextKey{}, Conn(conn))
+	conn.handshaked, conn.handshakeDone = context.WithCancel(context.Background())
 	ops := &connOptions{}
 	for _, o := range connOps {
 		o(ops)
 	}
+	conn.readerOptions = ops.readerOptions
+	conn.metrics = ops.metrics
+	conn.tracer = ops.tracer
+	counted := conn.countingConn(nc)
+	conn.reader = NewDefaultReader(conn, counted, conn.windowAcknowledgementSize, conn.logger, conn.readerOptions...)
+	conn.writer = NewDefaultWriter(conn, counted)
 	ops.Apply(conn)
 	return conn
 }
@@ -113,53 +198,174 @@ func (conn *defaultConn) Serve() error {
 	r := conn.reader
 	w := conn.writer
 
-	if err := conn.handshaker.Handshake(
-		ctx, r, w,
-	); err != nil {
+	if err := conn.extendReadDeadline(); err != nil {
+		return errors.Wrap(err, "failed to SetReadDeadline")
+	}
+	if tc, ok := conn.conn.(*tls.Conn); ok {
+		if err := tc.HandshakeContext(ctx); err != nil {
+			if errors.Cause(err) == io.EOF || isDone(ctx) {
+				return nil
+			}
+			return errors.Wrap(err, "failed to TLS handshake")
+		}
+	}
+	var decrypter, encrypter cipher.Stream
+	var err error
+	handshakeStart := time.Now()
+	var handshakeSpan Span
+	if conn.tracer != nil {
+		_, handshakeSpan = conn.startSpan(ctx, SpanNameHandshake)
+	}
+	if y, ok := conn.handshaker.(handshake.CipherHandshaker); ok {
+		decrypter, encrypter, err = y.HandshakeWithCiphers(ctx, r, w)
+	} else {
+		err = conn.handshaker.Handshake(ctx, r, w)
+	}
+	handshakeResult := HandshakeResultSuccess
+	if err != nil {
+		handshakeResult = HandshakeResultFailure
+		if isTimeout(err) {
+			handshakeResult = HandshakeResultTimeout
+		}
+	}
+	connMetrics(conn).Handshake(handshakeResult, time.Since(handshakeStart))
+	if handshakeSpan != nil {
+		handshakeSpan.SetAttributes(SpanAttribute{Key: SpanAttributeHandshakeResult, Value: string(handshakeResult)})
+		handshakeSpan.End(err)
+	}
+	if err != nil {
 		if errors.Cause(err) == io.EOF || isDone(ctx) {
 			return nil
 		}
+		if isTimeout(err) {
+			return NewConnFatalError(errors.Wrap(err, "read idle timeout on handshake"))
+		}
 		return errors.Wrap(err, "failed to handshake")
 	}
+	if decrypter != nil {
+		// RTMPE: bytes the reader buffered after the handshake are decrypted
+		// too, because the new reader reads through the old one.
+		conn.SetReader(NewDefaultReader(
+			conn,
+			cipher.StreamReader{S: decrypter, R: r},
+			conn.windowAcknowledgementSize,
+			conn.logger,
+			conn.readerOptions...,
+		))
+		conn.SetWriter(NewDefaultWriter(conn, cipher.StreamWriter{S: encrypter, W: conn.countingConn(conn.conn)}))
+		r, w = conn.reader, conn.writer
+	}
 
 	conn.timestampPoint = time.Now()
+	conn.handshakeDone()
+
+	if conn.pingInterval > 0 {
+		go conn.keepalive(ctx)
+	}
+	if conn.metrics != nil {
+		go conn.sampleStreams(ctx)
+	}
 
 	for !isDone(ctx) {
+		// the reader extends the deadline as bytes arrive; this gives the
+		// time spent handling the previous message back to the peer
+		if err := conn.extendReadDeadline(); err != nil {
+			return errors.Wrap(err, "failed to SetReadDeadline")
+		}
 		m, err := r.ReadMessage()
 		if err != nil {
 			if errors.Cause(err) == io.EOF || isDone(ctx) {
 				return nil
 			}
+			if isTimeout(err) {
+				return NewConnFatalError(
+					errors.Wrap(err, "read idle timeout"),
+					zap.Duration("readIdleTimeout", conn.readIdleTimeout),
+				)
+			}
+			if IsConnFatalError(err) {
+				return err
+			}
 			conn.logger.Error(
 				"failed to read message",
 				zap.Error(err),
 			)
 			continue
 		}
-		if err := conn.HandleMessage(ctx, m); err != nil {
+		if m.TypeID() == MessageTypeIDVideo && atomic.LoadInt32(&conn.closingAtKeyframe) != 0 &&
+			isVideoKeyframe(m.Payload()) && !isVideoSequenceHeader(m.Payload()) {
+			m.Release()
+			conn.logger.Info("closing at keyframe")
+			return nil
+		}
+		if isMediaMessage(m.TypeID()) {
+			conn.meterMedia(m)
+			if conn.tracer != nil {
+				conn.endFirstMedia(m.StreamID(), nil)
+			}
+		}
+		var connErr ConnError
+		if m.TypeID() == MessageTypeIDCommandAMF0 || m.TypeID() == MessageTypeIDCommandAMF3 {
+			commandCtx, endCommand := conn.traceCommand(ctx, m)
+			connErr = conn.HandleMessage(commandCtx, m)
+			endCommand(connErr)
+		} else {
+			connErr = conn.HandleMessage(ctx, m)
+		}
+		m.Release()
+		if connErr != nil {
 			switch {
-			case IsConnWarnError(err):
+			case IsConnWarnError(connErr):
 				conn.logger.Warn(
 					"caught error",
-					append(err.Fields(), zap.Error(err))...,
+					append(connErr.Fields(), zap.Error(connErr))...,
 				)
-			case IsConnRejectedError(err):
+			case IsConnRejectedError(connErr):
 				conn.logger.Info(
 					"caught rejected error",
-					append(err.Fields(), zap.Error(err))...,
+					append(connErr.Fields(), zap.Error(connErr))...,
 				)
+				conn.lingerRejected()
 				return nil
 			default:
-				return err
+				return connErr
 			}
 		}
 	}
 	return ctx.Err()
 }
 
+// rejectLinger is how long a rejected connection waits for the peer to
+// close after reading the rejection.
+const rejectLinger = time.Second
+
+// lingerRejected half-closes the connection and discards what the peer
+// still sends, so the rejection is not lost to a reset when the connection
+// is closed with unread data.
+func (conn *defaultConn) lingerRejected() {
+	cw, ok := conn.conn.(interface{ CloseWrite() error })
+	if !ok {
+		return
+	}
+	if err := cw.CloseWrite(); err != nil {
+		return
+	}
+	if err := conn.conn.SetReadDeadline(time.Now().Add(rejectLinger)); err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, conn.conn)
+}
+
+// Close closes the connection once; later calls return the result of the
+// first.
 func (conn *defaultConn) Close() error {
-	defer conn.cancelFunc()
-	return conn.conn.Close()
+	conn.closeOnce.Do(func() {
+		defer conn.cancelFunc()
+		conn.messageStreams.DeleteAll()
+		conn.endFirstMediaAll()
+		conn.closeErr = conn.conn.Close()
+	})
+	return conn.closeErr
 }
 
 func (conn *defaultConn) Reader() Reader {
@@ -186,6 +392,63 @@ func (conn *defaultConn) Context() context.Context {
 	return conn.ctx
 }
 
+type connContextKey struct{}
+
+// ConnFromContext returns the Conn whose handlers and validators are called
+// with ctx.
+func ConnFromContext(ctx context.Context) (Conn, bool) {
+	conn, ok := ctx.Value(connContextKey{}).(Conn)
+	return conn, ok
+}
+
+func (conn *defaultConn) RemoteAddr() net.Addr {
+	return conn.conn.RemoteAddr()
+}
+
+func (conn *defaultConn) NetConn() net.Conn {
+	return conn.conn
+}
+
+func (conn *defaultConn) TLSConnectionState() (tls.ConnectionState, bool) {
+	tc, ok := conn.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	return tc.ConnectionState(), true
+}
+
+func (conn *defaultConn) ConnectParams() ConnectParams {
+	conn.connectMu.RLock()
+	defer conn.connectMu.RUnlock()
+	return conn.connectParams
+}
+
+func (conn *defaultConn) setConnectParams(params ConnectParams) {
+	conn.connectMu.Lock()
+	defer conn.connectMu.Unlock()
+	conn.connectParams = params
+}
+
+func (conn *defaultConn) ObjectEncoding() EncodingAMFType {
+	conn.connectMu.RLock()
+	defer conn.connectMu.RUnlock()
+	return conn.encodingAMFType
+}
+
+func (conn *defaultConn) setObjectEncoding(encodingAMFType EncodingAMFType) {
+	conn.connectMu.Lock()
+	defer conn.connectMu.Unlock()
+	conn.encodingAMFType = encodingAMFType
+}
+
+func (conn *defaultConn) MessageStream(messageStreamID uint32) (MessageStream, bool) {
+	return conn.messageStreams.Get(messageStreamID)
+}
+
+func (conn *defaultConn) MessageStreams() []MessageStream {
+	return conn.messageStreams.List()
+}
+
 func (conn *defaultConn) SetCreateStreamCallbacks(transactionID uint32, f func(CreateStreamResponse) ConnError) {
 	conn.createStreamCallbacks[transactionID] = f
 }
@@ -194,6 +457,30 @@ func (conn *defaultConn) AddNetstreamCommandCallbacks(f func(OnStatus) ConnError
 	conn.netStreamCommandCallbacks = append(conn.netStreamCommandCallbacks, f)
 }
 
+func (conn *defaultConn) AddConnectCallbacks(f func(ConnectResponse) ConnError) {
+	conn.connectCallbacksMu.Lock()
+	defer conn.connectCallbacksMu.Unlock()
+	conn.connectCallbacks = append(conn.connectCallbacks, f)
+}
+
+func (conn *defaultConn) callConnectCallbacks(response ConnectResponse) ConnError {
+	conn.connectCallbacksMu.Lock()
+	callbacks := conn.connectCallbacks
+	conn.connectCallbacks = nil
+	conn.connectCallbacksMu.Unlock()
+	var warnError ConnError
+	for _, f := range callbacks {
+		if err := f(response); err != nil {
+			if IsConnWarnError(err) {
+				warnError = err
+			} else {
+				return err
+			}
+		}
+	}
+	return warnError
+}
+
 func (conn *defaultConn) TransactionID() uint32 {
 	for i := uint32(2); true; i++ {
 		if _, ok := conn.createStreamCallbacks[i]; !ok {
@@ -5,8 +5,8 @@ import (
 	"context"
 	"encoding/binary"
 
+	"github.com/hori-ryota/go-rtmp/rtmp/amf"
 	"github.com/pkg/errors"
-	amf "github.com/zhangpeihao/goamf"
 	"go.uber.org/zap"
 )
 
@@ -142,19 +142,18 @@ func (h *ControlMessageHandler) HandleMessage(ctx context.Context, m Message) Co
 		}
 		return h.ProtocolControlEventHandler.OnSetPeerBandwidth(ctx, p)
 	case MessageTypeIDCommandAMF0, MessageTypeIDCommandAMF3:
-		var name string
-		var encodingAMFType EncodingAMFType
-		var err error
-		b := m.Payload()
-		r := bytes.NewReader(b)
-		if m.TypeID() == MessageTypeIDCommandAMF0 {
-			encodingAMFType = EncodingAMFTypeAMF0
-			name, err = amf.ReadString(r)
-		} else {
-			encodingAMFType = EncodingAMFTypeAMF3
-			name, err = amf.AMF3_ReadString(r)
-		}
+		b, err := AMF0Payload(m)
 		if err != nil {
+			return NewConnFatalError(
+				errors.Wrap(err, "failed to read command"),
+				zap.Object("message", m),
+			)
+		}
+		// both message types carry AMF0 commands
+		encodingAMFType := EncodingAMFTypeAMF0
+		d := amf.NewDecoder(bytes.NewReader(b), amf.AMF0)
+		var name string
+		if err := d.Decode(&name); err != nil {
 			return NewConnFatalError(
 				errors.Wrap(err, "failed to read command name"),
 				zap.Object("message", m),
@@ -190,12 +189,7 @@ func (h *ControlMessageHandler) HandleMessage(ctx context.Context, m Message) Co
 			return h.NetConnectionCommandHandler.OnClose(ctx, p)
 		case "_result", "_error":
 			var transactionID float64
-			if encodingAMFType == EncodingAMFTypeAMF0 {
-				transactionID, err = amf.ReadDouble(r)
-			} else {
-				transactionID, err = amf.AMF3_ReadDouble(r)
-			}
-			if err != nil {
+			if err := d.Decode(&transactionID); err != nil {
 				return NewConnFatalError(
 					errors.Wrap(err, "failed to read transactionID"),
 					zap.Object("message", m),
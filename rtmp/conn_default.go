@@ -4,4 +4,35 @@ const (
 	defaultBandwidthLimitType               = BandwidthLimitTypeSoft
 	defaultEncodingAMFType                  = EncodingAMFTypeAMF0
 	defaultWindowAcknowledgementSize uint32 = 2500000
+	defaultMaxMessageStreams                = 32
+
+	maxControlMessageSize   uint32 = 64
+	defaultMaxMessageSize   uint32 = 64 * 1024
+	defaultMaxChunkStreams         = 64
+	defaultMaxBufferedBytes uint32 = 64 * 1024 * 1024
+)
+
+var defaultMaxMessageSizes = map[MessageTypeID]uint32{
+	MessageTypeIDSetChunkSize:              maxControlMessageSize,
+	MessageTypeIDAbortMessage:              maxControlMessageSize,
+	MessageTypeIDAcknowledgement:           maxControlMessageSize,
+	MessageTypeIDUserControlMessages:       maxControlMessageSize,
+	MessageTypeIDWindowAcknowledgementSize: maxControlMessageSize,
+	MessageTypeIDSetPeerBandwidth:          maxControlMessageSize,
+	MessageTypeIDAudio:                     1024 * 1024,
+	MessageTypeIDVideo:                     0xffffff,
+	MessageTypeIDDataAMF3:                  1024 * 1024,
+	MessageTypeIDSharedObjectAMF3:          1024 * 1024,
+	MessageTypeIDCommandAMF3:               1024 * 1024,
+	MessageTypeIDDataAMF0:                  1024 * 1024,
+	MessageTypeIDSharedObjectAMF0:          1024 * 1024,
+	MessageTypeIDCommandAMF0:               1024 * 1024,
+	MessageTypeIDAggregate:                 0xffffff,
+}
+
+// fmsVer and fmsCapabilities are reported in the result of connect, as
+// clients check them to enable features.
+const (
+	fmsVer          = "FMS/3,0,1,123"
+	fmsCapabilities = 31
 )
@@ -0,0 +1,126 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type ConnStats struct {
+	// RTT is the round-trip time measured by the last answered PingRequest.
+	// It is zero until the first PingResponse arrives.
+	RTT time.Duration
+	// BytesRead and BytesWritten count bytes on the wire, including the
+	// handshake.
+	BytesRead    uint64
+	BytesWritten uint64
+}
+
+func (conn *defaultConn) Stats() ConnStats {
+	return ConnStats{
+		RTT:          time.Duration(atomic.LoadInt64(&conn.rtt)),
+		BytesRead:    atomic.LoadUint64(&conn.bytesRead),
+		BytesWritten: atomic.LoadUint64(&conn.bytesWritten),
+	}
+}
+
+// countingConn counts the bytes read from and written to Conn, and extends
+// the read deadline whenever bytes arrive.
+type countingConn struct {
+	net.Conn
+	read               *uint64
+	written            *uint64
+	metrics            Metrics
+	extendReadDeadline func() error
+}
+
+func (conn *defaultConn) countingConn(nc net.Conn) *countingConn {
+	return &countingConn{
+		Conn:               nc,
+		read:               &conn.bytesRead,
+		written:            &conn.bytesWritten,
+		metrics:            connMetrics(conn),
+		extendReadDeadline: conn.extendReadDeadline,
+	}
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		atomic.AddUint64(c.read, uint64(n))
+		c.metrics.BytesRead(n)
+		if err == nil {
+			if err := c.extendReadDeadline(); err != nil {
+				return n, errors.Wrap(err, "failed to SetReadDeadline")
+			}
+		}
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		atomic.AddUint64(c.written, uint64(n))
+		c.metrics.BytesWritten(n)
+	}
+	return n, err
+}
+
+// keepalive sends a PingRequest every pingInterval and closes the connection
+// when a request stays unanswered for longer than pingTimeout. The timeout is
+// checked on each tick, so it is effectively rounded up to the interval.
+func (conn *defaultConn) keepalive(ctx context.Context) {
+	t := time.NewTicker(conn.pingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			if sentAt := atomic.LoadInt64(&conn.pingSentAt); sentAt != 0 {
+				if conn.pingTimeout > 0 && now.Sub(time.Unix(0, sentAt)) > conn.pingTimeout {
+					conn.logger.Warn("ping timeout", zap.Duration("pingTimeout", conn.pingTimeout))
+					conn.Close()
+					return
+				}
+				continue
+			}
+			atomic.StoreInt64(&conn.pingSentAt, now.UnixNano())
+			if err := conn.PingRequest(ctx, conn.Timestamp()); err != nil {
+				if !isDone(ctx) {
+					conn.logger.Warn("failed to send PingRequest", zap.Error(err))
+					conn.Close()
+				}
+				return
+			}
+		}
+	}
+}
+
+func (conn *defaultConn) onPingResponse(pingResponse PingResponse) {
+	atomic.StoreInt64(&conn.pingSentAt, 0)
+	d := TimestampDiff(conn.Timestamp(), pingResponse.Timestamp())
+	if d < 0 {
+		// not a timestamp we sent
+		return
+	}
+	atomic.StoreInt64(&conn.rtt, int64(time.Duration(d)*time.Millisecond))
+	connMetrics(conn).RTT(time.Duration(d) * time.Millisecond)
+}
+
+func (conn *defaultConn) extendReadDeadline() error {
+	if conn.readIdleTimeout <= 0 {
+		return nil
+	}
+	return conn.conn.SetReadDeadline(time.Now().Add(conn.readIdleTimeout))
+}
+
+func isTimeout(err error) bool {
+	e, ok := errors.Cause(err).(net.Error)
+	return ok && e.Timeout()
+}
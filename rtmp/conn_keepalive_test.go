@@ -0,0 +1,112 @@
+package rtmp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hori-ryota/go-rtmp/rtmp/handshake"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func serveWithSilentClient(t *testing.T, connOps ...ConnOption) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s, c := net.Pipe()
+	defer c.Close()
+	server := NewDefaultConn(ctx, s, true, zap.NewNop(), connOps...)
+	defer server.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve()
+	}()
+
+	cw := bufio.NewWriter(c)
+	if err := handshake.NewDefaultHandshaker(false).Handshake(ctx, c, cw); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(ioutil.Discard, c)
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		t.Fatal("Serve did not return")
+		return nil
+	}
+}
+
+func TestDefaultConn_ReadIdleTimeout(t *testing.T) {
+	err := serveWithSilentClient(t, WithReadIdleTimeout(50*time.Millisecond))
+	assert.True(t, IsConnFatalError(err))
+}
+
+func TestDefaultConn_ReadIdleTimeoutSlowMessage(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s, c := net.Pipe()
+	defer c.Close()
+	server := NewDefaultConn(ctx, s, true, zap.NewNop(), WithReadIdleTimeout(50*time.Millisecond))
+	defer server.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve()
+	}()
+
+	cw := bufio.NewWriter(c)
+	if err := handshake.NewDefaultHandshaker(false).Handshake(ctx, c, cw); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(ioutil.Discard, c)
+
+	// a SetChunkSize message arriving a byte at a time takes longer than the
+	// timeout, but no byte is late
+	setChunkSize := []byte{0x02, 0, 0, 0, 0, 0, 4, byte(MessageTypeIDSetChunkSize), 0, 0, 0, 0, 0, 0, 0x10, 0}
+	for _, b := range setChunkSize {
+		if _, err := c.Write([]byte{b}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-errc:
+			t.Fatalf("Serve returned while the peer was sending: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	select {
+	case err := <-errc:
+		assert.True(t, IsConnFatalError(err))
+	case <-ctx.Done():
+		t.Fatal("Serve did not return")
+	}
+}
+
+func TestDefaultConn_PingTimeout(t *testing.T) {
+	err := serveWithSilentClient(
+		t,
+		WithPingInterval(10*time.Millisecond),
+		WithPingTimeout(30*time.Millisecond),
+	)
+	assert.NoError(t, err)
+}
+
+func TestDefaultConn_onPingResponse(t *testing.T) {
+	conn := &defaultConn{timestampPoint: time.Now().Add(-time.Second)}
+	conn.pingSentAt = time.Now().UnixNano()
+
+	conn.onPingResponse(NewPingResponse(900))
+	assert.InDelta(t, int64(100*time.Millisecond), int64(conn.Stats().RTT), float64(20*time.Millisecond))
+	assert.Zero(t, conn.pingSentAt)
+
+	conn.onPingResponse(NewPingResponse(2000))
+	assert.InDelta(t, int64(100*time.Millisecond), int64(conn.Stats().RTT), float64(20*time.Millisecond))
+}
@@ -15,6 +15,24 @@ func (conn *defaultConn) DefaultNetConnectionCommandHandler() NetConnectionComma
 					"OnConnect",
 					zap.Object("connect", connect),
 				)
+				params, err := ParseConnectParams(connect)
+				if err != nil {
+					if err := conn.ConnectError(ctx, nil,
+						NewStatus(StatusCodeNetConnectionConnectRejected).
+							WithDescription("invalid connect parameters").
+							InfoObject(),
+					); err != nil {
+						return NewConnFatalError(
+							errors.Wrap(err, "failed to ConnectError"),
+							zap.Object("connect", connect),
+						)
+					}
+					return NewConnRejectedError(
+						errors.Wrap(err, "invalid connect parameters"),
+						zap.Object("connect", connect),
+					)
+				}
+				conn.setConnectParams(params)
 				for _, v := range conn.onConnectValidators {
 					if onConnectError := v(ctx, connect); onConnectError != nil {
 						if err := conn.ConnectError(ctx, onConnectError.Properties(), onConnectError.Information()); err != nil {
@@ -47,11 +65,16 @@ func (conn *defaultConn) DefaultNetConnectionCommandHandler() NetConnectionComma
 						zap.Object("connect", connect),
 					)
 				}
-				if err := conn.ConnectResult(ctx, nil, map[string]interface{}{
-					"code":        "NetConnection.Connect.Success",
-					"level":       "status",
-					"description": "Connection Succeeded",
-				}); err != nil {
+				// replies from here on use the object encoding the client asked for
+				conn.setObjectEncoding(params.ObjectEncoding)
+				if err := conn.ConnectResult(ctx, map[string]interface{}{
+					"fmsVer":       fmsVer,
+					"capabilities": float64(fmsCapabilities),
+					"mode":         float64(1),
+				}, NewStatus(StatusCodeNetConnectionConnectSuccess).
+					With("objectEncoding", float64(params.ObjectEncoding)).
+					InfoObject(),
+				); err != nil {
 					return NewConnFatalError(
 						errors.Wrap(err, "failed to ConnectResult"),
 						zap.Object("connect", connect),
@@ -67,7 +90,10 @@ func (conn *defaultConn) DefaultNetConnectionCommandHandler() NetConnectionComma
 					"OnConnectResult",
 					zap.Object("connectResult", connectResult),
 				)
-				return nil
+				if EncodingAMFType(numberProperty(connectResult.Information(), "objectEncoding")) == EncodingAMFTypeAMF3 {
+					conn.setObjectEncoding(EncodingAMFTypeAMF3)
+				}
+				return conn.callConnectCallbacks(connectResult)
 			}),
 		},
 
@@ -77,7 +103,7 @@ func (conn *defaultConn) DefaultNetConnectionCommandHandler() NetConnectionComma
 					"OnConnectError",
 					zap.Object("connectError", connectError),
 				)
-				return nil
+				return conn.callConnectCallbacks(connectError)
 			}),
 		},
 
@@ -113,8 +139,20 @@ func (conn *defaultConn) DefaultNetConnectionCommandHandler() NetConnectionComma
 
 		CreateStreamHandlers: []CreateStreamHandler{
 			CreateStreamHandlerFunc(func(ctx context.Context, createStream CreateStream) ConnError {
-				chunkStreamID := conn.Reader().CreateStream()
-				if err := conn.CreateStreamResult(ctx, createStream.TransactionID(), createStream.CommandObject(), chunkStreamID); err != nil {
+				messageStreamID, err := conn.messageStreams.Create()
+				if err != nil {
+					if err := conn.CreateStreamError(ctx, createStream.TransactionID(), createStream.CommandObject(), 0); err != nil {
+						return NewConnFatalError(
+							errors.Wrap(err, "failed to CreateStreamError"),
+							zap.Object("createStream", createStream),
+						)
+					}
+					return NewConnWarnError(
+						errors.Wrap(err, "failed to create message stream"),
+						zap.Object("createStream", createStream),
+					)
+				}
+				if err := conn.CreateStreamResult(ctx, createStream.TransactionID(), createStream.CommandObject(), messageStreamID); err != nil {
 					return NewConnFatalError(
 						errors.Wrap(err, "failed to CreateStreamResult"),
 						zap.Object("createStream", createStream),
@@ -130,6 +168,13 @@ func (conn *defaultConn) DefaultNetConnectionCommandHandler() NetConnectionComma
 					"OnCreateStreamResult",
 					zap.Object("createStreamResult", createStreamResult),
 				)
+				if err := conn.messageStreams.Register(createStreamResult.StreamID()); err != nil {
+					delete(conn.createStreamCallbacks, createStreamResult.TransactionID())
+					return NewConnWarnError(
+						errors.Wrap(err, "failed to register message stream"),
+						zap.Object("createStreamResult", createStreamResult),
+					)
+				}
 				var warnError ConnError
 				if f, ok := conn.createStreamCallbacks[createStreamResult.TransactionID()]; ok {
 					if err := f(createStreamResult); err != nil {
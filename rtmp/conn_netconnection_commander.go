@@ -8,20 +8,15 @@ import (
 )
 
 func (conn *defaultConn) Connect(ctx context.Context, commandObject map[string]interface{}, optionalUserArguments map[string]interface{}) error {
-	p := NewConnect(commandObject, optionalUserArguments, conn.encodingAMFType)
+	p := NewConnect(commandObject, optionalUserArguments, EncodingAMFTypeAMF0)
 	b, err := p.MarshalBinary()
 	if err != nil {
 		return errors.Wrap(err, "failed to MarshalBinary")
 	}
-	var msgTypeID MessageTypeID
-	if conn.encodingAMFType == EncodingAMFTypeAMF0 {
-		msgTypeID = MessageTypeIDCommandAMF0
-	} else {
-		msgTypeID = MessageTypeIDCommandAMF3
-	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
 
 	m := NewMessage(
-		3,
+		ChunkStreamIDFor(msgTypeID, 0),
 		msgTypeID,
 		conn.Timestamp(),
 		0,
@@ -39,20 +34,15 @@ func (conn *defaultConn) Connect(ctx context.Context, commandObject map[string]i
 }
 
 func (conn *defaultConn) ConnectResult(ctx context.Context, properties map[string]interface{}, information map[string]interface{}) error {
-	p := NewConnectResult(properties, information, conn.encodingAMFType)
+	p := NewConnectResult(properties, information, EncodingAMFTypeAMF0)
 	b, err := p.MarshalBinary()
 	if err != nil {
 		return errors.Wrap(err, "failed to MarshalBinary")
 	}
-	var msgTypeID MessageTypeID
-	if conn.encodingAMFType == EncodingAMFTypeAMF0 {
-		msgTypeID = MessageTypeIDCommandAMF0
-	} else {
-		msgTypeID = MessageTypeIDCommandAMF3
-	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
 
 	m := NewMessage(
-		3,
+		ChunkStreamIDFor(msgTypeID, 0),
 		msgTypeID,
 		conn.Timestamp(),
 		0,
@@ -69,20 +59,15 @@ func (conn *defaultConn) ConnectResult(ctx context.Context, properties map[strin
 }
 
 func (conn *defaultConn) ConnectError(ctx context.Context, properties map[string]interface{}, information map[string]interface{}) error {
-	p := NewConnectError(properties, information, conn.encodingAMFType)
+	p := NewConnectError(properties, information, EncodingAMFTypeAMF0)
 	b, err := p.MarshalBinary()
 	if err != nil {
 		return errors.Wrap(err, "failed to MarshalBinary")
 	}
-	var msgTypeID MessageTypeID
-	if conn.encodingAMFType == EncodingAMFTypeAMF0 {
-		msgTypeID = MessageTypeIDCommandAMF0
-	} else {
-		msgTypeID = MessageTypeIDCommandAMF3
-	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
 
 	m := NewMessage(
-		3,
+		ChunkStreamIDFor(msgTypeID, 0),
 		msgTypeID,
 		conn.Timestamp(),
 		0,
@@ -99,28 +84,65 @@ func (conn *defaultConn) ConnectError(ctx context.Context, properties map[string
 }
 
 func (conn *defaultConn) Call(ctx context.Context, procedureName string, transactionID uint32, commandObject map[string]interface{}, optionalArguments map[string]interface{}) error {
-	panic("not implemented")
+	p := NewCall(procedureName, transactionID, commandObject, optionalArguments, EncodingAMFTypeAMF0)
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return errors.Wrap(err, "failed to MarshalBinary")
+	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
+
+	m := NewMessage(
+		ChunkStreamIDFor(msgTypeID, 0),
+		msgTypeID,
+		conn.Timestamp(),
+		0,
+		b,
+	)
+	_, err = conn.Writer().WriteMessage(m)
+	if err != nil {
+		return errors.Wrap(err, "failed to WriteMessage")
+	}
+	if err := conn.Writer().Flush(); err != nil {
+		return errors.Wrap(err, "failed to Flush Writer")
+	}
+	return nil
 }
 
 func (conn *defaultConn) CallResponse(ctx context.Context, commandName string, transactionID uint32, commandObject map[string]interface{}, response map[string]interface{}) error {
-	panic("not implemented")
+	p := NewCallResponse(commandName, transactionID, commandObject, response, EncodingAMFTypeAMF0)
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return errors.Wrap(err, "failed to MarshalBinary")
+	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
+
+	m := NewMessage(
+		ChunkStreamIDFor(msgTypeID, 0),
+		msgTypeID,
+		conn.Timestamp(),
+		0,
+		b,
+	)
+	_, err = conn.Writer().WriteMessage(m)
+	if err != nil {
+		return errors.Wrap(err, "failed to WriteMessage")
+	}
+	if err := conn.Writer().Flush(); err != nil {
+		return errors.Wrap(err, "failed to Flush Writer")
+	}
+	return nil
 }
 
 func (conn *defaultConn) CreateStream(ctx context.Context, transactionID uint32, commandObject map[string]interface{}) error {
-	p := NewCreateStream(transactionID, commandObject, conn.encodingAMFType)
+	p := NewCreateStream(transactionID, commandObject, EncodingAMFTypeAMF0)
 	b, err := p.MarshalBinary()
 	if err != nil {
 		return errors.Wrap(err, "failed to MarshalBinary")
 	}
-	var msgTypeID MessageTypeID
-	if conn.encodingAMFType == EncodingAMFTypeAMF0 {
-		msgTypeID = MessageTypeIDCommandAMF0
-	} else {
-		msgTypeID = MessageTypeIDCommandAMF3
-	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
 
 	m := NewMessage(
-		3,
+		ChunkStreamIDFor(msgTypeID, 0),
 		msgTypeID,
 		conn.Timestamp(),
 		0,
@@ -137,20 +159,15 @@ func (conn *defaultConn) CreateStream(ctx context.Context, transactionID uint32,
 }
 
 func (conn *defaultConn) CreateStreamResult(ctx context.Context, transactionID uint32, commandObject map[string]interface{}, streamID uint32) error {
-	p := NewCreateStreamResult(transactionID, commandObject, streamID, conn.encodingAMFType)
+	p := NewCreateStreamResult(transactionID, commandObject, streamID, EncodingAMFTypeAMF0)
 	b, err := p.MarshalBinary()
 	if err != nil {
 		return errors.Wrap(err, "failed to MarshalBinary")
 	}
-	var msgTypeID MessageTypeID
-	if conn.encodingAMFType == EncodingAMFTypeAMF0 {
-		msgTypeID = MessageTypeIDCommandAMF0
-	} else {
-		msgTypeID = MessageTypeIDCommandAMF3
-	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
 
 	m := NewMessage(
-		3,
+		ChunkStreamIDFor(msgTypeID, 0),
 		msgTypeID,
 		conn.Timestamp(),
 		0,
@@ -167,20 +184,15 @@ func (conn *defaultConn) CreateStreamResult(ctx context.Context, transactionID u
 }
 
 func (conn *defaultConn) CreateStreamError(ctx context.Context, transactionID uint32, commandObject map[string]interface{}, streamID uint32) error {
-	p := NewCreateStreamError(transactionID, commandObject, streamID, conn.encodingAMFType)
+	p := NewCreateStreamError(transactionID, commandObject, streamID, EncodingAMFTypeAMF0)
 	b, err := p.MarshalBinary()
 	if err != nil {
 		return errors.Wrap(err, "failed to MarshalBinary")
 	}
-	var msgTypeID MessageTypeID
-	if conn.encodingAMFType == EncodingAMFTypeAMF0 {
-		msgTypeID = MessageTypeIDCommandAMF0
-	} else {
-		msgTypeID = MessageTypeIDCommandAMF3
-	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
 
 	m := NewMessage(
-		3,
+		ChunkStreamIDFor(msgTypeID, 0),
 		msgTypeID,
 		conn.Timestamp(),
 		0,
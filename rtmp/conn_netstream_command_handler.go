@@ -18,6 +18,21 @@ func (conn *defaultConn) DefaultNetStreamCommandHandler() NetStreamCommandHandle
 					zap.Uint32("messageStreamID", messageStreamID),
 				)
 				warnErrors := make([]error, 0, len(conn.netStreamCommandCallbacks))
+				if len(conn.statusHandlers) > 0 {
+					status, err := ParseOnStatus(onStatus)
+					if err != nil {
+						return NewConnWarnError(err, zap.Object("onStatus", onStatus))
+					}
+					for _, f := range conn.statusHandlers {
+						if err := f(ctx, messageStreamID, status); err != nil {
+							if IsConnWarnError(err) {
+								warnErrors = append(warnErrors, err)
+							} else {
+								return err
+							}
+						}
+					}
+				}
 				for _, f := range conn.netStreamCommandCallbacks {
 					if err := f(onStatus); err != nil {
 						if IsConnWarnError(err) {
@@ -46,6 +61,70 @@ func (conn *defaultConn) DefaultNetStreamCommandHandler() NetStreamCommandHandle
 					zap.Uint32("chunkStreamID", chunkStreamID),
 					zap.Uint32("messageStreamID", messageStreamID),
 				)
+				if _, ok := conn.messageStreams.Get(messageStreamID); !ok {
+					if err := conn.OnStatus(
+						ctx,
+						ChunkStreamIDFor(MessageTypeIDCommandAMF0, messageStreamID),
+						messageStreamID,
+						NewStatus(StatusCodeNetStreamPlayStreamNotFound).
+							WithDescription("unknown stream").
+							WithDetails(play.StreamName()).
+							InfoObject(),
+					); err != nil {
+						return NewConnFatalError(
+							errors.Wrap(err, "failed to OnStatus"),
+							zap.Object("play", play),
+						)
+					}
+					return NewConnWarnError(
+						errors.New("play on unknown message stream"),
+						zap.Object("play", play),
+						zap.Uint32("messageStreamID", messageStreamID),
+					)
+				}
+				name, onPlayError := validateStream(ctx, play.StreamName(), StatusCodeNetStreamPlayStreamNotFound, func(ctx context.Context, name string) map[string]interface{} {
+					p := play
+					if name != play.StreamName() {
+						p = NewPlay(name, play.Start(), play.Duration(), play.Reset(), play.EncodingAMFType())
+					}
+					for _, v := range conn.onPlayValidators {
+						if onPlayError := v(ctx, p); onPlayError != nil {
+							return onPlayError
+						}
+					}
+					return nil
+				})
+				var err error
+				if onPlayError == nil {
+					err = conn.messageStreams.SetPlaying(messageStreamID, name)
+					if e, ok := err.(*streamAdmissionError); ok {
+						onPlayError = e.errorInfo
+					}
+				}
+				if onPlayError != nil {
+					if err := conn.OnStatus(
+						ctx,
+						ChunkStreamIDFor(MessageTypeIDCommandAMF0, messageStreamID),
+						messageStreamID,
+						onPlayError,
+					); err != nil {
+						return NewConnFatalError(
+							errors.Wrap(err, "failed to OnStatus"),
+							zap.Object("play", play),
+						)
+					}
+					return NewConnRejectedError(
+						errors.New("play request is rejected"),
+						zap.Object("play", play),
+						zap.Any("playError", onPlayError),
+					)
+				}
+				if err != nil {
+					return NewConnWarnError(
+						errors.Wrap(err, "failed to play"),
+						zap.Object("play", play),
+					)
+				}
 				return nil
 			}),
 		},
@@ -70,6 +149,7 @@ func (conn *defaultConn) DefaultNetStreamCommandHandler() NetStreamCommandHandle
 					zap.Uint32("chunkStreamID", chunkStreamID),
 					zap.Uint32("messageStreamID", messageStreamID),
 				)
+				conn.messageStreams.Delete(deleteStream.StreamID())
 				return nil
 			}),
 		},
@@ -82,6 +162,12 @@ func (conn *defaultConn) DefaultNetStreamCommandHandler() NetStreamCommandHandle
 					zap.Uint32("chunkStreamID", chunkStreamID),
 					zap.Uint32("messageStreamID", messageStreamID),
 				)
+				if err := conn.messageStreams.SetIdle(messageStreamID); err != nil {
+					return NewConnWarnError(
+						errors.Wrap(err, "failed to closeStream"),
+						zap.Object("closeStream", closeStream),
+					)
+				}
 				return nil
 			}),
 		},
@@ -118,27 +204,70 @@ func (conn *defaultConn) DefaultNetStreamCommandHandler() NetStreamCommandHandle
 					zap.Uint32("chunkStreamID", chunkStreamID),
 					zap.Uint32("messageStreamID", messageStreamID),
 				)
-				for _, v := range conn.onPublishValidators {
-					if onPublishError := v(ctx, publish); onPublishError != nil {
-						if err := conn.OnStatus(
-							ctx,
-							chunkStreamID,
-							messageStreamID,
-							onPublishError,
-						); err != nil {
-							return NewConnFatalError(
-								errors.Wrap(err, "failed to OnStatus"),
-								zap.Object("publish", publish),
-							)
+				if _, ok := conn.messageStreams.Get(messageStreamID); !ok {
+					if err := conn.OnStatus(
+						ctx,
+						ChunkStreamIDFor(MessageTypeIDCommandAMF0, messageStreamID),
+						messageStreamID,
+						NewStatus(StatusCodeNetStreamPublishFailed).
+							WithDescription("unknown stream").
+							InfoObject(),
+					); err != nil {
+						return NewConnFatalError(
+							errors.Wrap(err, "failed to OnStatus"),
+							zap.Object("publish", publish),
+						)
+					}
+					return NewConnWarnError(
+						errors.New("publish on unknown message stream"),
+						zap.Object("publish", publish),
+						zap.Uint32("messageStreamID", messageStreamID),
+					)
+				}
+				name, onPublishError := validateStream(ctx, publish.PublishingName(), StatusCodeNetStreamPublishBadName, func(ctx context.Context, name string) map[string]interface{} {
+					p := publish
+					if name != publish.PublishingName() {
+						p = NewPublish(name, publish.PublishingType(), publish.EncodingAMFType())
+					}
+					for _, v := range conn.onPublishValidators {
+						if onPublishError := v(ctx, p); onPublishError != nil {
+							return onPublishError
 						}
-						return NewConnRejectedError(
-							errors.New("publish request is rejected"),
+					}
+					return nil
+				})
+				var err error
+				if onPublishError == nil {
+					err = conn.messageStreams.SetPublishing(messageStreamID, name, publish.PublishingType())
+					if e, ok := err.(*streamAdmissionError); ok {
+						onPublishError = e.errorInfo
+					}
+				}
+				if onPublishError != nil {
+					if err := conn.OnStatus(
+						ctx,
+						ChunkStreamIDFor(MessageTypeIDCommandAMF0, messageStreamID),
+						messageStreamID,
+						onPublishError,
+					); err != nil {
+						return NewConnFatalError(
+							errors.Wrap(err, "failed to OnStatus"),
 							zap.Object("publish", publish),
-							zap.Any("publishError", onPublishError),
 						)
 					}
+					return NewConnRejectedError(
+						errors.New("publish request is rejected"),
+						zap.Object("publish", publish),
+						zap.Any("publishError", onPublishError),
+					)
+				}
+				if err != nil {
+					return NewConnWarnError(
+						errors.Wrap(err, "failed to publish"),
+						zap.Object("publish", publish),
+					)
 				}
-				if err := conn.StreamBegin(ctx, chunkStreamID); err != nil {
+				if err := conn.StreamBegin(ctx, messageStreamID); err != nil {
 					return NewConnFatalError(
 						errors.Wrap(err, "failed to StreamBegin"),
 						zap.Object("publish", publish),
@@ -146,12 +275,11 @@ func (conn *defaultConn) DefaultNetStreamCommandHandler() NetStreamCommandHandle
 				}
 				if err := conn.OnStatus(
 					ctx,
-					chunkStreamID,
+					ChunkStreamIDFor(MessageTypeIDCommandAMF0, messageStreamID),
 					messageStreamID,
-					map[string]interface{}{
-						"level": "status",
-						"code":  "NetStream.Publish.Start",
-					},
+					NewStatus(StatusCodeNetStreamPublishStart).
+						WithDetails(name).
+						InfoObject(),
 				); err != nil {
 					return NewConnFatalError(
 						errors.Wrap(err, "failed to OnStatus"),
@@ -187,3 +315,48 @@ func (conn *defaultConn) DefaultNetStreamCommandHandler() NetStreamCommandHandle
 		},
 	}
 }
+
+type streamRedirectContextKey struct{}
+
+// RedirectStream makes the publish or play validated with ctx use name
+// instead of the stream name the peer asked for. The validators then run
+// again with name, so that they and the routes of a StreamMux see the
+// stream the peer gets; redirecting again in that run is refused. It
+// reports false when ctx is not the context of a publish or play validator.
+func RedirectStream(ctx context.Context, name string) bool {
+	p, ok := ctx.Value(streamRedirectContextKey{}).(*string)
+	if !ok {
+		return false
+	}
+	*p = name
+	return true
+}
+
+// validateStream runs validate with name and, when it redirects the stream,
+// once more with the new name. A redirect in the second run is refused with
+// refused.
+func validateStream(
+	ctx context.Context,
+	name string,
+	refused StatusCode,
+	validate func(ctx context.Context, name string) map[string]interface{},
+) (string, map[string]interface{}) {
+	redirected := name
+	if errorInfo := validate(context.WithValue(ctx, streamRedirectContextKey{}, &redirected), name); errorInfo != nil {
+		return name, errorInfo
+	}
+	if redirected == name {
+		return name, nil
+	}
+	name = redirected
+	if errorInfo := validate(context.WithValue(ctx, streamRedirectContextKey{}, &redirected), name); errorInfo != nil {
+		return name, errorInfo
+	}
+	if redirected != name {
+		return name, NewStatus(refused).
+			WithDescription("stream is redirected more than once").
+			WithDetails(name).
+			InfoObject()
+	}
+	return name, nil
+}
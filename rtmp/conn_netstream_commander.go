@@ -7,17 +7,12 @@ import (
 )
 
 func (conn *defaultConn) OnStatus(ctx context.Context, chunkStreamID uint32, messageStreamID uint32, infoObject map[string]interface{}) error {
-	p := NewOnStatus(infoObject, conn.encodingAMFType)
+	p := NewOnStatus(infoObject, EncodingAMFTypeAMF0)
 	b, err := p.MarshalBinary()
 	if err != nil {
 		return errors.Wrap(err, "failed to MarshalBinary")
 	}
-	var msgTypeID MessageTypeID
-	if conn.encodingAMFType == EncodingAMFTypeAMF0 {
-		msgTypeID = MessageTypeIDCommandAMF0
-	} else {
-		msgTypeID = MessageTypeIDCommandAMF3
-	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
 
 	m := NewMessage(
 		chunkStreamID,
@@ -61,17 +56,16 @@ func (conn *defaultConn) ReceiveVideo(ctx context.Context, chunkStreamID uint32,
 }
 
 func (conn *defaultConn) Publish(ctx context.Context, chunkStreamID uint32, messageStreamID uint32, publishingName string, publishingType PublishingType) error {
-	p := NewPublish(publishingName, publishingType, conn.encodingAMFType)
+	conn.startFirstMedia(conn.ctx, messageStreamID,
+		SpanAttribute{Key: SpanAttributeMessageStreamID, Value: messageStreamID},
+		SpanAttribute{Key: SpanAttributeStream, Value: withoutQuery(publishingName)},
+	)
+	p := NewPublish(publishingName, publishingType, EncodingAMFTypeAMF0)
 	b, err := p.MarshalBinary()
 	if err != nil {
 		return errors.Wrap(err, "failed to MarshalBinary")
 	}
-	var msgTypeID MessageTypeID
-	if conn.encodingAMFType == EncodingAMFTypeAMF0 {
-		msgTypeID = MessageTypeIDCommandAMF0
-	} else {
-		msgTypeID = MessageTypeIDCommandAMF3
-	}
+	msgTypeID, b := FrameCommand(conn.ObjectEncoding(), b)
 
 	m := NewMessage(
 		chunkStreamID,
@@ -2,10 +2,21 @@ package rtmp
 
 import (
 	"context"
+	"time"
+
+	"github.com/hori-ryota/go-rtmp/rtmp/handshake"
 )
 
 type connOptions struct {
 	connInitializers []func(Conn)
+	readerOptions    []ReaderOption
+	handshaker       handshake.Handshaker
+
+	maxMessageStreams int
+
+	pingInterval    time.Duration
+	pingTimeout     time.Duration
+	readIdleTimeout time.Duration
 
 	onConnectValidators []func(
 		ctx context.Context,
@@ -16,6 +27,40 @@ type connOptions struct {
 		ctx context.Context,
 		publish Publish,
 	) (errorInfo map[string]interface{})
+
+	onPlayValidators []func(
+		ctx context.Context,
+		play Play,
+	) (errorInfo map[string]interface{})
+
+	statusHandlers []func(
+		ctx context.Context,
+		messageStreamID uint32,
+		status Status,
+	) ConnError
+
+	onStreamDoneHandlers []func(
+		ctx context.Context,
+		stream MessageStream,
+	)
+
+	metrics Metrics
+	tracer  Tracer
+
+	streamAdmission streamAdmission
+}
+
+// streamAdmission admits the streams of a connection when they start
+// publishing or playing.
+type streamAdmission interface {
+	admitStream(conn Conn, stream MessageStream) (errorInfo map[string]interface{})
+	releaseStream(conn Conn, stream MessageStream)
+}
+
+func withStreamAdmission(a streamAdmission) ConnOption {
+	return func(o *connOptions) {
+		o.streamAdmission = a
+	}
 }
 
 type ConnOption func(*connOptions)
@@ -38,13 +83,111 @@ func WithOnPublishValidators(onPublishValidators ...func(ctx context.Context, pu
 	}
 }
 
+func WithOnPlayValidators(onPlayValidators ...func(ctx context.Context, play Play) (errorInfo map[string]interface{})) ConnOption {
+	return func(o *connOptions) {
+		o.onPlayValidators = append(o.onPlayValidators, onPlayValidators...)
+	}
+}
+
+// WithOnStreamDoneHandlers calls onStreamDoneHandlers when a message
+// stream stops publishing or playing, by closeStream, deleteStream, another
+// publish or play, or the connection closing. ctx may be done already.
+func WithOnStreamDoneHandlers(onStreamDoneHandlers ...func(ctx context.Context, stream MessageStream)) ConnOption {
+	return func(o *connOptions) {
+		o.onStreamDoneHandlers = append(o.onStreamDoneHandlers, onStreamDoneHandlers...)
+	}
+}
+
+// WithStatusHandlers calls statusHandlers with every onStatus received
+// from the peer, parsed into a Status.
+func WithStatusHandlers(statusHandlers ...func(ctx context.Context, messageStreamID uint32, status Status) ConnError) ConnOption {
+	return func(o *connOptions) {
+		o.statusHandlers = append(o.statusHandlers, statusHandlers...)
+	}
+}
+
+func WithReaderOptions(readerOptions ...ReaderOption) ConnOption {
+	return func(o *connOptions) {
+		o.readerOptions = append(o.readerOptions, readerOptions...)
+	}
+}
+
+// WithHandshaker replaces the handshaker, which defaults to the complex
+// handshake falling back to the simple one.
+func WithHandshaker(handshaker handshake.Handshaker) ConnOption {
+	return func(o *connOptions) {
+		o.handshaker = handshaker
+	}
+}
+
+// WithMaxMessageStreams limits the number of message streams a peer may
+// create with createStream. A negative value means unlimited.
+func WithMaxMessageStreams(maxMessageStreams int) ConnOption {
+	return func(o *connOptions) {
+		o.maxMessageStreams = maxMessageStreams
+	}
+}
+
+// WithPingInterval sends a PingRequest every pingInterval to keep the
+// connection alive and measure its round-trip time. Zero disables keepalive.
+func WithPingInterval(pingInterval time.Duration) ConnOption {
+	return func(o *connOptions) {
+		o.pingInterval = pingInterval
+	}
+}
+
+// WithPingTimeout closes the connection when a PingRequest stays unanswered
+// for longer than pingTimeout. It has no effect without WithPingInterval.
+func WithPingTimeout(pingTimeout time.Duration) ConnOption {
+	return func(o *connOptions) {
+		o.pingTimeout = pingTimeout
+	}
+}
+
+// WithReadIdleTimeout closes the connection when nothing is read from the
+// peer for readIdleTimeout. Zero disables the timeout.
+func WithReadIdleTimeout(readIdleTimeout time.Duration) ConnOption {
+	return func(o *connOptions) {
+		o.readIdleTimeout = readIdleTimeout
+	}
+}
+
 func (o connOptions) Apply(c *defaultConn) {
+	if o.handshaker != nil {
+		c.handshaker = o.handshaker
+	}
+	if o.maxMessageStreams != 0 {
+		c.messageStreams.maxStreams = o.maxMessageStreams
+	}
+	c.pingInterval = o.pingInterval
+	c.pingTimeout = o.pingTimeout
+	c.readIdleTimeout = o.readIdleTimeout
 	if len(o.onConnectValidators) > 0 {
 		c.onConnectValidators = o.onConnectValidators
 	}
 	if len(o.onPublishValidators) > 0 {
 		c.onPublishValidators = o.onPublishValidators
 	}
+	if len(o.onPlayValidators) > 0 {
+		c.onPlayValidators = o.onPlayValidators
+	}
+	c.statusHandlers = o.statusHandlers
+	handlers := o.onStreamDoneHandlers
+	c.messageStreams.onDone = func(stream MessageStream) {
+		c.endStreamMeter(stream)
+		c.endFirstMedia(stream.ID, errNoMedia)
+		for _, h := range handlers {
+			h(c.ctx, stream)
+		}
+	}
+	if a := o.streamAdmission; a != nil {
+		c.messageStreams.admit = func(stream MessageStream) map[string]interface{} {
+			return a.admitStream(c, stream)
+		}
+		c.messageStreams.release = func(stream MessageStream) {
+			a.releaseStream(c, stream)
+		}
+	}
 	for _, f := range o.connInitializers {
 		f(c)
 	}
@@ -36,6 +36,7 @@ func (conn *defaultConn) DefaultProtocolControlEventHandler() ProtocolControlEve
 					"OnAcknowledgement",
 					zap.Object("acknowledgement", acknowledgement),
 				)
+				connMetrics(conn).AcknowledgementReceived()
 				return nil
 			}),
 		},
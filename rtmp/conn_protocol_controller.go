@@ -14,7 +14,7 @@ func (conn *defaultConn) SetChunkSize(ctx context.Context, chunkSize uint32) err
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDSetChunkSize,
 		conn.Timestamp(),
 		0,
@@ -39,7 +39,7 @@ func (conn *defaultConn) AbortMessage(ctx context.Context, chunkStreamID uint32)
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDAbortMessage,
 		conn.Timestamp(),
 		0,
@@ -63,7 +63,7 @@ func (conn *defaultConn) Acknowledgement(ctx context.Context, sequenceNumber uin
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDAcknowledgement,
 		conn.Timestamp(),
 		0,
@@ -87,7 +87,7 @@ func (conn *defaultConn) WindowAcknowledgementSize(ctx context.Context, acknowle
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDWindowAcknowledgementSize,
 		conn.Timestamp(),
 		0,
@@ -114,7 +114,7 @@ func (conn *defaultConn) SetPeerBandwidth(ctx context.Context, acknowledgementWi
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDSetPeerBandwidth,
 		conn.Timestamp(),
 		0,
@@ -0,0 +1,26 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestConnFromContext(t *testing.T) {
+	s, c := net.Pipe()
+	defer c.Close()
+	conn := NewDefaultConn(context.Background(), s, true, zap.NewNop())
+	defer conn.Close()
+
+	got, ok := ConnFromContext(conn.Context())
+	if assert.True(t, ok) {
+		assert.Equal(t, conn, got)
+		assert.Equal(t, s.RemoteAddr(), got.RemoteAddr())
+	}
+
+	_, ok = ConnFromContext(context.Background())
+	assert.False(t, ok)
+}
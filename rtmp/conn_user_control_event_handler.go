@@ -80,6 +80,7 @@ func (conn *defaultConn) DefaultUserControlEventHandler() UserControlEventHandle
 					"OnPingResponse",
 					zap.Object("pingResponse", pingResponse),
 				)
+				conn.onPingResponse(pingResponse)
 				return nil
 			}),
 		},
@@ -14,7 +14,7 @@ func (conn *defaultConn) StreamBegin(ctx context.Context, streamID uint32) error
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDUserControlMessages,
 		conn.Timestamp(),
 		0,
@@ -38,7 +38,7 @@ func (conn *defaultConn) StreamEOF(ctx context.Context, streamID uint32) error {
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDUserControlMessages,
 		conn.Timestamp(),
 		0,
@@ -62,7 +62,7 @@ func (conn *defaultConn) StreamDry(ctx context.Context, streamID uint32) error {
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDUserControlMessages,
 		conn.Timestamp(),
 		0,
@@ -86,7 +86,7 @@ func (conn *defaultConn) SetBufferLength(ctx context.Context, streamID uint32, b
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDUserControlMessages,
 		conn.Timestamp(),
 		0,
@@ -110,7 +110,7 @@ func (conn *defaultConn) StreamIsRecorded(ctx context.Context, streamID uint32)
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDUserControlMessages,
 		conn.Timestamp(),
 		0,
@@ -134,7 +134,7 @@ func (conn *defaultConn) PingRequest(ctx context.Context, timestamp uint32) erro
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDUserControlMessages,
 		conn.Timestamp(),
 		0,
@@ -158,7 +158,7 @@ func (conn *defaultConn) PingResponse(ctx context.Context, timestamp uint32) err
 	}
 
 	m := NewMessage(
-		2,
+		controlChunkStreamID,
 		MessageTypeIDUserControlMessages,
 		conn.Timestamp(),
 		0,
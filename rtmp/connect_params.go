@@ -0,0 +1,223 @@
+package rtmp
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/hori-ryota/go-rtmp/rtmp/amf"
+	"github.com/pkg/errors"
+)
+
+// ConnectParams is a typed view of the command object of connect.
+type ConnectParams struct {
+	App      string
+	FlashVer string
+	SwfURL   string
+	PageURL  string
+	Fpad     bool
+
+	// TcURL is the URL the client connected to. Scheme, Host, Port and Path
+	// are parsed from it, e.g. "rtmp", "example.com", 1935 and "live/room"
+	// for rtmp://example.com/live/room.
+	TcURL  string
+	Scheme string
+	Host   string
+	Port   int
+	Path   string
+	// Query holds the query parameters of tcUrl and of app.
+	Query url.Values
+
+	AudioCodecs   []AudioCodecFlag
+	VideoCodecs   []VideoCodecFlag
+	VideoFunction []VideoFunctionFlag
+
+	// ObjectEncoding is the AMF version the client asked to use.
+	ObjectEncoding EncodingAMFType
+}
+
+// connectCommandObject is the command object of connect.
+type connectCommandObject struct {
+	App            string          `amf:"app"`
+	FlashVer       string          `amf:"flashVer,omitempty"`
+	SwfURL         string          `amf:"swfUrl,omitempty"`
+	TcURL          string          `amf:"tcUrl"`
+	Fpad           bool            `amf:"fpad"`
+	Capabilities   float64         `amf:"capabilities,omitempty"`
+	AudioCodecs    uint32          `amf:"audioCodecs"`
+	VideoCodecs    uint32          `amf:"videoCodecs"`
+	VideoFunction  uint32          `amf:"videoFunction"`
+	PageURL        string          `amf:"pageUrl,omitempty"`
+	ObjectEncoding EncodingAMFType `amf:"objectEncoding"`
+}
+
+var (
+	audioCodecFlags = []AudioCodecFlag{
+		AudioCodecFlagNone,
+		AudioCodecFlagAdpcm,
+		AudioCodecFlagMp3,
+		AudioCodecFlagIntel,
+		AudioCodecFlagUnused,
+		AudioCodecFlagNelly8,
+		AudioCodecFlagNelly,
+		AudioCodecFlagG711a,
+		AudioCodecFlagG711u,
+		AudioCodecFlagNelly16,
+		AudioCodecFlagAac,
+		AudioCodecFlagSpeex,
+	}
+	videoCodecFlags = []VideoCodecFlag{
+		VideoCodecFlagUnused,
+		VideoCodecFlagJpeg,
+		VideoCodecFlagSorenson,
+		VideoCodecFlagHomebrew,
+		VideoCodecFlagVp6,
+		VideoCodecFlagVp6alpha,
+		VideoCodecFlagHomebrewv,
+		VideoCodecFlagH264,
+	}
+	videoFunctionFlags = []VideoFunctionFlag{
+		VideoFunctionFlagClientSeek,
+	}
+
+	defaultPorts = map[string]int{
+		"rtmp":  1935,
+		"rtmpe": 1935,
+		"rtmps": 443,
+		"rtmpt": 80,
+	}
+)
+
+// ParseConnectParams reads the command object of connect. Unknown
+// properties are ignored, while a known one of the wrong type or a
+// malformed tcUrl is an error.
+func ParseConnectParams(connect Connect) (ConnectParams, error) {
+	var o connectCommandObject
+	if err := unmarshalObject(connect.CommandObject(), &o); err != nil {
+		return ConnectParams{}, errors.Wrap(err, "failed to read command object of connect")
+	}
+	p := ConnectParams{
+		FlashVer: o.FlashVer,
+		SwfURL:   o.SwfURL,
+		PageURL:  o.PageURL,
+		TcURL:    o.TcURL,
+		Fpad:     o.Fpad,
+		Query:    url.Values{},
+	}
+
+	app := o.App
+	if i := strings.Index(app, "?"); i >= 0 {
+		q, err := url.ParseQuery(app[i+1:])
+		if err != nil {
+			return p, errors.Wrapf(err, "failed to parse query of app: %s", app)
+		}
+		mergeValues(p.Query, q)
+		app = app[:i]
+	}
+	p.App = app
+
+	if p.TcURL != "" {
+		u, err := url.Parse(p.TcURL)
+		if err != nil {
+			return p, errors.Wrapf(err, "failed to parse tcUrl: %s", p.TcURL)
+		}
+		p.Scheme = u.Scheme
+		p.Host = u.Hostname()
+		p.Port = defaultPorts[u.Scheme]
+		if port := u.Port(); port != "" {
+			if p.Port, err = strconv.Atoi(port); err != nil {
+				return p, errors.Wrapf(err, "failed to parse port of tcUrl: %s", p.TcURL)
+			}
+		}
+		p.Path = strings.Trim(u.Path, "/")
+		mergeValues(p.Query, u.Query())
+	}
+
+	for _, f := range audioCodecFlags {
+		if o.AudioCodecs&uint32(f) != 0 {
+			p.AudioCodecs = append(p.AudioCodecs, f)
+		}
+	}
+	for _, f := range videoCodecFlags {
+		if o.VideoCodecs&uint32(f) != 0 {
+			p.VideoCodecs = append(p.VideoCodecs, f)
+		}
+	}
+	for _, f := range videoFunctionFlags {
+		if o.VideoFunction&uint32(f) != 0 {
+			p.VideoFunction = append(p.VideoFunction, f)
+		}
+	}
+
+	if o.ObjectEncoding == EncodingAMFTypeAMF3 {
+		p.ObjectEncoding = EncodingAMFTypeAMF3
+	}
+	return p, nil
+}
+
+func (p ConnectParams) HasAudioCodec(f AudioCodecFlag) bool {
+	for _, v := range p.AudioCodecs {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+func (p ConnectParams) HasVideoCodec(f VideoCodecFlag) bool {
+	for _, v := range p.VideoCodecs {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+func (p ConnectParams) HasVideoFunction(f VideoFunctionFlag) bool {
+	for _, v := range p.VideoFunction {
+		if v == f {
+			return true
+		}
+	}
+	return false
+}
+
+// HostPort returns the host and port of tcUrl joined for dialing.
+func (p ConnectParams) HostPort() string {
+	return net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+}
+
+func stringProperty(o map[string]interface{}, name string) string {
+	v, _ := o[name].(string)
+	return v
+}
+
+func numberProperty(o map[string]interface{}, name string) float64 {
+	switch v := o[name].(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	}
+	return 0
+}
+
+// objectProperty returns a nested object, anonymous or typed.
+func objectProperty(o map[string]interface{}, name string) map[string]interface{} {
+	switch v := o[name].(type) {
+	case map[string]interface{}:
+		return v
+	case *amf.TypedObject:
+		return v.Properties
+	}
+	return nil
+}
+
+func mergeValues(dst, src url.Values) {
+	for k, vs := range src {
+		dst[k] = append(dst[k], vs...)
+	}
+}
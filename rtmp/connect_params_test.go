@@ -0,0 +1,103 @@
+package rtmp
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConnectParams(t *testing.T) {
+	testCases := []struct {
+		name          string
+		commandObject map[string]interface{}
+		want          ConnectParams
+		wantErr       bool
+	}{
+		{
+			name: "full",
+			commandObject: map[string]interface{}{
+				"app":            "live?token=abc",
+				"flashVer":       "FMLE/3.0 (compatible; FMSc/1.0)",
+				"swfUrl":         "rtmp://example.com:1936/live",
+				"tcUrl":          "rtmp://example.com:1936/live?region=ap",
+				"fpad":           false,
+				"audioCodecs":    float64(AudioCodecFlagMp3 | AudioCodecFlagAac),
+				"videoCodecs":    float64(VideoCodecFlagH264),
+				"videoFunction":  float64(VideoFunctionFlagClientSeek),
+				"pageUrl":        "https://example.com/",
+				"objectEncoding": float64(3),
+			},
+			want: ConnectParams{
+				App:            "live",
+				FlashVer:       "FMLE/3.0 (compatible; FMSc/1.0)",
+				SwfURL:         "rtmp://example.com:1936/live",
+				PageURL:        "https://example.com/",
+				TcURL:          "rtmp://example.com:1936/live?region=ap",
+				Scheme:         "rtmp",
+				Host:           "example.com",
+				Port:           1936,
+				Path:           "live",
+				Query:          url.Values{"token": {"abc"}, "region": {"ap"}},
+				AudioCodecs:    []AudioCodecFlag{AudioCodecFlagMp3, AudioCodecFlagAac},
+				VideoCodecs:    []VideoCodecFlag{VideoCodecFlagH264},
+				VideoFunction:  []VideoFunctionFlag{VideoFunctionFlagClientSeek},
+				ObjectEncoding: EncodingAMFTypeAMF3,
+			},
+		},
+		{
+			name: "default port",
+			commandObject: map[string]interface{}{
+				"app":   "vod",
+				"tcUrl": "rtmps://example.com/vod/",
+			},
+			want: ConnectParams{
+				App:    "vod",
+				TcURL:  "rtmps://example.com/vod/",
+				Scheme: "rtmps",
+				Host:   "example.com",
+				Port:   443,
+				Path:   "vod",
+				Query:  url.Values{},
+			},
+		},
+		{
+			name: "malformed tcUrl",
+			commandObject: map[string]interface{}{
+				"tcUrl": "rtmp://example.com:port/live",
+			},
+			wantErr: true,
+		},
+		{
+			name: "mistyped tcUrl",
+			commandObject: map[string]interface{}{
+				"tcUrl": float64(1),
+			},
+			wantErr: true,
+		},
+		{
+			name: "mistyped objectEncoding",
+			commandObject: map[string]interface{}{
+				"tcUrl":          "rtmp://example.com/live",
+				"objectEncoding": "AMF3",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseConnectParams(NewConnect(tt.commandObject, nil, EncodingAMFTypeAMF0))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	p := ConnectParams{AudioCodecs: []AudioCodecFlag{AudioCodecFlagAac}, Host: "::1", Port: 1935}
+	assert.True(t, p.HasAudioCodec(AudioCodecFlagAac))
+	assert.False(t, p.HasVideoCodec(VideoCodecFlagH264))
+	assert.Equal(t, "[::1]:1935", p.HostPort())
+}
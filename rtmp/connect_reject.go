@@ -0,0 +1,43 @@
+package rtmp
+
+// ConnectRedirectCode is the ex.code of a connect rejected to redirect the
+// client to ex.redirect.
+const ConnectRedirectCode = 302
+
+// RejectConnect returns a NetConnection.Connect.Rejected error carrying the
+// application error code as ex.code. Return it from a connect validator.
+func RejectConnect(code int, description string) ConnectError {
+	return NewConnectError(nil, NewStatus(StatusCodeNetConnectionConnectRejected).
+		WithDescription(description).
+		With("ex", map[string]interface{}{
+			"code": float64(code),
+		}).
+		InfoObject(), EncodingAMFTypeAMF0)
+}
+
+// RedirectConnect returns a NetConnection.Connect.Rejected error telling
+// the client to connect to tcURL instead, e.g. "rtmp://edge2/live".
+func RedirectConnect(tcURL string, description string) ConnectError {
+	return NewConnectError(nil, NewStatus(StatusCodeNetConnectionConnectRejected).
+		WithDescription(description).
+		With("ex", map[string]interface{}{
+			"code":     float64(ConnectRedirectCode),
+			"redirect": tcURL,
+		}).
+		InfoObject(), EncodingAMFTypeAMF0)
+}
+
+// ExCode returns ex.code of a rejected connect, 0 if there is none.
+func (s Status) ExCode() int {
+	return int(numberProperty(objectProperty(s.Properties, "ex"), "code"))
+}
+
+// Redirect returns ex.redirect of a connect rejected with
+// ConnectRedirectCode.
+func (s Status) Redirect() (string, bool) {
+	if s.Code != StatusCodeNetConnectionConnectRejected || s.ExCode() != ConnectRedirectCode {
+		return "", false
+	}
+	redirect := stringProperty(objectProperty(s.Properties, "ex"), "redirect")
+	return redirect, redirect != ""
+}
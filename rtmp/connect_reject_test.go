@@ -0,0 +1,59 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func serveTest(t *testing.T, ctx context.Context, connOps ...ConnOption) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(ctx, zap.NewNop(), append(connOps, WithConnInitializers(GenerateCommonConnInitializer()))...)
+	go s.Serve(l)
+	return "rtmp://" + l.Addr().String()
+}
+
+func TestDialAndConnectRedirect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	origin := serveTest(t, ctx)
+	edge := serveTest(t, ctx, WithOnConnectValidators(func(ctx context.Context, connect Connect) ConnectError {
+		return RedirectConnect(origin+"/live", "moved")
+	}))
+	denied := serveTest(t, ctx, WithOnConnectValidators(func(ctx context.Context, connect Connect) ConnectError {
+		return RejectConnect(403, "denied")
+	}))
+
+	client := NewClient(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	defer client.Close()
+
+	_, err := client.DialAndConnect(ctx, edge+"/live", nil)
+	if e, ok := err.(*StatusError); assert.True(t, ok, "%v", err) {
+		redirect, ok := e.Status.Redirect()
+		assert.True(t, ok)
+		assert.Equal(t, origin+"/live", redirect)
+		assert.Equal(t, "moved", e.Status.Description)
+	}
+
+	client.MaxConnectRedirects = 1
+	conn, err := client.DialAndConnect(ctx, edge+"/live", nil)
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+
+	_, err = client.DialAndConnect(ctx, denied+"/live", nil)
+	if e, ok := err.(*StatusError); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, StatusCodeNetConnectionConnectRejected, e.Status.Code)
+		assert.Equal(t, 403, e.Status.ExCode())
+		_, ok := e.Status.Redirect()
+		assert.False(t, ok)
+	}
+}
@@ -0,0 +1,339 @@
+package handshake
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// The complex handshake is not part of the published RTMP specification.
+// C1 and S1 carry an HMAC-SHA256 digest of themselves, keyed with the first
+// bytes of the Genuine Adobe keys, at an offset derived from the chunk
+// content. C2 and S2 end with a signature keyed with the digest of the peer's
+// C1/S1, which proves that the peer understood the digest.
+
+const (
+	chunk1Length = 1536
+	digestLength = sha256.Size
+
+	// S2 and C2 are signed over everything but their last 32 bytes.
+	signedChunk2Length = chunk1Length - digestLength
+)
+
+var (
+	genuineKeySuffix = []byte{
+		0xF0, 0xEE, 0xC2, 0x4A, 0x80, 0x68, 0xBE, 0xE8,
+		0x2E, 0x00, 0xD0, 0xD1, 0x02, 0x9E, 0x7E, 0x57,
+		0x6E, 0xEC, 0x5D, 0x2D, 0x29, 0x80, 0x6F, 0xAB,
+		0x93, 0xB8, 0xE6, 0x36, 0xCF, 0xEB, 0x31, 0xAE,
+	}
+	genuineFMSKey = append(
+		[]byte("Genuine Adobe Flash Media Server 001"),
+		genuineKeySuffix...,
+	)
+	genuineFPKey = append(
+		[]byte("Genuine Adobe Flash Player 001"),
+		genuineKeySuffix...,
+	)
+
+	// C1 and S1 digests are keyed with the text part only.
+	genuineFMSKeyText = genuineFMSKey[:36]
+	genuineFPKeyText  = genuineFPKey[:30]
+
+	// version fields of C1 and S1. Zero means the simple handshake.
+	complexClientVersion = []byte{0x0c, 0x00, 0x0d, 0x0e}
+	complexServerVersion = []byte{0x0d, 0x0e, 0x0a, 0x0d}
+)
+
+// Schema is the layout of C1 and S1 in the complex handshake. It decides
+// where the digest and the key blocks are placed.
+type Schema uint8
+
+const (
+	// Schema0 places the key block before the digest block.
+	Schema0 Schema = iota
+	// Schema1 places the digest block before the key block.
+	Schema1
+)
+
+func (s Schema) digestOffset(b []byte) int {
+	if s == Schema0 {
+		return offsetIn(b[772:776], 728) + 776
+	}
+	return offsetIn(b[8:12], 728) + 12
+}
+
+// keyOffset returns where the 128 byte key, e.g. a Diffie-Hellman public key,
+// is placed.
+func (s Schema) keyOffset(b []byte) int {
+	if s == Schema0 {
+		return offsetIn(b[768:772], 632) + 8
+	}
+	return offsetIn(b[1532:1536], 632) + 772
+}
+
+func offsetIn(b []byte, mod int) int {
+	return (int(b[0]) + int(b[1]) + int(b[2]) + int(b[3])) % mod
+}
+
+func chunk1Digest(b []byte, offset int, key []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(b[:offset])
+	h.Write(b[offset+digestLength:])
+	return h.Sum(nil)
+}
+
+func putChunk1Digest(b []byte, schema Schema, key []byte) []byte {
+	offset := schema.digestOffset(b)
+	d := chunk1Digest(b, offset, key)
+	copy(b[offset:], d)
+	return d
+}
+
+// findChunk1Digest looks for a valid digest in C1 or S1 in either schema.
+func findChunk1Digest(b []byte, key []byte) (digest []byte, schema Schema, ok bool) {
+	for _, schema := range []Schema{Schema0, Schema1} {
+		offset := schema.digestOffset(b)
+		d := chunk1Digest(b, offset, key)
+		if hmac.Equal(d, b[offset:offset+digestLength]) {
+			return d, schema, true
+		}
+	}
+	return nil, 0, false
+}
+
+func chunk2Signature(b []byte, fullKey []byte, peerDigest []byte) []byte {
+	h := hmac.New(sha256.New, fullKey)
+	h.Write(peerDigest)
+	h = hmac.New(sha256.New, h.Sum(nil))
+	h.Write(b[:signedChunk2Length])
+	return h.Sum(nil)
+}
+
+type complexHandshaker struct {
+	isServer  bool
+	encrypted bool
+}
+
+// NewComplexHandshaker returns a Handshaker that performs the digest based
+// complex handshake, which some players require before they play H.264 and
+// AAC. It falls back to the simple handshake when the peer does not send a
+// digest.
+func NewComplexHandshaker(
+	isServer bool,
+) Handshaker {
+	return complexHandshaker{
+		isServer: isServer,
+	}
+}
+
+func (y complexHandshaker) Handshake(ctx context.Context, r io.Reader, w io.Writer) error {
+	decrypter, _, err := y.HandshakeWithCiphers(ctx, r, w)
+	if err != nil {
+		return err
+	}
+	if decrypter != nil {
+		return errors.New("RTMPE is negotiated but ciphers are not handled: use HandshakeWithCiphers")
+	}
+	return nil
+}
+
+func (y complexHandshaker) HandshakeWithCiphers(ctx context.Context, r io.Reader, w io.Writer) (decrypter cipher.Stream, encrypter cipher.Stream, err error) {
+	if y.isServer {
+		return y.serverHandshake(ctx, r, w)
+	}
+	return y.clientHandshake(ctx, r, w)
+}
+
+func (y complexHandshaker) serverHandshake(ctx context.Context, r io.Reader, w io.Writer) (decrypter cipher.Stream, encrypter cipher.Stream, err error) {
+	c0c1 := make([]byte, 1+chunk1Length)
+	if _, err := io.ReadFull(r, c0c1); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read Chunk0 and Chunk1")
+	}
+	version := c0c1[0]
+	c1 := c0c1[1:]
+	encrypted := version == EncryptedRTMPVersion
+
+	var c1Digest []byte
+	var schema Schema
+	var isComplex bool
+	if !isSimpleChunk1(c1) {
+		c1Digest, schema, isComplex = findChunk1Digest(c1, genuineFPKeyText)
+	}
+	if encrypted && !isComplex {
+		return nil, nil, errors.New("invalid Chunk1: RTMPE without digest")
+	}
+
+	var s1, s2 []byte
+	if isComplex {
+		if s1, err = newChunk1(complexServerVersion); err != nil {
+			return nil, nil, err
+		}
+		if encrypted {
+			k, err := newDHKey()
+			if err != nil {
+				return nil, nil, err
+			}
+			putDHPublicKey(s1, schema, k)
+			c1Public := dhPublicKey(c1, schema)
+			secret, err := k.sharedSecret(c1Public)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "invalid Chunk1")
+			}
+			if decrypter, encrypter, err = rc4Streams(secret, k.public, c1Public); err != nil {
+				return nil, nil, err
+			}
+		}
+		putChunk1Digest(s1, schema, genuineFMSKeyText)
+		if s2, err = newComplexChunk2(genuineFMSKey, c1Digest); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if s1, err = newChunk1(nil); err != nil {
+			return nil, nil, err
+		}
+		s2 = newSimpleChunk2(c1)
+	}
+
+	s0 := byte(ServerRTMPVersion)
+	if encrypted {
+		s0 = EncryptedRTMPVersion
+	}
+	if err := writeAndFlush(w, []byte{s0}, s1, s2); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to send Chunk0, Chunk1 and Chunk2")
+	}
+
+	c2 := make([]byte, chunk1Length)
+	if _, err := io.ReadFull(r, c2); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read Chunk2")
+	}
+	// Many clients send a C2 that does not match S1, so C2 is not validated
+	// in either handshake.
+	return decrypter, encrypter, nil
+}
+
+func (y complexHandshaker) clientHandshake(ctx context.Context, r io.Reader, w io.Writer) (decrypter cipher.Stream, encrypter cipher.Stream, err error) {
+	c1, err := newChunk1(complexClientVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	c0 := byte(ServerRTMPVersion)
+	var k *dhKey
+	if y.encrypted {
+		c0 = EncryptedRTMPVersion
+		if k, err = newDHKey(); err != nil {
+			return nil, nil, err
+		}
+		putDHPublicKey(c1, Schema1, k)
+	}
+	c1Digest := putChunk1Digest(c1, Schema1, genuineFPKeyText)
+	if err := writeAndFlush(w, []byte{c0}, c1); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to send Chunk0 and Chunk1")
+	}
+
+	s0s1s2 := make([]byte, 1+chunk1Length*2)
+	if _, err := io.ReadFull(r, s0s1s2[:1+chunk1Length]); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read Chunk0 and Chunk1")
+	}
+	if y.encrypted && s0s1s2[0] != EncryptedRTMPVersion {
+		return nil, nil, errors.Errorf("server does not support RTMPE: version %d", s0s1s2[0])
+	}
+	s1 := s0s1s2[1 : 1+chunk1Length]
+
+	var c2 []byte
+	var s1Digest []byte
+	var schema Schema
+	var isComplex bool
+	if !isSimpleChunk1(s1) {
+		s1Digest, schema, isComplex = findChunk1Digest(s1, genuineFMSKeyText)
+	}
+	if y.encrypted {
+		if !isComplex {
+			return nil, nil, errors.New("invalid Chunk1: RTMPE without digest")
+		}
+		s1Public := dhPublicKey(s1, schema)
+		secret, err := k.sharedSecret(s1Public)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "invalid Chunk1")
+		}
+		if decrypter, encrypter, err = rc4Streams(secret, k.public, s1Public); err != nil {
+			return nil, nil, err
+		}
+	}
+	if isComplex {
+		if c2, err = newComplexChunk2(genuineFPKey, s1Digest); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		c2 = newSimpleChunk2(s1)
+	}
+
+	if _, err := io.ReadFull(r, s0s1s2[1+chunk1Length:]); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read Chunk2")
+	}
+	s2 := s0s1s2[1+chunk1Length:]
+	if isComplex {
+		if !hmac.Equal(chunk2Signature(s2, genuineFMSKey, c1Digest), s2[signedChunk2Length:]) {
+			return nil, nil, errors.New("invalid Chunk2: signature mismatch")
+		}
+	} else if !bytes.Equal(s2[8:], c1[8:]) {
+		return nil, nil, errors.New("invalid Chunk2: randomEcho mismatch")
+	}
+
+	if err := writeAndFlush(w, c2); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to send Chunk2")
+	}
+	return decrypter, encrypter, nil
+}
+
+// newChunk1 returns a C1 or S1 with time 0, the given version and random
+// bytes. A nil version makes it a simple handshake chunk.
+func newChunk1(version []byte) ([]byte, error) {
+	b := make([]byte, chunk1Length)
+	if _, err := rand.Read(b[8:]); err != nil {
+		return nil, errors.Wrap(err, "failed to create randomBytes")
+	}
+	copy(b[4:8], version)
+	return b, nil
+}
+
+// newSimpleChunk2 echoes the peer's chunk 1. Our own time is always 0, so
+// time2 is the peer's time.
+func newSimpleChunk2(peer1 []byte) []byte {
+	b := make([]byte, chunk1Length)
+	copy(b, peer1)
+	copy(b[4:8], peer1[0:4])
+	return b
+}
+
+func newComplexChunk2(fullKey []byte, peerDigest []byte) ([]byte, error) {
+	b := make([]byte, chunk1Length)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "failed to create randomBytes")
+	}
+	copy(b[signedChunk2Length:], chunk2Signature(b, fullKey, peerDigest))
+	return b, nil
+}
+
+func isSimpleChunk1(b []byte) bool {
+	return binary.BigEndian.Uint32(b[4:8]) == 0
+}
+
+func writeAndFlush(w io.Writer, bs ...[]byte) error {
+	for _, b := range bs {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	if w, ok := w.(flusher); ok {
+		return w.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package handshake
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func handshakeOverPipe(client Handshaker, server Handshaker) error {
+	csr, csw := io.Pipe()
+	scr, scw := io.Pipe()
+
+	g, ctx := errgroup.WithContext(context.Background())
+
+	// unblock the peer when one side gives up
+	closePipes := func(err error) error {
+		if err != nil {
+			csr.CloseWithError(err)
+			scr.CloseWithError(err)
+		}
+		return err
+	}
+
+	g.Go(func() error {
+		return closePipes(errors.Wrap(
+			client.Handshake(ctx, bufio.NewReader(scr), bufio.NewWriter(csw)),
+			"failed to client handshake",
+		))
+	})
+
+	g.Go(func() error {
+		return closePipes(errors.Wrap(
+			server.Handshake(ctx, bufio.NewReader(csr), bufio.NewWriter(scw)),
+			"failed to server handshake",
+		))
+	})
+
+	return g.Wait()
+}
+
+func Test_complexHandshaker_Handshake(t *testing.T) {
+	testCases := []struct {
+		name   string
+		client Handshaker
+		server Handshaker
+	}{
+		{
+			name:   "complex",
+			client: NewComplexHandshaker(false),
+			server: NewComplexHandshaker(true),
+		},
+		{
+			name:   "simple client",
+			client: NewDefaultHandshaker(false),
+			server: NewComplexHandshaker(true),
+		},
+		{
+			name:   "simple server",
+			client: NewComplexHandshaker(false),
+			server: NewDefaultHandshaker(true),
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.NoError(t, handshakeOverPipe(tt.client, tt.server))
+		})
+	}
+}
+
+func Test_findChunk1Digest(t *testing.T) {
+	for _, schema := range []Schema{Schema0, Schema1} {
+		b, err := newChunk1(complexClientVersion)
+		if !assert.NoError(t, err) {
+			return
+		}
+		want := putChunk1Digest(b, schema, genuineFPKeyText)
+
+		d, got, ok := findChunk1Digest(b, genuineFPKeyText)
+		assert.True(t, ok)
+		assert.Equal(t, schema, got)
+		assert.Equal(t, want, d)
+
+		_, _, ok = findChunk1Digest(b, genuineFMSKeyText)
+		assert.False(t, ok)
+	}
+}
@@ -0,0 +1,136 @@
+package handshake
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha256"
+	"io"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// RTMPE embeds a Diffie-Hellman key exchange in the complex handshake. The
+// public keys are placed in the key blocks of C1 and S1, and the shared
+// secret keys an RC4 stream in each direction for everything after C2.
+
+const (
+	EncryptedRTMPVersion = 0x06
+
+	dhKeyLength = 128
+)
+
+var (
+	// dhPrime is the 1024 bit MODP group 2 prime of RFC 2409 (Oakley group 2).
+	dhPrime, _ = new(big.Int).SetString(
+		"FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1"+
+			"29024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+			"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245"+
+			"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+			"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE65381"+
+			"FFFFFFFFFFFFFFFF",
+		16,
+	)
+	dhGenerator = big.NewInt(2)
+)
+
+// CipherHandshaker is a Handshaker that can negotiate RTMPE. The returned
+// streams decrypt what is read and encrypt what is written after the
+// handshake. Both are nil when the connection is not encrypted.
+type CipherHandshaker interface {
+	Handshaker
+	HandshakeWithCiphers(ctx context.Context, r io.Reader, w io.Writer) (decrypter cipher.Stream, encrypter cipher.Stream, err error)
+}
+
+// NewEncryptedHandshaker returns a CipherHandshaker for RTMPE. A client
+// always asks for encryption, and a server accepts both RTMPE and plain
+// RTMP like NewComplexHandshaker.
+func NewEncryptedHandshaker(
+	isServer bool,
+) CipherHandshaker {
+	return complexHandshaker{
+		isServer:  isServer,
+		encrypted: !isServer,
+	}
+}
+
+type dhKey struct {
+	private *big.Int
+	public  []byte
+}
+
+func newDHKey() (*dhKey, error) {
+	for {
+		private, err := rand.Int(rand.Reader, dhPrime)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create Diffie-Hellman private key")
+		}
+		public := new(big.Int).Exp(dhGenerator, private, dhPrime)
+		if isValidDHPublicKey(public) {
+			return &dhKey{
+				private: private,
+				public:  leftPad(public.Bytes(), dhKeyLength),
+			}, nil
+		}
+	}
+}
+
+func (k *dhKey) sharedSecret(peerPublic []byte) ([]byte, error) {
+	y := new(big.Int).SetBytes(peerPublic)
+	if !isValidDHPublicKey(y) {
+		return nil, errors.New("invalid Diffie-Hellman public key")
+	}
+	return leftPad(new(big.Int).Exp(y, k.private, dhPrime).Bytes(), dhKeyLength), nil
+}
+
+// isValidDHPublicKey rejects 0, 1 and p-1, which would give away the secret.
+func isValidDHPublicKey(y *big.Int) bool {
+	max := new(big.Int).Sub(dhPrime, big.NewInt(1))
+	return y.Cmp(big.NewInt(1)) > 0 && y.Cmp(max) < 0
+}
+
+func leftPad(b []byte, n int) []byte {
+	if len(b) >= n {
+		return b
+	}
+	p := make([]byte, n)
+	copy(p[n-len(b):], b)
+	return p
+}
+
+// rc4Streams derives the RC4 streams from the shared secret. Each direction
+// is keyed with the public key of its receiver, and both streams start as if
+// 1536 bytes had already been processed.
+func rc4Streams(secret []byte, ownPublic []byte, peerPublic []byte) (decrypter cipher.Stream, encrypter cipher.Stream, err error) {
+	newStream := func(public []byte) (cipher.Stream, error) {
+		h := hmac.New(sha256.New, secret)
+		h.Write(public)
+		c, err := rc4.NewCipher(h.Sum(nil)[:16])
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create RC4 cipher")
+		}
+		skip := make([]byte, chunk1Length)
+		c.XORKeyStream(skip, skip)
+		return c, nil
+	}
+	if decrypter, err = newStream(ownPublic); err != nil {
+		return nil, nil, err
+	}
+	if encrypter, err = newStream(peerPublic); err != nil {
+		return nil, nil, err
+	}
+	return decrypter, encrypter, nil
+}
+
+// putDHPublicKey places the public key in the key block of b.
+func putDHPublicKey(b []byte, schema Schema, k *dhKey) {
+	copy(b[schema.keyOffset(b):], k.public)
+}
+
+func dhPublicKey(b []byte, schema Schema) []byte {
+	offset := schema.keyOffset(b)
+	return b[offset : offset+dhKeyLength]
+}
@@ -0,0 +1,72 @@
+package handshake
+
+import (
+	"bufio"
+	"context"
+	"crypto/cipher"
+	"io"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/errgroup"
+)
+
+func Test_complexHandshaker_HandshakeWithCiphers(t *testing.T) {
+	client := NewEncryptedHandshaker(false)
+	server := NewComplexHandshaker(true).(CipherHandshaker)
+
+	csr, csw := io.Pipe()
+	scr, scw := io.Pipe()
+
+	g, ctx := errgroup.WithContext(context.Background())
+
+	var clientDecrypter, clientEncrypter, serverDecrypter, serverEncrypter cipher.Stream
+	g.Go(func() (err error) {
+		clientDecrypter, clientEncrypter, err = client.HandshakeWithCiphers(ctx, bufio.NewReader(scr), bufio.NewWriter(csw))
+		return errors.Wrap(err, "failed to client handshake")
+	})
+	g.Go(func() (err error) {
+		serverDecrypter, serverEncrypter, err = server.HandshakeWithCiphers(ctx, bufio.NewReader(csr), bufio.NewWriter(scw))
+		return errors.Wrap(err, "failed to server handshake")
+	})
+	if !assert.NoError(t, g.Wait()) {
+		return
+	}
+
+	roundtrip := func(encrypter, decrypter cipher.Stream) {
+		plain := []byte("NetConnection.Connect.Success")
+		b := make([]byte, len(plain))
+		encrypter.XORKeyStream(b, plain)
+		assert.NotEqual(t, plain, b)
+		decrypter.XORKeyStream(b, b)
+		assert.Equal(t, plain, b)
+	}
+	roundtrip(clientEncrypter, serverDecrypter)
+	roundtrip(serverEncrypter, clientDecrypter)
+}
+
+func Test_complexHandshaker_HandshakeWithCiphers_unsupportedServer(t *testing.T) {
+	err := handshakeOverPipe(NewEncryptedHandshaker(false), NewDefaultHandshaker(true))
+	assert.Error(t, err)
+}
+
+func Test_dhKey_sharedSecret(t *testing.T) {
+	a, err := newDHKey()
+	if !assert.NoError(t, err) {
+		return
+	}
+	b, err := newDHKey()
+	if !assert.NoError(t, err) {
+		return
+	}
+	sa, err := a.sharedSecret(b.public)
+	assert.NoError(t, err)
+	sb, err := b.sharedSecret(a.public)
+	assert.NoError(t, err)
+	assert.Equal(t, sa, sb)
+	assert.Len(t, sa, dhKeyLength)
+
+	_, err = a.sharedSecret([]byte{0x01})
+	assert.Error(t, err)
+}
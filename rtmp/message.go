@@ -1,4 +1,60 @@
 package rtmp
 
-//go:generate go run $DEFDIR/go/cmd/genstruct/genstruct.go -package rtmp -toml $DEFDIR/message/message.toml -o message_gen.go
+//go:generate go run $DEFDIR/go/cmd/genstruct/genstruct.go -package rtmp -toml $DEFDIR/message/message.toml -customInterfaceFunc "Message#Retain()" -customInterfaceFunc "Message#Release()" -o message_gen.go
 //go:generate stringer -type MessageTypeID -trimprefix MessageTypeID -output message_typeid_string_gen.go
+
+import (
+	"sync/atomic"
+)
+
+// Retain and Release are no-ops for messages built with NewMessage, whose
+// payload is owned by the caller.
+func (m message) Retain() {}
+
+func (m message) Release() {}
+
+// pooledMessage owns a payload buffer taken from a bufferPool. The reader
+// hands it out with one reference; handlers that keep the payload beyond
+// HandleMessage must Retain it and Release it when done.
+type pooledMessage struct {
+	message
+	refs int32
+	pool *bufferPool
+}
+
+func newPooledMessage(
+	chunkStreamID uint32,
+	typeID MessageTypeID,
+	timestamp uint32,
+	streamID uint32,
+	payload []byte,
+	pool *bufferPool,
+) Message {
+	return &pooledMessage{
+		message: message{
+			chunkStreamID: chunkStreamID,
+			typeID:        typeID,
+			timestamp:     timestamp,
+			streamID:      streamID,
+			payload:       payload,
+		},
+		refs: 1,
+		pool: pool,
+	}
+}
+
+func (m *pooledMessage) Retain() {
+	if atomic.AddInt32(&m.refs, 1) <= 1 {
+		panic("rtmp: Retain on released message")
+	}
+}
+
+func (m *pooledMessage) Release() {
+	switch n := atomic.AddInt32(&m.refs, -1); {
+	case n == 0:
+		m.pool.Put(m.payload)
+		m.payload = nil
+	case n < 0:
+		panic("rtmp: Release on released message")
+	}
+}
@@ -33,6 +33,8 @@ type Message interface {
 	Timestamp() uint32
 	StreamID() uint32
 	Payload() []byte
+	Retain()
+	Release()
 }
 
 type message struct {
@@ -0,0 +1,213 @@
+package rtmp
+
+//go:generate stringer -type MessageStreamState -trimprefix MessageStreamState -output message_stream_state_string_gen.go
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type MessageStreamState uint8
+
+const (
+	MessageStreamStateIdle MessageStreamState = iota
+	MessageStreamStatePublishing
+	MessageStreamStatePlaying
+)
+
+// MessageStream is a NetStream created by createStream. Its ID is the
+// message stream ID of the messages sent on it, which is unrelated to the
+// chunk stream IDs those messages are carried on.
+type MessageStream struct {
+	ID             uint32
+	State          MessageStreamState
+	Name           string
+	PublishingType PublishingType
+}
+
+type messageStreamTable struct {
+	mu         sync.Mutex
+	streams    map[ /* messageStreamID */ uint32]*MessageStream
+	maxStreams int
+
+	// onDone is called without mu when a stream stops publishing or
+	// playing.
+	onDone func(MessageStream)
+	// admit is called with mu held when a stream starts publishing or
+	// playing; a non-nil error info keeps the stream as it was. release is
+	// called with mu held when an admitted stream stops.
+	admit   func(MessageStream) (errorInfo map[string]interface{})
+	release func(MessageStream)
+}
+
+// streamAdmissionError is returned when admit refuses a state change.
+type streamAdmissionError struct {
+	errorInfo map[string]interface{}
+}
+
+func (e *streamAdmissionError) Error() string {
+	return "message stream is not admitted"
+}
+
+func newMessageStreamTable(maxStreams int) *messageStreamTable {
+	return &messageStreamTable{
+		streams:    map[uint32]*MessageStream{},
+		maxStreams: maxStreams,
+	}
+}
+
+// Create allocates the lowest free message stream ID. 0 is reserved for
+// NetConnection.
+func (t *messageStreamTable) Create() (uint32, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.maxStreams > 0 && len(t.streams) >= t.maxStreams {
+		return 0, errors.Errorf("too many message streams: max %d", t.maxStreams)
+	}
+	for i := uint32(1); i <= maxMessageStreamID; i++ {
+		if _, ok := t.streams[i]; !ok {
+			t.streams[i] = &MessageStream{ID: i}
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("too many message streams: max %d", maxMessageStreamID)
+}
+
+// Register adds a message stream allocated by the peer.
+func (t *messageStreamTable) Register(id uint32) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.streams[id]; ok {
+		return nil
+	}
+	if id == 0 || id > maxMessageStreamID {
+		return errors.Errorf("message stream ID out of range: %d", id)
+	}
+	if t.maxStreams > 0 && len(t.streams) >= t.maxStreams {
+		return errors.Errorf("too many message streams: max %d", t.maxStreams)
+	}
+	t.streams[id] = &MessageStream{ID: id}
+	return nil
+}
+
+func (t *messageStreamTable) Get(id uint32) (MessageStream, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.streams[id]
+	if !ok {
+		return MessageStream{}, false
+	}
+	return *s, true
+}
+
+func (t *messageStreamTable) List() []MessageStream {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l := make([]MessageStream, 0, len(t.streams))
+	for _, s := range t.streams {
+		l = append(l, *s)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].ID < l[j].ID })
+	return l
+}
+
+func (t *messageStreamTable) SetPublishing(id uint32, name string, publishingType PublishingType) error {
+	return t.update(id, func(s *MessageStream) {
+		s.State = MessageStreamStatePublishing
+		s.Name = name
+		s.PublishingType = publishingType
+	})
+}
+
+func (t *messageStreamTable) SetPlaying(id uint32, name string) error {
+	return t.update(id, func(s *MessageStream) {
+		s.State = MessageStreamStatePlaying
+		s.Name = name
+	})
+}
+
+func (t *messageStreamTable) SetIdle(id uint32) error {
+	return t.update(id, func(s *MessageStream) {
+		s.State = MessageStreamStateIdle
+		s.Name = ""
+		s.PublishingType = ""
+	})
+}
+
+// Delete releases id so that it can be allocated again.
+func (t *messageStreamTable) Delete(id uint32) (MessageStream, bool) {
+	t.mu.Lock()
+	s, ok := t.streams[id]
+	if !ok {
+		t.mu.Unlock()
+		return MessageStream{}, false
+	}
+	delete(t.streams, id)
+	t.releaseStream(*s)
+	t.mu.Unlock()
+	if s.State != MessageStreamStateIdle {
+		t.done(*s)
+	}
+	return *s, true
+}
+
+// DeleteAll releases every stream when the connection closes.
+func (t *messageStreamTable) DeleteAll() {
+	t.mu.Lock()
+	var active []MessageStream
+	for id, s := range t.streams {
+		if s.State != MessageStreamStateIdle {
+			active = append(active, *s)
+		}
+		t.releaseStream(*s)
+		delete(t.streams, id)
+	}
+	t.mu.Unlock()
+	sort.Slice(active, func(i, j int) bool { return active[i].ID < active[j].ID })
+	for _, s := range active {
+		t.done(s)
+	}
+}
+
+func (t *messageStreamTable) update(id uint32, f func(s *MessageStream)) error {
+	t.mu.Lock()
+	s, ok := t.streams[id]
+	if !ok {
+		t.mu.Unlock()
+		return errors.Errorf("unknown message stream %d", id)
+	}
+	prev := *s
+	next := prev
+	f(&next)
+	if next.State != prev.State {
+		if next.State != MessageStreamStateIdle && t.admit != nil {
+			if errorInfo := t.admit(next); errorInfo != nil {
+				t.mu.Unlock()
+				return &streamAdmissionError{errorInfo: errorInfo}
+			}
+		}
+		t.releaseStream(prev)
+	}
+	*s = next
+	ended := prev.State != MessageStreamStateIdle && (prev.State != s.State || prev.Name != s.Name)
+	t.mu.Unlock()
+	if ended {
+		t.done(prev)
+	}
+	return nil
+}
+
+// releaseStream releases the admission of s. t.mu must be held.
+func (t *messageStreamTable) releaseStream(s MessageStream) {
+	if s.State != MessageStreamStateIdle && t.release != nil {
+		t.release(s)
+	}
+}
+
+func (t *messageStreamTable) done(s MessageStream) {
+	if t.onDone != nil {
+		t.onDone(s)
+	}
+}
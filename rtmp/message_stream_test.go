@@ -0,0 +1,137 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMessageStreamTable(t *testing.T) {
+	table := newMessageStreamTable(2)
+
+	id1, err := table.Create()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1), id1)
+	id2, err := table.Create()
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(2), id2)
+	_, err = table.Create()
+	assert.Error(t, err)
+
+	assert.NoError(t, table.SetPublishing(id2, "live", PublishingTypeLive))
+	s, ok := table.Get(id2)
+	if assert.True(t, ok) {
+		assert.Equal(t, MessageStreamStatePublishing, s.State)
+		assert.Equal(t, "live", s.Name)
+	}
+
+	_, ok = table.Delete(id1)
+	assert.True(t, ok)
+	assert.Error(t, table.SetPlaying(id1, "live"))
+
+	id, err := table.Create()
+	assert.NoError(t, err)
+	assert.Equal(t, id1, id)
+	assert.Equal(t, []MessageStream{
+		{ID: 1},
+		{ID: 2, State: MessageStreamStatePublishing, Name: "live", PublishingType: PublishingTypeLive},
+	}, table.List())
+}
+
+func TestMessageStreamTableDone(t *testing.T) {
+	table := newMessageStreamTable(0)
+	var done []MessageStream
+	table.onDone = func(s MessageStream) {
+		done = append(done, s)
+	}
+	id1, _ := table.Create()
+	id2, _ := table.Create()
+	id3, _ := table.Create()
+	assert.NoError(t, table.SetPublishing(id1, "a", PublishingTypeLive))
+	assert.NoError(t, table.SetPlaying(id2, "b"))
+	assert.NoError(t, table.SetPlaying(id3, "c"))
+
+	assert.NoError(t, table.SetPublishing(id1, "a", PublishingTypeLive))
+	assert.Empty(t, done)
+
+	assert.NoError(t, table.SetIdle(id1))
+	assert.NoError(t, table.SetIdle(id1))
+	table.Delete(id2)
+	table.DeleteAll()
+	assert.Equal(t, []MessageStream{
+		{ID: id1, State: MessageStreamStatePublishing, Name: "a", PublishingType: PublishingTypeLive},
+		{ID: id2, State: MessageStreamStatePlaying, Name: "b"},
+		{ID: id3, State: MessageStreamStatePlaying, Name: "c"},
+	}, done)
+	assert.Empty(t, table.List())
+}
+
+func TestMessageStreamTableRegister(t *testing.T) {
+	table := newMessageStreamTable(2)
+	assert.NoError(t, table.Register(1))
+	assert.NoError(t, table.Register(1))
+	assert.Error(t, table.Register(0))
+	assert.Error(t, table.Register(maxMessageStreamID+1))
+	assert.NoError(t, table.Register(maxMessageStreamID))
+	assert.Error(t, table.Register(3))
+	assert.Equal(t, uint32(65598), ChunkStreamIDFor(MessageTypeIDVideo, maxMessageStreamID))
+}
+
+func TestChunkStreamIDFor(t *testing.T) {
+	testCases := []struct {
+		typeID          MessageTypeID
+		messageStreamID uint32
+		want            uint32
+	}{
+		{MessageTypeIDSetChunkSize, 0, 2},
+		{MessageTypeIDUserControlMessages, 1, 2},
+		{MessageTypeIDCommandAMF0, 0, 3},
+		{MessageTypeIDCommandAMF0, 1, 4},
+		{MessageTypeIDAudio, 1, 5},
+		{MessageTypeIDVideo, 1, 6},
+		{MessageTypeIDCommandAMF3, 2, 7},
+		{MessageTypeIDVideo, 2, 9},
+	}
+	for _, tt := range testCases {
+		assert.Equal(t, tt.want, ChunkStreamIDFor(tt.typeID, tt.messageStreamID), "%s on %d", tt.typeID, tt.messageStreamID)
+	}
+}
+
+func TestPlayUnknownMessageStream(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	go s.Serve(l)
+
+	statuses := make(chan Status, 1)
+	client := NewClient(ctx, zap.NewNop(),
+		WithConnInitializers(GenerateCommonConnInitializer()),
+		WithStatusHandlers(func(ctx context.Context, messageStreamID uint32, status Status) ConnError {
+			statuses <- status
+			return nil
+		}),
+	)
+	defer client.Close()
+	conn, err := client.DialAndConnect(ctx, "rtmp://"+l.Addr().String()+"/live", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, sendPlay(ctx, conn, 5, "room"))
+	select {
+	case status := <-statuses:
+		assert.Equal(t, StatusCodeNetStreamPlayStreamNotFound, status.Code)
+		assert.Equal(t, "room", status.Details)
+	case <-ctx.Done():
+		t.Fatal("no status")
+	}
+}
@@ -0,0 +1,89 @@
+package rtmp
+
+import (
+	"time"
+)
+
+type HandshakeResult string
+
+const (
+	HandshakeResultSuccess HandshakeResult = "success"
+	HandshakeResultFailure HandshakeResult = "failure"
+	HandshakeResultTimeout HandshakeResult = "timeout"
+)
+
+// StreamSample is measured over about a second of a publishing stream.
+type StreamSample struct {
+	// Bitrate counts audio and video payloads in bits per second.
+	Bitrate float64
+	// FPS counts video frames per second.
+	FPS float64
+	// KeyframeInterval is the timestamp distance of the last two
+	// keyframes, zero until the second one.
+	KeyframeInterval time.Duration
+}
+
+// Metrics receives the measurements of connections and servers. Its
+// methods are called from every connection concurrently and must not block.
+// Embed NopMetrics to implement only some of them.
+type Metrics interface {
+	ConnOpened()
+	ConnClosed()
+	// Rejected is called with the name of the AdmissionStats field counting
+	// the rejection, e.g. "MaxConns".
+	Rejected(reason string)
+	Handshake(result HandshakeResult, d time.Duration)
+
+	BytesRead(n int)
+	BytesWritten(n int)
+	MessageRead(typeID MessageTypeID)
+	MessageWritten(typeID MessageTypeID)
+	// FrameDropped is called when an audio or video message is discarded
+	// before it was completely read.
+	FrameDropped(typeID MessageTypeID)
+	AcknowledgementSent()
+	AcknowledgementReceived()
+	RTT(d time.Duration)
+
+	// StreamSample is called about every second for each publishing
+	// stream, identified by its StreamPath.
+	StreamSample(stream string, sample StreamSample)
+	StreamEnded(stream string)
+}
+
+type NopMetrics struct{}
+
+func (NopMetrics) ConnOpened()                                       {}
+func (NopMetrics) ConnClosed()                                       {}
+func (NopMetrics) Rejected(reason string)                            {}
+func (NopMetrics) Handshake(result HandshakeResult, d time.Duration) {}
+func (NopMetrics) BytesRead(n int)                                   {}
+func (NopMetrics) BytesWritten(n int)                                {}
+func (NopMetrics) MessageRead(typeID MessageTypeID)                  {}
+func (NopMetrics) MessageWritten(typeID MessageTypeID)               {}
+func (NopMetrics) FrameDropped(typeID MessageTypeID)                 {}
+func (NopMetrics) AcknowledgementSent()                              {}
+func (NopMetrics) AcknowledgementReceived()                          {}
+func (NopMetrics) RTT(d time.Duration)                               {}
+func (NopMetrics) StreamSample(stream string, sample StreamSample)   {}
+func (NopMetrics) StreamEnded(stream string)                         {}
+
+// WithMetrics reports the measurements of the connection to metrics.
+// Server.Metrics sets it for every connection of the server.
+func WithMetrics(metrics Metrics) ConnOption {
+	return func(o *connOptions) {
+		o.metrics = metrics
+	}
+}
+
+// connMetrics returns the Metrics of conn, NopMetrics if it has none.
+func connMetrics(conn Conn) Metrics {
+	if c, ok := conn.(*defaultConn); ok && c.metrics != nil {
+		return c.metrics
+	}
+	return NopMetrics{}
+}
+
+func isMediaMessage(typeID MessageTypeID) bool {
+	return typeID == MessageTypeIDAudio || typeID == MessageTypeIDVideo
+}
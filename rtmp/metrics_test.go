@@ -0,0 +1,88 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type recordingMetrics struct {
+	NopMetrics
+
+	mu              sync.Mutex
+	opened          int
+	handshakes      map[HandshakeResult]int
+	bytesRead       int
+	messagesRead    map[MessageTypeID]int
+	messagesWritten map[MessageTypeID]int
+}
+
+func (m *recordingMetrics) ConnOpened() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.opened++
+}
+
+func (m *recordingMetrics) Handshake(result HandshakeResult, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handshakes[result]++
+}
+
+func (m *recordingMetrics) BytesRead(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bytesRead += n
+}
+
+func (m *recordingMetrics) MessageRead(typeID MessageTypeID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messagesRead[typeID]++
+}
+
+func (m *recordingMetrics) MessageWritten(typeID MessageTypeID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messagesWritten[typeID]++
+}
+
+func TestServerMetrics(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &recordingMetrics{
+		handshakes:      map[HandshakeResult]int{},
+		messagesRead:    map[MessageTypeID]int{},
+		messagesWritten: map[MessageTypeID]int{},
+	}
+	s := NewServer(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	s.Metrics = m
+	go s.Serve(l)
+
+	client := NewClient(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	defer client.Close()
+	conn, err := client.DialAndConnect(ctx, "rtmp://"+l.Addr().String()+"/live", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	assert.Equal(t, 1, m.opened)
+	assert.Equal(t, map[HandshakeResult]int{HandshakeResultSuccess: 1}, m.handshakes)
+	assert.NotZero(t, m.bytesRead)
+	assert.Equal(t, 1, m.messagesRead[MessageTypeIDCommandAMF0])
+	assert.Equal(t, 1, m.messagesWritten[MessageTypeIDCommandAMF0])
+	assert.Equal(t, 1, m.messagesWritten[MessageTypeIDSetPeerBandwidth])
+}
@@ -0,0 +1,100 @@
+// Package otel adapts an OpenTelemetry TracerProvider to rtmp.Tracer.
+//
+//	rtmp.NewServer(ctx, logger, rtmp.WithTracer(otel.New()))
+package otel
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hori-ryota/go-rtmp/rtmp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/hori-ryota/go-rtmp/rtmp"
+
+// Tracer is a rtmp.Tracer creating OpenTelemetry spans.
+type Tracer struct {
+	provider trace.TracerProvider
+	tracer   trace.Tracer
+}
+
+type Option func(*Tracer)
+
+// WithTracerProvider sets the provider of the tracer, the global one by
+// default.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(t *Tracer) {
+		t.provider = provider
+	}
+}
+
+func New(opts ...Option) *Tracer {
+	t := &Tracer{}
+	for _, o := range opts {
+		o(t)
+	}
+	if t.provider == nil {
+		t.provider = otel.GetTracerProvider()
+	}
+	t.tracer = t.provider.Tracer(instrumentationName)
+	return t
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...rtmp.SpanAttribute) (context.Context, rtmp.Span) {
+	kind := trace.SpanKindClient
+	for _, a := range attrs {
+		if a.Key == rtmp.SpanAttributeIsServer && a.Value == true {
+			kind = trace.SpanKindServer
+		}
+	}
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(keyValues(attrs)...),
+	)
+	return ctx, &Span{span: span}
+}
+
+// Span is a rtmp.Span ending an OpenTelemetry span.
+type Span struct {
+	span trace.Span
+}
+
+func (s *Span) SetAttributes(attrs ...rtmp.SpanAttribute) {
+	s.span.SetAttributes(keyValues(attrs)...)
+}
+
+func (s *Span) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+func keyValues(attrs []rtmp.SpanAttribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		key := attribute.Key(a.Key)
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, key.String(v))
+		case bool:
+			kvs = append(kvs, key.Bool(v))
+		case int:
+			kvs = append(kvs, key.Int(v))
+		case uint32:
+			kvs = append(kvs, key.Int64(int64(v)))
+		case int64:
+			kvs = append(kvs, key.Int64(v))
+		case float64:
+			kvs = append(kvs, key.Float64(v))
+		default:
+			kvs = append(kvs, key.String(fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
@@ -0,0 +1,48 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hori-ryota/go-rtmp/rtmp"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := New(WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+
+	ctx, parent := tracer.Start(context.Background(), rtmp.SpanNameConnect,
+		rtmp.SpanAttribute{Key: rtmp.SpanAttributeIsServer, Value: true},
+		rtmp.SpanAttribute{Key: rtmp.SpanAttributeMessageStreamID, Value: uint32(1)},
+	)
+	_, child := tracer.Start(ctx, rtmp.SpanNameCall)
+	child.End(errors.New("rejected"))
+	parent.SetAttributes(rtmp.SpanAttribute{Key: rtmp.SpanAttributeApp, Value: "live"})
+	parent.End(nil)
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+	call, connect := spans[0], spans[1]
+	assert.Equal(t, rtmp.SpanNameConnect, connect.Name())
+	assert.Equal(t, trace.SpanKindServer, connect.SpanKind())
+	assert.Equal(t, codes.Unset, connect.Status().Code)
+	assert.ElementsMatch(t, []attribute.KeyValue{
+		attribute.Bool(rtmp.SpanAttributeIsServer, true),
+		attribute.Int64(rtmp.SpanAttributeMessageStreamID, 1),
+		attribute.String(rtmp.SpanAttributeApp, "live"),
+	}, connect.Attributes())
+
+	assert.Equal(t, connect.SpanContext().SpanID(), call.Parent().SpanID())
+	assert.Equal(t, trace.SpanKindClient, call.SpanKind())
+	assert.Equal(t, codes.Error, call.Status().Code)
+	assert.Equal(t, "rejected", call.Status().Description)
+}
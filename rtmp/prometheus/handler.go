@@ -0,0 +1,149 @@
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hori-ryota/go-rtmp/rtmp"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ServeHTTP writes the metrics in the text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	bw := bufio.NewWriter(w)
+	m.write(bw)
+	bw.Flush()
+}
+
+func (m *Metrics) write(w *bufio.Writer) {
+	e := exposition{w: w, namespace: m.namespace}
+
+	opened := atomic.LoadUint64(&m.connsOpened)
+	closed := atomic.LoadUint64(&m.connsClosed)
+	e.header("connections_opened_total", "counter", "Connections accepted.")
+	e.sample("connections_opened_total", nil, float64(opened))
+	e.header("connections_active", "gauge", "Connections open.")
+	e.sample("connections_active", nil, float64(opened-closed))
+	e.header("bytes_read_total", "counter", "Bytes read from the network.")
+	e.sample("bytes_read_total", nil, float64(atomic.LoadUint64(&m.bytesRead)))
+	e.header("bytes_written_total", "counter", "Bytes written to the network.")
+	e.sample("bytes_written_total", nil, float64(atomic.LoadUint64(&m.bytesWritten)))
+	e.header("acknowledgements_sent_total", "counter", "Acknowledgements sent.")
+	e.sample("acknowledgements_sent_total", nil, float64(atomic.LoadUint64(&m.acksSent)))
+	e.header("acknowledgements_received_total", "counter", "Acknowledgements received.")
+	e.sample("acknowledgements_received_total", nil, float64(atomic.LoadUint64(&m.acksReceived)))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.header("rejections_total", "counter", "Connections and streams rejected by admission control.")
+	for _, reason := range sortedKeys(m.rejected) {
+		e.sample("rejections_total", []string{"reason", reason}, float64(m.rejected[reason]))
+	}
+	e.header("handshakes_total", "counter", "Handshakes by result.")
+	for _, result := range []rtmp.HandshakeResult{rtmp.HandshakeResultSuccess, rtmp.HandshakeResultFailure, rtmp.HandshakeResultTimeout} {
+		e.sample("handshakes_total", []string{"result", string(result)}, float64(m.handshakes[result]))
+	}
+	e.histogram("handshake_duration_seconds", "Handshake duration.", m.handshakeDuration)
+	e.messageTypes("messages_read_total", "Messages read by type.", &m.messagesRead)
+	e.messageTypes("messages_written_total", "Messages written by type.", &m.messagesWritten)
+	e.messageTypes("frames_dropped_total", "Audio and video messages discarded before they were complete.", &m.framesDropped)
+	e.histogram("rtt_seconds", "Round-trip time measured by pings.", m.rtt)
+
+	streams := make([]string, 0, len(m.streams))
+	for stream := range m.streams {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+	e.header("stream_bitrate_bits_per_second", "gauge", "Audio and video bitrate of publishing streams.")
+	for _, stream := range streams {
+		e.sample("stream_bitrate_bits_per_second", []string{"stream", stream}, m.streams[stream].Bitrate)
+	}
+	e.header("stream_fps", "gauge", "Video frame rate of publishing streams.")
+	for _, stream := range streams {
+		e.sample("stream_fps", []string{"stream", stream}, m.streams[stream].FPS)
+	}
+	e.header("stream_keyframe_interval_seconds", "gauge", "Keyframe interval of publishing streams.")
+	for _, stream := range streams {
+		e.sample("stream_keyframe_interval_seconds", []string{"stream", stream}, m.streams[stream].KeyframeInterval.Seconds())
+	}
+}
+
+type exposition struct {
+	w         *bufio.Writer
+	namespace string
+}
+
+func (e exposition) name(name string) string {
+	if e.namespace == "" {
+		return name
+	}
+	return e.namespace + "_" + name
+}
+
+func (e exposition) header(name, typ, help string) {
+	fmt.Fprintf(e.w, "# HELP %s %s\n# TYPE %s %s\n", e.name(name), help, e.name(name), typ)
+}
+
+// sample writes a line; labels are name and value pairs.
+func (e exposition) sample(name string, labels []string, v float64) {
+	e.w.WriteString(e.name(name))
+	if len(labels) > 0 {
+		e.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				e.w.WriteByte(',')
+			}
+			fmt.Fprintf(e.w, "%s=\"%s\"", labels[i], escapeLabelValue(labels[i+1]))
+		}
+		e.w.WriteByte('}')
+	}
+	e.w.WriteByte(' ')
+	e.w.WriteString(formatFloat(v))
+	e.w.WriteByte('\n')
+}
+
+func (e exposition) histogram(name, help string, h *histogram) {
+	e.header(name, "histogram", help)
+	for i, b := range h.buckets {
+		e.sample(name+"_bucket", []string{"le", formatFloat(b)}, float64(h.counts[i]))
+	}
+	e.sample(name+"_bucket", []string{"le", "+Inf"}, float64(h.count))
+	e.sample(name+"_sum", nil, h.sum)
+	e.sample(name+"_count", nil, float64(h.count))
+}
+
+func (e exposition) messageTypes(name, help string, counts *[256]uint64) {
+	e.header(name, "counter", help)
+	for i := range counts {
+		if n := atomic.LoadUint64(&counts[i]); n > 0 {
+			e.sample(name, []string{"type", rtmp.MessageTypeID(i).String()}, float64(n))
+		}
+	}
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
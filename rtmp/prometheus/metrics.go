@@ -0,0 +1,176 @@
+// Package prometheus collects rtmp.Metrics and serves them in the
+// Prometheus text exposition format, without depending on the Prometheus
+// client library.
+//
+//	m := prometheus.New()
+//	server.Metrics = m
+//	http.Handle("/metrics", m)
+package prometheus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hori-ryota/go-rtmp/rtmp"
+)
+
+var (
+	DefaultHandshakeBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+	DefaultRTTBuckets       = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5}
+)
+
+// Metrics is a rtmp.Metrics and an http.Handler serving what it collected.
+type Metrics struct {
+	namespace string
+
+	connsOpened  uint64
+	connsClosed  uint64
+	bytesRead    uint64
+	bytesWritten uint64
+	acksSent     uint64
+	acksReceived uint64
+
+	// indexed by rtmp.MessageTypeID
+	messagesRead    [256]uint64
+	messagesWritten [256]uint64
+	framesDropped   [256]uint64
+
+	mu                sync.Mutex
+	rejected          map[string]uint64
+	handshakes        map[rtmp.HandshakeResult]uint64
+	handshakeDuration *histogram
+	rtt               *histogram
+	streams           map[string]rtmp.StreamSample
+}
+
+type Option func(*Metrics)
+
+// WithNamespace prefixes the metric names, "rtmp" by default.
+func WithNamespace(namespace string) Option {
+	return func(m *Metrics) {
+		m.namespace = namespace
+	}
+}
+
+// WithHandshakeBuckets sets the upper bounds in seconds of the handshake
+// duration histogram.
+func WithHandshakeBuckets(buckets []float64) Option {
+	return func(m *Metrics) {
+		m.handshakeDuration = newHistogram(buckets)
+	}
+}
+
+// WithRTTBuckets sets the upper bounds in seconds of the RTT histogram.
+func WithRTTBuckets(buckets []float64) Option {
+	return func(m *Metrics) {
+		m.rtt = newHistogram(buckets)
+	}
+}
+
+func New(opts ...Option) *Metrics {
+	m := &Metrics{
+		namespace:         "rtmp",
+		rejected:          map[string]uint64{},
+		handshakes:        map[rtmp.HandshakeResult]uint64{},
+		handshakeDuration: newHistogram(DefaultHandshakeBuckets),
+		rtt:               newHistogram(DefaultRTTBuckets),
+		streams:           map[string]rtmp.StreamSample{},
+	}
+	for _, o := range opts {
+		o(m)
+	}
+	return m
+}
+
+func (m *Metrics) ConnOpened() {
+	atomic.AddUint64(&m.connsOpened, 1)
+}
+
+func (m *Metrics) ConnClosed() {
+	atomic.AddUint64(&m.connsClosed, 1)
+}
+
+func (m *Metrics) Rejected(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected[reason]++
+}
+
+func (m *Metrics) Handshake(result rtmp.HandshakeResult, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handshakes[result]++
+	m.handshakeDuration.observe(d.Seconds())
+}
+
+func (m *Metrics) BytesRead(n int) {
+	atomic.AddUint64(&m.bytesRead, uint64(n))
+}
+
+func (m *Metrics) BytesWritten(n int) {
+	atomic.AddUint64(&m.bytesWritten, uint64(n))
+}
+
+func (m *Metrics) MessageRead(typeID rtmp.MessageTypeID) {
+	atomic.AddUint64(&m.messagesRead[typeID], 1)
+}
+
+func (m *Metrics) MessageWritten(typeID rtmp.MessageTypeID) {
+	atomic.AddUint64(&m.messagesWritten[typeID], 1)
+}
+
+func (m *Metrics) FrameDropped(typeID rtmp.MessageTypeID) {
+	atomic.AddUint64(&m.framesDropped[typeID], 1)
+}
+
+func (m *Metrics) AcknowledgementSent() {
+	atomic.AddUint64(&m.acksSent, 1)
+}
+
+func (m *Metrics) AcknowledgementReceived() {
+	atomic.AddUint64(&m.acksReceived, 1)
+}
+
+func (m *Metrics) RTT(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rtt.observe(d.Seconds())
+}
+
+func (m *Metrics) StreamSample(stream string, sample rtmp.StreamSample) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streams[stream] = sample
+}
+
+// StreamEnded removes the gauges of stream.
+func (m *Metrics) StreamEnded(stream string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.streams, stream)
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
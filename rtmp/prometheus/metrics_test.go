@@ -0,0 +1,60 @@
+package prometheus
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hori-ryota/go-rtmp/rtmp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New(WithRTTBuckets([]float64{.01, .1}))
+	m.ConnOpened()
+	m.ConnOpened()
+	m.ConnClosed()
+	m.Rejected("MaxConns")
+	m.Handshake(rtmp.HandshakeResultSuccess, 20*time.Millisecond)
+	m.BytesRead(100)
+	m.MessageRead(rtmp.MessageTypeIDVideo)
+	m.MessageRead(rtmp.MessageTypeIDVideo)
+	m.FrameDropped(rtmp.MessageTypeIDAudio)
+	m.RTT(50 * time.Millisecond)
+	m.StreamSample(`live/"room"`, rtmp.StreamSample{Bitrate: 2500000, FPS: 30, KeyframeInterval: 2 * time.Second})
+	m.StreamSample("live/gone", rtmp.StreamSample{})
+	m.StreamEnded("live/gone")
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE rtmp_connections_opened_total counter",
+		"rtmp_connections_opened_total 2",
+		"rtmp_connections_active 1",
+		`rtmp_rejections_total{reason="MaxConns"} 1`,
+		`rtmp_handshakes_total{result="success"} 1`,
+		`rtmp_handshakes_total{result="timeout"} 0`,
+		`rtmp_handshake_duration_seconds_bucket{le="0.025"} 1`,
+		`rtmp_handshake_duration_seconds_bucket{le="0.01"} 0`,
+		"rtmp_handshake_duration_seconds_count 1",
+		"rtmp_bytes_read_total 100",
+		`rtmp_messages_read_total{type="Video"} 2`,
+		`rtmp_frames_dropped_total{type="Audio"} 1`,
+		`rtmp_rtt_seconds_bucket{le="0.1"} 1`,
+		`rtmp_rtt_seconds_bucket{le="+Inf"} 1`,
+		`rtmp_stream_bitrate_bits_per_second{stream="live/\"room\""} 2.5e+06`,
+		`rtmp_stream_fps{stream="live/\"room\""} 30`,
+		`rtmp_stream_keyframe_interval_seconds{stream="live/\"room\""} 2`,
+	} {
+		assert.Contains(t, body, line+"\n")
+	}
+	assert.NotContains(t, body, "live/gone")
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			assert.True(t, strings.HasPrefix(line, "rtmp_"), line)
+		}
+	}
+}
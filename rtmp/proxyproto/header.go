@@ -0,0 +1,311 @@
+// Package proxyproto reads PROXY protocol v1 and v2 headers sent by load
+// balancers in front of the server, so that connections report the address
+// of the real client.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+)
+
+const (
+	v1MaxLength    = 107
+	v2HeaderLength = 16
+)
+
+type Command uint8
+
+const (
+	// CommandLocal is sent for connections made by the proxy itself, e.g.
+	// health checks. The connection addresses are kept as they are.
+	CommandLocal Command = 0x0
+	// CommandProxy carries the addresses of the proxied client.
+	CommandProxy Command = 0x1
+)
+
+type TLVType uint8
+
+const (
+	TLVTypeALPN      TLVType = 0x01
+	TLVTypeAuthority TLVType = 0x02
+	TLVTypeCRC32C    TLVType = 0x03
+	TLVTypeNoop      TLVType = 0x04
+	TLVTypeUniqueID  TLVType = 0x05
+	TLVTypeSSL       TLVType = 0x20
+	TLVTypeNetNS     TLVType = 0x30
+)
+
+const (
+	sslSubTypeVersion = 0x21
+	sslSubTypeCN      = 0x22
+	sslSubTypeCipher  = 0x23
+	sslSubTypeSigAlg  = 0x24
+	sslSubTypeKeyAlg  = 0x25
+)
+
+type TLV struct {
+	Type  TLVType
+	Value []byte
+}
+
+type Header struct {
+	Version     uint8
+	Command     Command
+	Source      net.Addr
+	Destination net.Addr
+	TLVs        []TLV
+}
+
+// SSLInfo is the TLS information a v2 header carries about the connection
+// between the client and the proxy.
+type SSLInfo struct {
+	// Client is the bit field of PP2_CLIENT_SSL, PP2_CLIENT_CERT_CONN and
+	// PP2_CLIENT_CERT_SESS.
+	Client uint8
+	// Verified reports whether the client presented a certificate that the
+	// proxy verified.
+	Verified   bool
+	Version    string
+	CommonName string
+	Cipher     string
+	SigAlg     string
+	KeyAlg     string
+}
+
+func (h *Header) TLV(t TLVType) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SSL returns the TLS information. ok is false when the client did not
+// connect to the proxy over TLS.
+func (h *Header) SSL() (info SSLInfo, ok bool) {
+	v, ok := h.TLV(TLVTypeSSL)
+	if !ok || len(v) < 5 {
+		return SSLInfo{}, false
+	}
+	info.Client = v[0]
+	info.Verified = binary.BigEndian.Uint32(v[1:5]) == 0
+	subs, err := parseTLVs(v[5:])
+	if err != nil {
+		return SSLInfo{}, false
+	}
+	for _, sub := range subs {
+		switch sub.Type {
+		case sslSubTypeVersion:
+			info.Version = string(sub.Value)
+		case sslSubTypeCN:
+			info.CommonName = string(sub.Value)
+		case sslSubTypeCipher:
+			info.Cipher = string(sub.Value)
+		case sslSubTypeSigAlg:
+			info.SigAlg = string(sub.Value)
+		case sslSubTypeKeyAlg:
+			info.KeyAlg = string(sub.Value)
+		}
+	}
+	return info, info.Client&0x01 != 0
+}
+
+// hasHeader reports whether r starts with a PROXY header. It only peeks
+// beyond the first byte when that byte can start a header.
+func hasHeader(r *bufio.Reader) (bool, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return false, err
+	}
+	var prefix []byte
+	switch b[0] {
+	case v1Prefix[0]:
+		prefix = v1Prefix
+	case v2Signature[0]:
+		prefix = v2Signature
+	default:
+		return false, nil
+	}
+	b, err = r.Peek(len(prefix))
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(b, prefix), nil
+}
+
+// ReadHeader reads a v1 or v2 header from r.
+func ReadHeader(r *bufio.Reader) (*Header, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] == v1Prefix[0] {
+		return readV1(r)
+	}
+	return readV2(r)
+}
+
+func readV1(r *bufio.Reader) (*Header, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read v1 header")
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return nil, errors.New("v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("v1 header does not end with CRLF")
+	}
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if fields[0] != "PROXY" || len(fields) < 2 {
+		return nil, errors.Errorf("invalid v1 header: %q", line)
+	}
+	h := &Header{Version: 1, Command: CommandProxy}
+	switch fields[1] {
+	case "UNKNOWN":
+		h.Command = CommandLocal
+		return h, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, errors.Errorf("invalid v1 protocol: %s", fields[1])
+	}
+	if len(fields) != 6 {
+		return nil, errors.Errorf("invalid v1 header: %q", line)
+	}
+	src, err := parseV1Addr(fields[1], fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseV1Addr(fields[1], fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	h.Source, h.Destination = src, dst
+	return h, nil
+}
+
+func parseV1Addr(protocol, ip, port string) (*net.TCPAddr, error) {
+	a := net.ParseIP(ip)
+	isV4 := !strings.Contains(ip, ":")
+	if a == nil || (protocol == "TCP4") != isV4 {
+		return nil, errors.Errorf("invalid v1 %s address: %s", protocol, ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || (len(port) > 1 && port[0] == '0') {
+		return nil, errors.Errorf("invalid v1 port: %s", port)
+	}
+	return &net.TCPAddr{IP: a, Port: int(p)}, nil
+}
+
+func readV2(r *bufio.Reader) (*Header, error) {
+	b := make([]byte, v2HeaderLength)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, errors.Wrap(err, "failed to read v2 header")
+	}
+	if !bytes.Equal(b[:len(v2Signature)], v2Signature) {
+		return nil, errors.New("invalid v2 signature")
+	}
+	if b[12]>>4 != 2 {
+		return nil, errors.Errorf("invalid v2 version: %d", b[12]>>4)
+	}
+	h := &Header{Version: 2, Command: Command(b[12] & 0x0f)}
+	if h.Command != CommandLocal && h.Command != CommandProxy {
+		return nil, errors.Errorf("invalid v2 command: %d", h.Command)
+	}
+	family := b[13]
+	body := make([]byte, binary.BigEndian.Uint16(b[14:16]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, errors.Wrap(err, "failed to read v2 addresses")
+	}
+
+	var addrLength int
+	switch family {
+	case 0x00: // UNSPEC
+	case 0x11, 0x12: // TCP, UDP over IPv4
+		addrLength = 12
+	case 0x21, 0x22: // TCP, UDP over IPv6
+		addrLength = 36
+	case 0x31, 0x32: // UNIX stream, datagram
+		addrLength = 216
+	default:
+		return nil, errors.Errorf("invalid v2 address family: %#x", family)
+	}
+	if len(body) < addrLength {
+		return nil, errors.Errorf("v2 addresses too short: %d bytes for family %#x", len(body), family)
+	}
+	if h.Command == CommandProxy {
+		h.Source, h.Destination = parseV2Addrs(family, body[:addrLength])
+	}
+	tlvs, err := parseTLVs(body[addrLength:])
+	if err != nil {
+		return nil, err
+	}
+	h.TLVs = tlvs
+	return h, nil
+}
+
+func parseV2Addrs(family byte, b []byte) (src, dst net.Addr) {
+	ipLength := 4
+	switch family {
+	case 0x00:
+		return nil, nil
+	case 0x31, 0x32:
+		network := "unix"
+		if family == 0x32 {
+			network = "unixgram"
+		}
+		name := func(b []byte) string {
+			if i := bytes.IndexByte(b, 0); i >= 0 {
+				b = b[:i]
+			}
+			return string(b)
+		}
+		return &net.UnixAddr{Name: name(b[:108]), Net: network}, &net.UnixAddr{Name: name(b[108:216]), Net: network}
+	case 0x21, 0x22:
+		ipLength = 16
+	}
+	srcIP := net.IP(append([]byte(nil), b[:ipLength]...))
+	dstIP := net.IP(append([]byte(nil), b[ipLength:2*ipLength]...))
+	srcPort := int(binary.BigEndian.Uint16(b[2*ipLength:]))
+	dstPort := int(binary.BigEndian.Uint16(b[2*ipLength+2:]))
+	if family&0x0f == 0x2 {
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}
+	}
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}
+}
+
+func parseTLVs(b []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return nil, errors.New("truncated TLV")
+		}
+		n := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+n {
+			return nil, errors.Errorf("truncated TLV %#x", b[0])
+		}
+		tlvs = append(tlvs, TLV{Type: TLVType(b[0]), Value: b[3 : 3+n]})
+		b = b[3+n:]
+	}
+	return tlvs, nil
+}
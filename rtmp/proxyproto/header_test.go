@@ -0,0 +1,146 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func v2Header(command byte, family byte, addrs []byte, tlvs ...TLV) []byte {
+	body := append([]byte(nil), addrs...)
+	for _, tlv := range tlvs {
+		body = append(body, byte(tlv.Type), 0, 0)
+		binary.BigEndian.PutUint16(body[len(body)-2:], uint16(len(tlv.Value)))
+		body = append(body, tlv.Value...)
+	}
+	b := append([]byte(nil), v2Signature...)
+	b = append(b, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(b[14:], uint16(len(body)))
+	return append(b, body...)
+}
+
+func TestReadHeader(t *testing.T) {
+	ipv4Addrs := []byte{
+		192, 0, 2, 1, // source
+		198, 51, 100, 1, // destination
+		0x30, 0x39, // source port 12345
+		0x07, 0x8f, // destination port 1935
+	}
+	ssl := append([]byte{0x05, 0, 0, 0, 0}, // PP2_CLIENT_SSL|PP2_CLIENT_CERT_SESS, verified
+		sslSubTypeVersion, 0, 7, 'T', 'L', 'S', 'v', '1', '.', '3',
+		sslSubTypeCN, 0, 11, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm',
+	)
+
+	testCases := []struct {
+		name    string
+		in      []byte
+		want    *Header
+		wantSSL *SSLInfo
+		wantErr bool
+	}{
+		{
+			name: "v1 TCP4",
+			in:   []byte("PROXY TCP4 192.0.2.1 198.51.100.1 12345 1935\r\n"),
+			want: &Header{
+				Version:     1,
+				Command:     CommandProxy,
+				Source:      &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 12345},
+				Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 1935},
+			},
+		},
+		{
+			name: "v1 TCP6",
+			in:   []byte("PROXY TCP6 2001:db8::1 2001:db8::2 12345 1935\r\n"),
+			want: &Header{
+				Version:     1,
+				Command:     CommandProxy,
+				Source:      &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 12345},
+				Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 1935},
+			},
+		},
+		{
+			name: "v1 UNKNOWN",
+			in:   []byte("PROXY UNKNOWN\r\n"),
+			want: &Header{Version: 1, Command: CommandLocal},
+		},
+		{
+			name:    "v1 family mismatch",
+			in:      []byte("PROXY TCP4 2001:db8::1 2001:db8::2 12345 1935\r\n"),
+			wantErr: true,
+		},
+		{
+			name:    "v1 without CRLF",
+			in:      []byte("PROXY TCP4 192.0.2.1 198.51.100.1 12345 1935\n"),
+			wantErr: true,
+		},
+		{
+			name:    "v1 too long",
+			in:      append([]byte("PROXY "), bytes.Repeat([]byte("A"), 200)...),
+			wantErr: true,
+		},
+		{
+			name: "v2 TCP4 with SSL",
+			in:   v2Header(0x1, 0x11, ipv4Addrs, TLV{Type: TLVTypeSSL, Value: ssl}),
+			want: &Header{
+				Version:     2,
+				Command:     CommandProxy,
+				Source:      &net.TCPAddr{IP: net.IP{192, 0, 2, 1}, Port: 12345},
+				Destination: &net.TCPAddr{IP: net.IP{198, 51, 100, 1}, Port: 1935},
+				TLVs:        []TLV{{Type: TLVTypeSSL, Value: ssl}},
+			},
+			wantSSL: &SSLInfo{
+				Client:     0x05,
+				Verified:   true,
+				Version:    "TLSv1.3",
+				CommonName: "example.com",
+			},
+		},
+		{
+			name: "v2 LOCAL",
+			in:   v2Header(0x0, 0x11, ipv4Addrs),
+			want: &Header{Version: 2, Command: CommandLocal},
+		},
+		{
+			name:    "v2 addresses too short",
+			in:      v2Header(0x1, 0x21, ipv4Addrs),
+			wantErr: true,
+		},
+		{
+			name:    "v2 truncated TLV",
+			in:      v2Header(0x1, 0x11, append(ipv4Addrs, byte(TLVTypeAuthority), 0, 10, 'a')),
+			wantErr: true,
+		},
+		{
+			name:    "v2 invalid command",
+			in:      v2Header(0x2, 0x11, ipv4Addrs),
+			wantErr: true,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(bytes.NewReader(append(tt.in, 0x03)))
+			got, err := ReadHeader(r)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, got)
+			if tt.wantSSL != nil {
+				ssl, ok := got.SSL()
+				assert.True(t, ok)
+				assert.Equal(t, *tt.wantSSL, ssl)
+			}
+			// the first byte after the header is left for RTMP
+			b, err := r.ReadByte()
+			assert.NoError(t, err)
+			assert.Equal(t, byte(0x03), b)
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package proxyproto
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultHeaderTimeout = 5 * time.Second
+
+var errListenerClosed = errors.New("proxyproto: listener closed")
+
+// Listener wraps a net.Listener and reads the PROXY header of each accepted
+// connection before Accept returns it. Headers are read in a goroutine per
+// connection, so a slow peer does not hold up the others.
+//
+// Only sources set by WithTrustedSources may send a header. A header from
+// any other source, a malformed header and, with WithHeaderRequired, a
+// missing header from a trusted source close the connection.
+type Listener struct {
+	net.Listener
+
+	trustedSources []*net.IPNet
+	headerRequired bool
+	headerTimeout  time.Duration
+	onError        func(remoteAddr net.Addr, err error)
+
+	startOnce sync.Once
+	conns     chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+type Option func(*Listener)
+
+// WithTrustedSources sets the sources allowed to send a header, e.g. the
+// subnets of the load balancers. No source is trusted by default, so a
+// Listener without trusted sources closes every connection with a header.
+func WithTrustedSources(trustedSources ...*net.IPNet) Option {
+	return func(l *Listener) {
+		l.trustedSources = append(l.trustedSources, trustedSources...)
+	}
+}
+
+// WithHeaderRequired closes connections from trusted sources that do not
+// start with a header.
+func WithHeaderRequired() Option {
+	return func(l *Listener) {
+		l.headerRequired = true
+	}
+}
+
+// WithHeaderTimeout limits how long reading the header may take.
+func WithHeaderTimeout(headerTimeout time.Duration) Option {
+	return func(l *Listener) {
+		l.headerTimeout = headerTimeout
+	}
+}
+
+// WithErrorHandler is called for every connection closed because of its
+// header.
+func WithErrorHandler(onError func(remoteAddr net.Addr, err error)) Option {
+	return func(l *Listener) {
+		l.onError = onError
+	}
+}
+
+func NewListener(l net.Listener, ops ...Option) *Listener {
+	pl := &Listener{
+		Listener:      l,
+		headerTimeout: defaultHeaderTimeout,
+		conns:         make(chan acceptResult),
+		done:          make(chan struct{}),
+	}
+	for _, o := range ops {
+		o(pl)
+	}
+	return pl
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	l.startOnce.Do(func() {
+		go l.acceptLoop()
+	})
+	select {
+	case r := <-l.conns:
+		return r.conn, r.err
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+}
+
+func (l *Listener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.conns <- acceptResult{err: err}:
+			case <-l.done:
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		go l.handle(c)
+	}
+}
+
+func (l *Listener) handle(c net.Conn) {
+	pc, err := l.readHeader(c)
+	if err != nil {
+		c.Close()
+		if l.onError != nil {
+			l.onError(c.RemoteAddr(), err)
+		}
+		return
+	}
+	select {
+	case l.conns <- acceptResult{conn: pc}:
+	case <-l.done:
+		c.Close()
+	}
+}
+
+func (l *Listener) readHeader(c net.Conn) (*Conn, error) {
+	if err := c.SetReadDeadline(time.Now().Add(l.headerTimeout)); err != nil {
+		return nil, errors.Wrap(err, "failed to SetReadDeadline")
+	}
+	pc := &Conn{
+		Conn: c,
+		r:    bufio.NewReader(c),
+	}
+	ok, err := hasHeader(pc.r)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to detect header")
+	}
+	trusted := l.isTrusted(c.RemoteAddr())
+	switch {
+	case ok && !trusted:
+		return nil, errors.New("header from untrusted source")
+	case !ok && trusted && l.headerRequired:
+		return nil, errors.New("header is missing")
+	case ok:
+		if pc.header, err = ReadHeader(pc.r); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.SetReadDeadline(time.Time{}); err != nil {
+		return nil, errors.Wrap(err, "failed to SetReadDeadline")
+	}
+	return pc, nil
+}
+
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	a, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range l.trustedSources {
+		if n.Contains(a.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops accepting connections. Connections that are still sending
+// their header are closed when they are done.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+	return l.Listener.Close()
+}
+
+// Conn is a connection accepted by Listener. Its addresses are the ones in
+// the header, if any.
+type Conn struct {
+	net.Conn
+	r      *bufio.Reader
+	header *Header
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// Header returns the PROXY header, or nil if the connection had none.
+func (c *Conn) Header() *Header {
+	return c.header
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	if c.header != nil && c.header.Command == CommandProxy && c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	if c.header != nil && c.header.Command == CommandProxy && c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
@@ -0,0 +1,117 @@
+package proxyproto
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListener(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, elsewhere, _ := net.ParseCIDR("192.0.2.0/24")
+
+	testCases := []struct {
+		name           string
+		ops            []Option
+		send           string
+		wantRemoteAddr string
+		wantRejected   bool
+	}{
+		{
+			name:           "trusted with header",
+			ops:            []Option{WithTrustedSources(loopback)},
+			send:           "PROXY TCP4 192.0.2.1 198.51.100.1 12345 1935\r\n\x03",
+			wantRemoteAddr: "192.0.2.1:12345",
+		},
+		{
+			name: "trusted without header",
+			ops:  []Option{WithTrustedSources(loopback)},
+			send: "\x03",
+		},
+		{
+			name:         "trusted without required header",
+			ops:          []Option{WithTrustedSources(loopback), WithHeaderRequired()},
+			send:         "\x03",
+			wantRejected: true,
+		},
+		{
+			name:         "untrusted with header",
+			ops:          []Option{WithTrustedSources(elsewhere)},
+			send:         "PROXY TCP4 192.0.2.1 198.51.100.1 12345 1935\r\n\x03",
+			wantRejected: true,
+		},
+		{
+			name: "untrusted without header",
+			ops:  []Option{WithTrustedSources(elsewhere)},
+			send: "\x03",
+		},
+		{
+			name:         "no trusted sources with header",
+			send:         "PROXY TCP4 192.0.2.1 198.51.100.1 12345 1935\r\n\x03",
+			wantRejected: true,
+		},
+		{
+			name: "no trusted sources without header",
+			send: "\x03",
+		},
+		{
+			name:         "malformed",
+			ops:          []Option{WithTrustedSources(loopback)},
+			send:         "PROXY TCP4 192.0.2.1\r\n\x03",
+			wantRejected: true,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			nl, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			rejected := make(chan error, 1)
+			l := NewListener(nl, append(tt.ops,
+				WithHeaderTimeout(time.Second),
+				WithErrorHandler(func(_ net.Addr, err error) { rejected <- err }),
+			)...)
+			defer l.Close()
+
+			c, err := net.Dial("tcp", nl.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			_, err = io.WriteString(c, tt.send)
+			assert.NoError(t, err)
+
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				if c, err := l.Accept(); err == nil {
+					accepted <- c
+				}
+			}()
+
+			select {
+			case err := <-rejected:
+				assert.True(t, tt.wantRejected, "rejected: %v", err)
+			case ac := <-accepted:
+				defer ac.Close()
+				if !assert.False(t, tt.wantRejected) {
+					return
+				}
+				want := tt.wantRemoteAddr
+				if want == "" {
+					want = c.LocalAddr().String()
+				}
+				assert.Equal(t, want, ac.RemoteAddr().String())
+				b := make([]byte, 1)
+				_, err := io.ReadFull(ac, b)
+				assert.NoError(t, err)
+				assert.Equal(t, []byte{0x03}, b)
+			case <-time.After(3 * time.Second):
+				t.Fatal("timeout")
+			}
+		})
+	}
+}
@@ -16,7 +16,6 @@ type Reader interface {
 	AbortMessage(chunkStreamID uint32)
 	SetBandwidthLimitType(bandwidthLimitType BandwidthLimitType)
 	SetAcknowledgementWindowSize(acknowledgementWindowSize uint32)
-	CreateStream() (streamID uint32)
 }
 
 type reader Reader
@@ -31,7 +30,12 @@ type defaultReader struct {
 	preAcknowledgementThreshold uint32
 	sequenceNumber              uint32
 
-	logger *zap.Logger
+	readerOptions
+	bufferPool    *bufferPool
+	bufferedBytes uint32
+
+	metrics Metrics
+	logger  *zap.Logger
 }
 
 func NewDefaultReader(
@@ -39,13 +43,21 @@ func NewDefaultReader(
 	r io.Reader,
 	acknowledgementWindowSize uint32,
 	logger *zap.Logger,
+	readerOps ...ReaderOption,
 ) Reader {
+	ops := newReaderOptions()
+	for _, o := range readerOps {
+		o(&ops)
+	}
 	return &defaultReader{
 		conn:                      conn,
 		r:                         bufio.NewReader(r),
 		chunkSize:                 128, /* default RTMP Chunk size */
 		chunkStreams:              map[uint32]chunkStream{},
 		acknowledgementWindowSize: acknowledgementWindowSize,
+		readerOptions:             ops,
+		bufferPool:                defaultBufferPool,
+		metrics:                   connMetrics(conn),
 		logger:                    logger,
 	}
 }
@@ -62,37 +74,62 @@ func (y *defaultReader) ReadMessage() (Message, error) {
 			return nil, errors.Wrap(err, "failed to ReadChunkHeader")
 		}
 		csID := h.BasicHeader().ChunkStreamID()
-		cs := y.chunkStreams[csID]
+		cs, ok := y.chunkStreams[csID]
+		if !ok && y.maxChunkStreams > 0 && len(y.chunkStreams) >= y.maxChunkStreams {
+			return nil, NewConnFatalError(
+				errors.Errorf("too many chunk streams: max %d", y.maxChunkStreams),
+				zap.Uint32("chunkStreamID", csID),
+			)
+		}
 
 		switch mh := h.MessageHeader().(type) {
 		case ChunkMessageHeaderType0:
+			y.dropUnfinished(&cs)
 			cs.messageLength = mh.MessageLength()
 			cs.messageTypeID = mh.MessageTypeID()
 			cs.messageStreamID = mh.MessageStreamID()
 			cs.timestampDelta = 0
-			cs.timestamp = mh.Timestamp()
-			if uint32(len(cs.buffer)) < cs.messageLength {
-				cs.buffer = make([]byte, cs.messageLength)
+			cs.timestamp = h.Timestamp()
+			if err := y.startMessage(csID, &cs); err != nil {
+				return nil, err
 			}
 			y.sequenceNumber += 11
 		case ChunkMessageHeaderType1:
+			y.dropUnfinished(&cs)
 			cs.messageLength = mh.MessageLength()
 			cs.messageTypeID = mh.MessageTypeID()
-			cs.timestampDelta = mh.TimestampDelta()
+			cs.timestampDelta = h.TimestampDelta()
 			cs.timestamp += cs.timestampDelta
-			if uint32(len(cs.buffer)) < cs.messageLength {
-				cs.buffer = make([]byte, cs.messageLength)
+			if err := y.startMessage(csID, &cs); err != nil {
+				return nil, err
 			}
 			y.sequenceNumber += 7
 		case ChunkMessageHeaderType2:
-			cs.timestampDelta = mh.TimestampDelta()
+			cs.timestampDelta = h.TimestampDelta()
 			cs.timestamp += cs.timestampDelta
 			y.sequenceNumber += 3
 		case ChunkMessageHeaderType3:
+			if cs.extendedTimestamp != 0 {
+				ok, err := y.skipType3ExtendedTimestamp(&cs)
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to ReadExtendedTimestamp")
+				}
+				if ok {
+					y.sequenceNumber += 4
+				}
+			}
 			if cs.buffered == 0 {
 				cs.timestamp += cs.timestampDelta
 			}
 		}
+		if mh := h.MessageHeader(); mh.NeedsExtendedTimestamp() {
+			cs.extendedTimestamp = h.ExtendedTimestamp()
+			y.sequenceNumber += 4
+		} else if h.BasicHeader().Fmt() != 3 {
+			// every message header satisfies ChunkMessageHeaderType3, so the
+			// format tells a type 3 chunk apart
+			cs.extendedTimestamp = 0
+		}
 
 		switch h.BasicHeader().(type) {
 		case ChunkBasicHeader1B:
@@ -110,12 +147,18 @@ func (y *defaultReader) ReadMessage() (Message, error) {
 				cs.messageTypeID,
 				cs.timestamp,
 				cs.messageStreamID,
-				cs.buffer[:cs.messageLength],
+				nil,
 			)
 			cs.buffered = 0
 			y.chunkStreams[csID] = cs
+			y.metrics.MessageRead(cs.messageTypeID)
 			return m, nil
 		}
+		if cs.buffer == nil {
+			if err := y.acquireBuffer(csID, &cs); err != nil {
+				return nil, err
+			}
+		}
 
 		length := cs.messageLength - cs.buffered
 		if length > y.chunkSize {
@@ -129,15 +172,21 @@ func (y *defaultReader) ReadMessage() (Message, error) {
 		y.sequenceNumber += length
 		y.sendAcknowledgementIfNeeded()
 		if cs.buffered == cs.messageLength {
-			m := NewMessage(
+			// the payload is handed over to the message; the next message on
+			// this chunk stream gets a fresh buffer from the pool.
+			m := newPooledMessage(
 				csID,
 				cs.messageTypeID,
 				cs.timestamp,
 				cs.messageStreamID,
 				cs.buffer[:cs.messageLength],
+				y.bufferPool,
 			)
+			y.bufferedBytes -= uint32(cap(cs.buffer))
+			cs.buffer = nil
 			cs.buffered = 0
 			y.chunkStreams[csID] = cs
+			y.metrics.MessageRead(cs.messageTypeID)
 			return m, nil
 		}
 
@@ -150,9 +199,96 @@ func (r *defaultReader) SetChunkSize(chunkSize uint32) {
 }
 
 func (r *defaultReader) AbortMessage(chunkStreamID uint32) {
+	if cs, ok := r.chunkStreams[chunkStreamID]; ok {
+		r.dropUnfinished(&cs)
+		r.releaseBuffer(&cs)
+	}
 	delete(r.chunkStreams, chunkStreamID)
 }
 
+// skipType3ExtendedTimestamp consumes the extended timestamp which a type 3
+// chunk carries when the preceding header of its chunk stream had one.
+// Some encoders (older FFmpeg/librtmp among them) omit the field on type 3
+// chunks, so unless a reader option says which, the first such chunk of
+// each chunk stream decides: the field is taken as present when it repeats
+// the previous value, and the chunks that follow are read the same way.
+func (r *defaultReader) skipType3ExtendedTimestamp(cs *chunkStream) (bool, error) {
+	if cs.type3ExtendedTimestamp == type3ExtendedTimestampUnknown {
+		cs.type3ExtendedTimestamp = r.type3ExtendedTimestamp
+	}
+	switch cs.type3ExtendedTimestamp {
+	case type3ExtendedTimestampOmitted:
+		return false, nil
+	case type3ExtendedTimestampRepeated:
+		_, err := r.r.Discard(4)
+		return err == nil, err
+	}
+	b, err := r.r.Peek(4)
+	if err == io.EOF {
+		// the chunk data is shorter than the field would be
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if BigEndianToUint32(b) != cs.extendedTimestamp {
+		cs.type3ExtendedTimestamp = type3ExtendedTimestampOmitted
+		return false, nil
+	}
+	cs.type3ExtendedTimestamp = type3ExtendedTimestampRepeated
+	_, err = r.r.Discard(4)
+	return err == nil, err
+}
+
+// startMessage validates the length of a new message on cs against the
+// limit for its type and drops whatever was left of an unfinished one.
+func (r *defaultReader) startMessage(chunkStreamID uint32, cs *chunkStream) error {
+	r.releaseBuffer(cs)
+	if max := r.maxMessageSize(cs.messageTypeID); cs.messageLength > max {
+		return NewConnFatalError(
+			errors.Errorf("message too large: length %d: max %d", cs.messageLength, max),
+			zap.Uint32("chunkStreamID", chunkStreamID),
+			zap.Stringer("messageTypeID", cs.messageTypeID),
+		)
+	}
+	return nil
+}
+
+// acquireBuffer takes a buffer for the current message of cs from the pool,
+// enforcing the per connection buffered bytes limit.
+func (r *defaultReader) acquireBuffer(chunkStreamID uint32, cs *chunkStream) error {
+	b := r.bufferPool.Get(cs.messageLength)
+	if r.maxBufferedBytes > 0 && uint64(r.bufferedBytes)+uint64(cap(b)) > uint64(r.maxBufferedBytes) {
+		r.bufferPool.Put(b)
+		return NewConnFatalError(
+			errors.Errorf("too many buffered bytes: max %d", r.maxBufferedBytes),
+			zap.Uint32("chunkStreamID", chunkStreamID),
+			zap.Uint32("bufferedBytes", r.bufferedBytes),
+			zap.Uint32("messageLength", cs.messageLength),
+		)
+	}
+	cs.buffer = b
+	r.bufferedBytes += uint32(cap(b))
+	return nil
+}
+
+// dropUnfinished counts a media message of cs which will not be completed.
+func (r *defaultReader) dropUnfinished(cs *chunkStream) {
+	if cs.buffered > 0 && isMediaMessage(cs.messageTypeID) {
+		r.metrics.FrameDropped(cs.messageTypeID)
+	}
+}
+
+func (r *defaultReader) releaseBuffer(cs *chunkStream) {
+	if cs.buffer == nil {
+		return
+	}
+	r.bufferedBytes -= uint32(cap(cs.buffer))
+	r.bufferPool.Put(cs.buffer)
+	cs.buffer = nil
+	cs.buffered = 0
+}
+
 func (r *defaultReader) SetBandwidthLimitType(bandwidthLimitType BandwidthLimitType) {
 	r.bandwidthLimitType = bandwidthLimitType
 }
@@ -171,16 +307,6 @@ func (r *defaultReader) sendAcknowledgementIfNeeded() {
 			return
 		}
 		r.preAcknowledgementThreshold += r.acknowledgementWindowSize
+		r.metrics.AcknowledgementSent()
 	}
 }
-
-func (r *defaultReader) CreateStream() (streamID uint32) {
-	for i := uint32(3); true; i++ {
-		if _, ok := r.chunkStreams[i]; !ok {
-			r.chunkStreams[i] = chunkStream{ID: i}
-			return i
-		}
-	}
-	// dummy
-	return 0
-}
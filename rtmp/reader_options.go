@@ -0,0 +1,86 @@
+package rtmp
+
+type readerOptions struct {
+	maxMessageSizes       map[MessageTypeID]uint32
+	defaultMaxMessageSize uint32
+	maxChunkStreams       int
+	maxBufferedBytes      uint32
+
+	type3ExtendedTimestamp type3ExtendedTimestamp
+}
+
+// type3ExtendedTimestamp is whether type 3 chunks following a header with
+// an extended timestamp repeat it.
+type type3ExtendedTimestamp int
+
+const (
+	// type3ExtendedTimestampUnknown detects it on the first such chunk.
+	type3ExtendedTimestampUnknown type3ExtendedTimestamp = iota
+	type3ExtendedTimestampRepeated
+	type3ExtendedTimestampOmitted
+)
+
+type ReaderOption func(*readerOptions)
+
+func newReaderOptions() readerOptions {
+	maxMessageSizes := make(map[MessageTypeID]uint32, len(defaultMaxMessageSizes))
+	for k, v := range defaultMaxMessageSizes {
+		maxMessageSizes[k] = v
+	}
+	return readerOptions{
+		maxMessageSizes:       maxMessageSizes,
+		defaultMaxMessageSize: defaultMaxMessageSize,
+		maxChunkStreams:       defaultMaxChunkStreams,
+		maxBufferedBytes:      defaultMaxBufferedBytes,
+	}
+}
+
+// WithMaxMessageSize limits the length of messages of the given type.
+func WithMaxMessageSize(messageTypeID MessageTypeID, maxMessageSize uint32) ReaderOption {
+	return func(o *readerOptions) {
+		o.maxMessageSizes[messageTypeID] = maxMessageSize
+	}
+}
+
+// WithDefaultMaxMessageSize limits the length of messages whose type has no
+// limit of its own.
+func WithDefaultMaxMessageSize(maxMessageSize uint32) ReaderOption {
+	return func(o *readerOptions) {
+		o.defaultMaxMessageSize = maxMessageSize
+	}
+}
+
+// WithMaxChunkStreams limits the number of chunk streams a peer may open.
+// Zero means unlimited.
+func WithMaxChunkStreams(maxChunkStreams int) ReaderOption {
+	return func(o *readerOptions) {
+		o.maxChunkStreams = maxChunkStreams
+	}
+}
+
+// WithMaxBufferedBytes limits the bytes buffered across all chunk streams.
+// Zero means unlimited.
+func WithMaxBufferedBytes(maxBufferedBytes uint32) ReaderOption {
+	return func(o *readerOptions) {
+		o.maxBufferedBytes = maxBufferedBytes
+	}
+}
+
+// WithType3ExtendedTimestamp sets whether the peer repeats the extended
+// timestamp on type 3 chunks, as the spec requires, instead of detecting it
+// per chunk stream. Some encoders (older FFmpeg/librtmp among them) omit it.
+func WithType3ExtendedTimestamp(repeated bool) ReaderOption {
+	return func(o *readerOptions) {
+		o.type3ExtendedTimestamp = type3ExtendedTimestampOmitted
+		if repeated {
+			o.type3ExtendedTimestamp = type3ExtendedTimestampRepeated
+		}
+	}
+}
+
+func (o readerOptions) maxMessageSize(messageTypeID MessageTypeID) uint32 {
+	if v, ok := o.maxMessageSizes[messageTypeID]; ok {
+		return v
+	}
+	return o.defaultMaxMessageSize
+}
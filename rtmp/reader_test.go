@@ -0,0 +1,113 @@
+package rtmp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDefaultReader_ReadMessage_Limits(t *testing.T) {
+	type0 := func(csID uint32, length uint32, typeID MessageTypeID) []byte {
+		b, err := NewChunkHeader(
+			GenerateChunkBasicHeader(0, csID),
+			NewChunkMessageHeaderType0(0, length, typeID, 1),
+			0,
+		).MarshalBinary()
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+
+	t.Run("within limits", func(t *testing.T) {
+		b := append(type0(3, 4, MessageTypeIDAudio), 0x1, 0x2, 0x3, 0x4)
+		r := NewDefaultReader(nil, bytes.NewReader(b), defaultWindowAcknowledgementSize, zap.NewNop())
+		m, err := r.ReadMessage()
+		if assert.NoError(t, err) {
+			assert.Equal(t, []byte{0x1, 0x2, 0x3, 0x4}, m.Payload())
+		}
+	})
+
+	t.Run("message too large", func(t *testing.T) {
+		b := type0(3, 0x100, MessageTypeIDSetChunkSize)
+		r := NewDefaultReader(nil, bytes.NewReader(b), defaultWindowAcknowledgementSize, zap.NewNop())
+		_, err := r.ReadMessage()
+		assert.True(t, IsConnFatalError(err))
+	})
+
+	t.Run("message too large: custom limit", func(t *testing.T) {
+		b := type0(3, 0x100, MessageTypeIDAudio)
+		r := NewDefaultReader(
+			nil,
+			bytes.NewReader(b),
+			defaultWindowAcknowledgementSize,
+			zap.NewNop(),
+			WithMaxMessageSize(MessageTypeIDAudio, 0xff),
+		)
+		_, err := r.ReadMessage()
+		assert.True(t, IsConnFatalError(err))
+	})
+
+	t.Run("too many chunk streams", func(t *testing.T) {
+		b := []byte{}
+		for i := uint32(3); i < 6; i++ {
+			b = append(b, type0(i, 0x1000, MessageTypeIDVideo)...)
+			b = append(b, make([]byte, 128)...)
+		}
+		r := NewDefaultReader(
+			nil,
+			bytes.NewReader(b),
+			defaultWindowAcknowledgementSize,
+			zap.NewNop(),
+			WithMaxChunkStreams(2),
+		)
+		_, err := r.ReadMessage()
+		assert.True(t, IsConnFatalError(err))
+	})
+
+	t.Run("too many buffered bytes", func(t *testing.T) {
+		b := []byte{}
+		for i := uint32(3); i < 6; i++ {
+			b = append(b, type0(i, 0x1000, MessageTypeIDVideo)...)
+			b = append(b, make([]byte, 128)...)
+		}
+		r := NewDefaultReader(
+			nil,
+			bytes.NewReader(b),
+			defaultWindowAcknowledgementSize,
+			zap.NewNop(),
+			WithMaxBufferedBytes(0x2000),
+		)
+		_, err := r.ReadMessage()
+		assert.True(t, IsConnFatalError(err))
+	})
+
+	t.Run("payload is owned by the message", func(t *testing.T) {
+		b := append(type0(3, 4, MessageTypeIDAudio), 0x1, 0x2, 0x3, 0x4)
+		b = append(b, 0xc3) // fmt 3, chunk stream 3
+		b = append(b, 0x5, 0x6, 0x7, 0x8)
+		r := NewDefaultReader(nil, bytes.NewReader(b), defaultWindowAcknowledgementSize, zap.NewNop())
+
+		m1, err := r.ReadMessage()
+		if !assert.NoError(t, err) {
+			return
+		}
+		m1.Retain()
+		m1.Release()
+
+		m2, err := r.ReadMessage()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, []byte{0x1, 0x2, 0x3, 0x4}, m1.Payload())
+		assert.Equal(t, []byte{0x5, 0x6, 0x7, 0x8}, m2.Payload())
+		assert.Zero(t, r.(*defaultReader).bufferedBytes)
+
+		m1.Release()
+		assert.Nil(t, m1.Payload())
+		assert.Panics(t, m1.Release)
+		m2.Release()
+	})
+}
@@ -0,0 +1,181 @@
+package rtmpt
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// maxBuffered caps the bytes a buffer holds. Writes past it block until
+// the other side takes some, so a peer that stops polling or reading cannot
+// grow the buffer without limit.
+const maxBuffered = 1 << 20
+
+// buffer is one direction of a tunnelled connection. Reads block until data
+// is written, the buffer is closed or the read deadline passes, and writes
+// block while the buffer is full.
+type buffer struct {
+	mu            sync.Mutex
+	b             bytes.Buffer
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	notify        chan struct{}
+}
+
+func newBuffer() *buffer {
+	return &buffer{
+		notify: make(chan struct{}),
+	}
+}
+
+// broadcast wakes everyone waiting on the buffer. mu must be held.
+func (b *buffer) broadcast() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+func (b *buffer) Read(p []byte) (int, error) {
+	for {
+		b.mu.Lock()
+		if l := b.b.Len(); l > 0 {
+			n, err := b.b.Read(p)
+			if l >= maxBuffered {
+				// a writer may be waiting for room
+				b.broadcast()
+			}
+			b.mu.Unlock()
+			return n, err
+		}
+		if b.closed {
+			b.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline, notify := b.readDeadline, b.notify
+		b.mu.Unlock()
+
+		if err := wait(notify, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	n := 0
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return n, io.ErrClosedPipe
+		}
+		if room := maxBuffered - b.b.Len(); room > 0 && n < len(p) {
+			m := len(p) - n
+			if m > room {
+				m = room
+			}
+			b.b.Write(p[n : n+m])
+			n += m
+			b.broadcast()
+		}
+		if n == len(p) {
+			b.mu.Unlock()
+			return n, nil
+		}
+		deadline, notify := b.writeDeadline, b.notify
+		b.mu.Unlock()
+
+		if err := wait(notify, deadline); err != nil {
+			return n, err
+		}
+	}
+}
+
+// Drain returns everything buffered without blocking.
+func (b *buffer) Drain() []byte {
+	p, _ := b.DrainClosed()
+	return p
+}
+
+// DrainClosed is Drain that also reports whether the buffer is closed. Both
+// are taken at once, so no write can land in between and be lost.
+func (b *buffer) DrainClosed() ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p := make([]byte, b.b.Len())
+	copy(p, b.b.Bytes())
+	b.b.Reset()
+	if len(p) >= maxBuffered {
+		b.broadcast()
+	}
+	return p, b.closed
+}
+
+// Wait returns a channel that is closed on the next write or close.
+func (b *buffer) Wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.b.Len() > 0 || b.closed {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	return b.notify
+}
+
+func (b *buffer) SetReadDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.readDeadline = t
+	b.broadcast()
+}
+
+func (b *buffer) SetWriteDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.writeDeadline = t
+	b.broadcast()
+}
+
+func (b *buffer) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.broadcast()
+	}
+}
+
+func (b *buffer) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// wait blocks until notify is closed or the deadline, if any, passes.
+func wait(notify <-chan struct{}, deadline time.Time) error {
+	if deadline.IsZero() {
+		<-notify
+		return nil
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return errTimeout
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-notify:
+		return nil
+	case <-t.C:
+		return errTimeout
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var errTimeout error = timeoutError{}
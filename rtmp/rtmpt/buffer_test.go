@@ -0,0 +1,49 @@
+package rtmpt
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuffer_WriteBlocksWhenFull(t *testing.T) {
+	b := newBuffer()
+	b.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	n, err := b.Write(make([]byte, maxBuffered+10))
+	assert.Equal(t, maxBuffered, n)
+	if assert.Error(t, err) {
+		assert.True(t, err.(interface{ Timeout() bool }).Timeout())
+	}
+
+	b.SetWriteDeadline(time.Time{})
+	written := make(chan int, 1)
+	go func() {
+		n, _ := b.Write(make([]byte, 10))
+		written <- n
+	}()
+	select {
+	case <-written:
+		t.Fatal("write did not block on a full buffer")
+	case <-time.After(20 * time.Millisecond):
+	}
+	p, closed := b.DrainClosed()
+	assert.Len(t, p, maxBuffered)
+	assert.False(t, closed)
+	assert.Equal(t, 10, <-written)
+
+	go func() {
+		n, _ := b.Write(make([]byte, maxBuffered))
+		written <- n
+	}()
+	time.Sleep(20 * time.Millisecond)
+	b.Close()
+	assert.Equal(t, maxBuffered-10, <-written)
+	p, closed = b.DrainClosed()
+	assert.Len(t, p, maxBuffered)
+	assert.True(t, closed)
+
+	_, err = b.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
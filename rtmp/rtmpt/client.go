@@ -0,0 +1,124 @@
+package rtmpt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// pollUnit is the idle polling delay per unit of the interval byte.
+const pollUnit = 10 * time.Millisecond
+
+type clientConn struct {
+	*conn
+	baseURL string
+	client  *http.Client
+	id      string
+	seq     uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Dial opens an RTMPT session at baseURL, e.g. "http://example.com:80", and
+// returns it as a net.Conn. A nil client means http.DefaultClient.
+func Dial(ctx context.Context, baseURL string, client *http.Client) (net.Conn, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := &clientConn{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	b, err := c.post(ctx, "/open/1", []byte{0x00})
+	if err != nil {
+		c.cancel()
+		return nil, errors.Wrap(err, "failed to open session")
+	}
+	c.id = strings.TrimSpace(string(b))
+	if c.id == "" {
+		c.cancel()
+		return nil, errors.New("failed to open session: empty session ID")
+	}
+
+	c.conn = newConn(addr("rtmpt"), addr(c.baseURL), c.closeSession)
+	go c.poll()
+	return c, nil
+}
+
+// poll sends written bytes as soon as they are buffered and polls for the
+// server's bytes in between, as often as the server's interval byte asks.
+func (c *clientConn) poll() {
+	interval := idleIntervals[0]
+	for {
+		t := time.NewTimer(time.Duration(interval) * pollUnit)
+		select {
+		case <-c.out.Wait():
+		case <-t.C:
+		case <-c.ctx.Done():
+			t.Stop()
+			return
+		}
+		t.Stop()
+		if c.out.Closed() {
+			return
+		}
+
+		command, body := "idle", []byte{0x00}
+		if data := c.out.Drain(); len(data) > 0 {
+			command, body = "send", data
+		}
+		b, err := c.post(c.ctx, c.path(command), body)
+		if err != nil || len(b) == 0 {
+			c.in.Close()
+			c.out.Close()
+			return
+		}
+		interval = b[0]
+		if len(b) > 1 {
+			c.in.Write(b[1:])
+		}
+	}
+}
+
+func (c *clientConn) closeSession() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.cancel()
+	c.post(ctx, c.path("close"), []byte{0x00})
+}
+
+func (c *clientConn) path(command string) string {
+	seq := atomic.AddUint64(&c.seq, 1)
+	return "/" + command + "/" + c.id + "/" + strconv.FormatUint(seq, 10)
+}
+
+func (c *clientConn) post(ctx context.Context, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to POST %s", path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil, errors.Errorf("failed to POST %s: %s", path, resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+}
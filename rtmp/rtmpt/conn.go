@@ -0,0 +1,87 @@
+package rtmpt
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// conn is the net.Conn of a tunnelled connection. Bytes written to it are
+// buffered in out until the next HTTP exchange picks them up, and bytes
+// received in HTTP bodies are buffered in in until they are read.
+type conn struct {
+	in  *buffer
+	out *buffer
+
+	localAddr  net.Addr
+	remoteAddr net.Addr
+
+	closeOnce sync.Once
+	onClose   func()
+}
+
+func newConn(localAddr, remoteAddr net.Addr, onClose func()) *conn {
+	return &conn{
+		in:         newBuffer(),
+		out:        newBuffer(),
+		localAddr:  localAddr,
+		remoteAddr: remoteAddr,
+		onClose:    onClose,
+	}
+}
+
+func (c *conn) Read(p []byte) (int, error) {
+	return c.in.Read(p)
+}
+
+func (c *conn) Write(p []byte) (int, error) {
+	return c.out.Write(p)
+}
+
+// Close stops both directions. Bytes already written can still be drained
+// from out.
+func (c *conn) Close() error {
+	c.closeOnce.Do(func() {
+		c.in.Close()
+		c.out.Close()
+		if c.onClose != nil {
+			c.onClose()
+		}
+	})
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+func (c *conn) SetDeadline(t time.Time) error {
+	c.in.SetReadDeadline(t)
+	c.out.SetWriteDeadline(t)
+	return nil
+}
+
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.in.SetReadDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline bounds writes, which block while out is full.
+func (c *conn) SetWriteDeadline(t time.Time) error {
+	c.out.SetWriteDeadline(t)
+	return nil
+}
+
+type addr string
+
+func (a addr) Network() string {
+	return "rtmpt"
+}
+
+func (a addr) String() string {
+	return string(a)
+}
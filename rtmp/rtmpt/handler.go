@@ -0,0 +1,248 @@
+// Package rtmpt tunnels RTMP over HTTP POST requests.
+//
+// A client opens a session with POST /open/1, then sends its bytes with
+// POST /send/{session}/{seq} and polls for the server's bytes with
+// POST /idle/{session}/{seq}. Every response starts with a polling interval
+// byte, which grows while the session is idle, followed by the pending bytes.
+// POST /close/{session}/{seq} ends the session.
+package rtmpt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	contentType = "application/x-fcs"
+
+	defaultSessionTimeout = 30 * time.Second
+	maxBodySize           = 1 << 20
+)
+
+// idleIntervals are the polling interval bytes sent for consecutive
+// exchanges without data.
+var idleIntervals = []byte{0x01, 0x03, 0x05, 0x09, 0x11, 0x21}
+
+var errHandlerClosed = errors.New("rtmpt: handler closed")
+
+// Handler serves RTMPT sessions over HTTP and hands each session to Accept
+// as a net.Conn, so an RTMP server can Serve it like a TCP listener.
+type Handler struct {
+	sessionTimeout time.Duration
+
+	mu       sync.Mutex
+	sessions map[ /* session ID */ string]*session
+
+	acceptc   chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type HandlerOption func(*Handler)
+
+// WithSessionTimeout closes sessions that make no request for
+// sessionTimeout.
+func WithSessionTimeout(sessionTimeout time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.sessionTimeout = sessionTimeout
+	}
+}
+
+func NewHandler(ops ...HandlerOption) *Handler {
+	h := &Handler{
+		sessionTimeout: defaultSessionTimeout,
+		sessions:       map[string]*session{},
+		acceptc:        make(chan net.Conn),
+		done:           make(chan struct{}),
+	}
+	for _, o := range ops {
+		o(h)
+	}
+	return h
+}
+
+type session struct {
+	*conn
+	id string
+
+	mu      sync.Mutex // serializes exchanges
+	lastSeq uint64
+	idle    int
+	timer   *time.Timer
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > maxBodySize {
+		http.Error(w, "body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case parts[0] == "open" && len(parts) == 2:
+		h.open(w, r)
+	case (parts[0] == "send" || parts[0] == "idle" || parts[0] == "close") && len(parts) == 3:
+		seq, err := strconv.ParseUint(parts[2], 10, 64)
+		if err != nil {
+			http.Error(w, "invalid sequence number", http.StatusBadRequest)
+			return
+		}
+		s, ok := h.session(parts[1])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if parts[0] == "close" {
+			h.close(w, s)
+			return
+		}
+		if parts[0] == "idle" {
+			body = nil
+		}
+		h.exchange(w, s, seq, body)
+	default:
+		// includes /fcs/ident2, which clients probe before /open
+		http.NotFound(w, r)
+	}
+}
+
+func (h *Handler) open(w http.ResponseWriter, r *http.Request) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		http.Error(w, "failed to create session", http.StatusInternalServerError)
+		return
+	}
+	id := hex.EncodeToString(b)
+
+	s := &session{id: id}
+	// a session the server closed lives until the client reads its last
+	// bytes or the timer expires it
+	s.conn = newConn(addr(r.Host), addr(r.RemoteAddr), nil)
+	s.timer = time.AfterFunc(h.sessionTimeout, func() {
+		s.Close()
+		h.remove(id)
+	})
+
+	h.mu.Lock()
+	h.sessions[id] = s
+	h.mu.Unlock()
+
+	select {
+	case h.acceptc <- s.conn:
+	case <-h.done:
+		s.Close()
+		h.remove(id)
+		http.Error(w, "closed", http.StatusServiceUnavailable)
+		return
+	case <-r.Context().Done():
+		s.Close()
+		h.remove(id)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	io.WriteString(w, id+"\n")
+}
+
+func (h *Handler) exchange(w http.ResponseWriter, s *session, seq uint64, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if seq <= s.lastSeq {
+		http.Error(w, "sequence number is not increasing", http.StatusBadRequest)
+		return
+	}
+	s.lastSeq = seq
+	s.timer.Reset(h.sessionTimeout)
+
+	if len(body) > 0 {
+		// blocks while the server is behind; the session timer ends the
+		// wait if it never catches up
+		if _, err := s.in.Write(body); err != nil {
+			h.remove(s.id)
+			http.Error(w, "session closed", http.StatusNotFound)
+			return
+		}
+	}
+
+	data, closed := s.out.DrainClosed()
+	if len(data) > 0 || len(body) > 0 {
+		s.idle = 0
+	} else if s.idle < len(idleIntervals)-1 {
+		s.idle++
+	}
+	if closed {
+		// the server closed the session; this is its last response
+		h.remove(s.id)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(append([]byte{idleIntervals[s.idle]}, data...))
+}
+
+func (h *Handler) close(w http.ResponseWriter, s *session) {
+	s.Close()
+	h.remove(s.id)
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte{0x00})
+}
+
+func (h *Handler) session(id string) (*session, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.sessions[id]
+	return s, ok
+}
+
+func (h *Handler) remove(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.sessions, id)
+}
+
+// Accept waits for the next session.
+func (h *Handler) Accept() (net.Conn, error) {
+	select {
+	case c := <-h.acceptc:
+		return c, nil
+	case <-h.done:
+		return nil, errHandlerClosed
+	}
+}
+
+// Close stops accepting sessions and closes the open ones.
+func (h *Handler) Close() error {
+	h.closeOnce.Do(func() {
+		close(h.done)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for id, s := range h.sessions {
+			s.Close()
+			delete(h.sessions, id)
+		}
+	})
+	return nil
+}
+
+func (h *Handler) Addr() net.Addr {
+	return addr("rtmpt")
+}
@@ -0,0 +1,162 @@
+package rtmpt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	h := NewHandler()
+	defer h.Close()
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	go func() {
+		for {
+			nc, err := h.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer nc.Close()
+				io.Copy(nc, nc)
+			}()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nc, err := Dial(ctx, ts.URL, ts.Client())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	payload := bytes.Repeat([]byte("rtmpt"), 1000)
+	_, err = nc.Write(payload)
+	assert.NoError(t, err)
+	got := make([]byte, len(payload))
+	assert.NoError(t, nc.SetReadDeadline(time.Now().Add(3*time.Second)))
+	_, err = io.ReadFull(nc, got)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, got)
+
+	assert.NoError(t, nc.Close())
+	id := nc.(*clientConn).id
+	_, ok := h.session(id)
+	assert.False(t, ok)
+
+	resp, err := ts.Client().Post(ts.URL+"/idle/"+id+"/100", contentType, bytes.NewReader([]byte{0x00}))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	}
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	h := NewHandler()
+	defer h.Close()
+	go func() {
+		for {
+			if _, err := h.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+
+	post := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader([]byte{0x00})))
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, post("/fcs/ident2").Code)
+	assert.Equal(t, http.StatusNotFound, post("/idle/unknown/1").Code)
+
+	w := post("/open/1")
+	if !assert.Equal(t, http.StatusOK, w.Code) {
+		return
+	}
+	id := string(bytes.TrimSpace(w.Body.Bytes()))
+
+	w = post("/idle/" + id + "/1")
+	assert.Equal(t, []byte{0x03}, w.Body.Bytes())
+	w = post("/idle/" + id + "/2")
+	assert.Equal(t, []byte{0x05}, w.Body.Bytes())
+	assert.Equal(t, http.StatusBadRequest, post("/idle/"+id+"/2").Code)
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/idle/"+id+"/3", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	assert.Equal(t, []byte{0x00}, post("/close/"+id+"/3").Body.Bytes())
+	assert.Equal(t, http.StatusNotFound, post("/idle/"+id+"/4").Code)
+}
+
+func TestHandler_SessionTimeout(t *testing.T) {
+	h := NewHandler(WithSessionTimeout(50 * time.Millisecond))
+	defer h.Close()
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	accepted := make(chan error, 1)
+	go func() {
+		nc, err := h.Accept()
+		if err != nil {
+			accepted <- err
+			return
+		}
+		_, err = nc.Read(make([]byte, 1))
+		accepted <- err
+	}()
+
+	resp, err := ts.Client().Post(ts.URL+"/open/1", contentType, bytes.NewReader([]byte{0x00}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+
+	select {
+	case err := <-accepted:
+		assert.Equal(t, io.EOF, err)
+	case <-time.After(3 * time.Second):
+		t.Fatal("session did not time out")
+	}
+}
+
+func TestHandler_ServerCloseWithoutPoll(t *testing.T) {
+	h := NewHandler(WithSessionTimeout(50 * time.Millisecond))
+	defer h.Close()
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	go func() {
+		if nc, err := h.Accept(); err == nil {
+			nc.Close()
+		}
+	}()
+	resp, err := ts.Client().Post(ts.URL+"/open/1", contentType, bytes.NewReader([]byte{0x00}))
+	if !assert.NoError(t, err) {
+		return
+	}
+	resp.Body.Close()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		h.mu.Lock()
+		n := len(h.sessions)
+		h.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("closed session was not removed")
+}
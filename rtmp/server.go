@@ -2,14 +2,19 @@ package rtmp
 
 import (
 	"context"
+	"crypto/tls"
 	"io"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
+// ErrServerClosed is returned by Serve after Shutdown.
+var ErrServerClosed = errors.New("rtmp: Server closed")
+
 type Server struct {
 	ctx         context.Context
 	cancelFunc  context.CancelFunc
@@ -17,6 +22,51 @@ type Server struct {
 
 	Addr string
 
+	// TLSConfig is used by ServeTLS and ListenAndServeTLS.
+	TLSConfig *tls.Config
+	// Certificates selects the certificate by SNI when TLSConfig has no
+	// GetCertificate. Call Certificates.Reload to pick up renewed files.
+	Certificates *CertificateStore
+
+	// PublisherGracePeriod is how long Shutdown lets publishers go on
+	// before closing them, so they can end at a keyframe.
+	PublisherGracePeriod time.Duration
+	// NotifyTimeout bounds the status messages Shutdown and Kick send before
+	// closing a connection, 5s by default, so a peer that stopped reading
+	// cannot hold them up.
+	NotifyTimeout time.Duration
+
+	// MaxConns and MaxConnsPerIP limit concurrent connections. 0 means no
+	// limit.
+	MaxConns      int
+	MaxConnsPerIP int
+	// A connection over MaxConns or MaxConnsPerIP is kept for at most
+	// RejectTimeout, 5s by default, to be answered
+	// NetConnection.Connect.Rejected. Up to MaxPendingRejections, 64 by
+	// default, are kept at once; more are closed right after accept.
+	RejectTimeout        time.Duration
+	MaxPendingRejections int
+	// AcceptRate limits accepted connections per second, allowing bursts
+	// of AcceptBurst. 0 means no limit.
+	AcceptRate  float64
+	AcceptBurst int
+	// MaxPublishersPerApp and MaxPlayersPerApp limit publishing and playing
+	// streams per app. 0 means no limit.
+	MaxPublishersPerApp int
+	MaxPlayersPerApp    int
+
+	// Metrics receives the measurements of the server and, overriding
+	// WithMetrics, of its connections.
+	Metrics Metrics
+
+	registry  connRegistry
+	admission admission
+
+	mu         sync.Mutex
+	listeners  map[*onceCloseListener]struct{}
+	onShutdown []func()
+	inShutdown int32
+
 	logger *zap.Logger
 }
 
@@ -51,8 +101,54 @@ func (s *Server) ListenAndServe() error {
 	return s.Serve(l)
 }
 
+// ListenAndServeTLS listens on Addr, ":443" by default, and serves rtmps.
+// certFile and keyFile may be empty when TLSConfig or Certificates already
+// provide certificates.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":443"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeTLS(l, certFile, keyFile)
+}
+
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+	store := s.certificateStore(certFile != "" || keyFile != "")
+	if certFile != "" || keyFile != "" {
+		if err := store.Add(certFile, keyFile); err != nil {
+			l.Close()
+			return err
+		}
+	}
+	if store != nil && config.GetCertificate == nil {
+		config.GetCertificate = store.GetCertificate
+	}
+	return s.Serve(tls.NewListener(l, config))
+}
+
+// certificateStore returns s.Certificates, creating it when create is true
+// and it is nil, so that concurrent ServeTLS calls share one store.
+func (s *Server) certificateStore(create bool) *CertificateStore {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Certificates == nil && create {
+		s.Certificates = NewCertificateStore()
+	}
+	return s.Certificates
+}
+
 func (s *Server) Serve(l net.Listener) error {
 	ctx := s.ctx
+	ol := &onceCloseListener{Listener: l}
+	l = ol
 	defer func() {
 		if err := l.Close(); err != nil {
 			s.logger.Error(
@@ -62,11 +158,23 @@ func (s *Server) Serve(l net.Listener) error {
 			)
 		}
 	}()
+	if !s.trackListener(ol, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(ol, false)
+
+	connOps := append(s.streamLimitOptions(), s.connOptions...)
+	if s.Metrics != nil {
+		connOps = append(connOps, WithMetrics(s.Metrics))
+	}
 
 	var tempDelay time.Duration // how long to sleep on accept failure
 	for !isDone(ctx) {
 		nc, err := l.Accept()
 		if err != nil {
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
 			if isCanceledErr(err) || isDone(ctx) {
 				return nil
 			}
@@ -93,16 +201,53 @@ func (s *Server) Serve(l net.Listener) error {
 		}
 		tempDelay = 0
 
+		if !s.allowAccept() {
+			s.logger.Debug("accept rate limited", zap.Stringer("remoteAddr", nc.RemoteAddr()))
+			nc.Close()
+			continue
+		}
+		ops := connOps
+		release, rejection := s.acquireConn(remoteIP(nc.RemoteAddr()))
+		rejecting := rejection != ""
+		if rejecting {
+			s.logger.Info(
+				"too many connections",
+				zap.String("rejection", rejection),
+				zap.Bool("pendingRejectionsFull", release == nil),
+				zap.Stringer("remoteAddr", nc.RemoteAddr()),
+			)
+			if release == nil {
+				nc.Close()
+				continue
+			}
+			// answered right after the handshake, before other validators
+			ops = append([]ConnOption{rejectConnectOption(rejection)}, connOps...)
+		}
+
 		c := NewDefaultConn(
 			ctx,
 			nc,
 			true,
 			s.logger,
-			s.connOptions...,
+			ops...,
 		)
+		if rejecting {
+			// closed even if the peer never sends connect
+			timer := time.AfterFunc(s.rejectTimeout(), func() { nc.Close() })
+			releaseRejection := release
+			release = func() {
+				timer.Stop()
+				releaseRejection()
+			}
+		}
+		sc := s.registry.add(c)
+		s.metrics().ConnOpened()
 
 		go func() {
 			remoteAddr := nc.RemoteAddr()
+			defer s.metrics().ConnClosed()
+			defer release()
+			defer s.registry.remove(sc.id)
 			defer func() {
 				if err := recover(); err != nil {
 					s.logger.Error(
@@ -134,6 +279,14 @@ func (s *Server) Serve(l net.Listener) error {
 					isDone(ctx) {
 					return
 				}
+				if rejecting {
+					s.logger.Debug(
+						"rejected conn ended",
+						zap.Error(err),
+						zap.Stringer("remoteAddr", remoteAddr),
+					)
+					return
+				}
 				if e, ok := errors.Cause(err).(ConnError); ok {
 					s.logger.Error(
 						"failed to conn.serve",
@@ -152,8 +305,21 @@ func (s *Server) Serve(l net.Listener) error {
 	return ctx.Err()
 }
 
+func (s *Server) metrics() Metrics {
+	if s.Metrics == nil {
+		return NopMetrics{}
+	}
+	return s.Metrics
+}
+
 func ListenAndServe(ctx context.Context, addr string, logger *zap.Logger, connOps ...ConnOption) error {
 	s := NewServer(ctx, logger, connOps...)
 	s.Addr = addr
 	return s.ListenAndServe()
 }
+
+func ListenAndServeTLS(ctx context.Context, addr string, certFile, keyFile string, logger *zap.Logger, connOps ...ConnOption) error {
+	s := NewServer(ctx, logger, connOps...)
+	s.Addr = addr
+	return s.ListenAndServeTLS(certFile, keyFile)
+}
@@ -0,0 +1,298 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AdmissionStats counts the connections and streams rejected by the limits
+// of a Server.
+type AdmissionStats struct {
+	// RateLimited connections are closed before the handshake.
+	RateLimited uint64
+	// MaxConns and MaxConnsPerIP rejections are answered with
+	// NetConnection.Connect.Rejected, or closed right after accept when
+	// MaxPendingRejections are pending.
+	MaxConns      uint64
+	MaxConnsPerIP uint64
+	// MaxPublishers and MaxPlayers rejections are answered with
+	// NetStream.Publish.Failed and NetStream.Play.Failed.
+	MaxPublishers uint64
+	MaxPlayers    uint64
+}
+
+func (s *Server) AdmissionStats() AdmissionStats {
+	a := &s.admission
+	return AdmissionStats{
+		RateLimited:   atomic.LoadUint64(&a.stats.RateLimited),
+		MaxConns:      atomic.LoadUint64(&a.stats.MaxConns),
+		MaxConnsPerIP: atomic.LoadUint64(&a.stats.MaxConnsPerIP),
+		MaxPublishers: atomic.LoadUint64(&a.stats.MaxPublishers),
+		MaxPlayers:    atomic.LoadUint64(&a.stats.MaxPlayers),
+	}
+}
+
+type admission struct {
+	mu     sync.Mutex
+	conns  int
+	perIP  map[string]int
+	bucket *tokenBucket
+	// rejecting counts the connections over a limit waiting for their
+	// rejection.
+	rejecting int
+	// streams counts the publishing and playing streams per app.
+	streams map[string]*appStreams
+
+	stats AdmissionStats
+}
+
+// allowAccept takes a token for a new connection.
+func (s *Server) allowAccept() bool {
+	if s.AcceptRate <= 0 {
+		return true
+	}
+	a := &s.admission
+	a.mu.Lock()
+	if a.bucket == nil {
+		a.bucket = newTokenBucket(s.AcceptRate, s.AcceptBurst)
+	}
+	ok := a.bucket.take(time.Now())
+	a.mu.Unlock()
+	if !ok {
+		atomic.AddUint64(&a.stats.RateLimited, 1)
+		s.metrics().Rejected("RateLimited")
+	}
+	return ok
+}
+
+const (
+	defaultRejectTimeout        = 5 * time.Second
+	defaultMaxPendingRejections = 64
+)
+
+// acquireConn takes a connection slot for ip. It returns a function
+// releasing the slot and an empty string or, over a limit, a function
+// releasing a pending rejection slot and the description of the limit hit.
+// The function is nil when too many rejections are pending as well.
+func (s *Server) acquireConn(ip string) (func(), string) {
+	a := &s.admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	rejection, reason := "", ""
+	switch {
+	case s.MaxConns > 0 && a.conns >= s.MaxConns:
+		atomic.AddUint64(&a.stats.MaxConns, 1)
+		rejection, reason = "too many connections", "MaxConns"
+	case s.MaxConnsPerIP > 0 && a.perIP[ip] >= s.MaxConnsPerIP:
+		atomic.AddUint64(&a.stats.MaxConnsPerIP, 1)
+		rejection, reason = "too many connections from the address", "MaxConnsPerIP"
+	}
+	if rejection != "" {
+		s.metrics().Rejected(reason)
+		return s.acquireRejection(), rejection
+	}
+	if a.perIP == nil {
+		a.perIP = map[string]int{}
+	}
+	a.conns++
+	a.perIP[ip]++
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.conns--
+		if a.perIP[ip]--; a.perIP[ip] <= 0 {
+			delete(a.perIP, ip)
+		}
+	}, ""
+}
+
+// acquireRejection takes a pending rejection slot. a.mu must be held.
+func (s *Server) acquireRejection() func() {
+	a := &s.admission
+	max := s.MaxPendingRejections
+	if max <= 0 {
+		max = defaultMaxPendingRejections
+	}
+	if a.rejecting >= max {
+		return nil
+	}
+	a.rejecting++
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.rejecting--
+	}
+}
+
+func (s *Server) rejectTimeout() time.Duration {
+	if s.RejectTimeout <= 0 {
+		return defaultRejectTimeout
+	}
+	return s.RejectTimeout
+}
+
+// rejectConnectOption rejects the connect of a connection over a limit
+// before any other validator runs.
+func rejectConnectOption(description string) ConnOption {
+	return WithOnConnectValidators(func(ctx context.Context, connect Connect) ConnectError {
+		return NewConnectError(nil, NewStatus(StatusCodeNetConnectionConnectRejected).
+			WithDescription(description).
+			InfoObject(), EncodingAMFTypeAMF0)
+	})
+}
+
+type appStreams struct {
+	publishers int
+	players    int
+}
+
+// streamLimitOptions enforces the per app caps. A validator rejects
+// requests over a cap before the others run, and the count is taken when
+// the stream starts, so that concurrent requests cannot pass together.
+func (s *Server) streamLimitOptions() []ConnOption {
+	if s.MaxPublishersPerApp <= 0 && s.MaxPlayersPerApp <= 0 {
+		return nil
+	}
+	return []ConnOption{
+		WithOnPublishValidators(func(ctx context.Context, publish Publish) map[string]interface{} {
+			conn, ok := ConnFromContext(ctx)
+			if !ok || !s.overStreamLimit(conn.ConnectParams().App, MessageStreamStatePublishing, false) {
+				return nil
+			}
+			return s.rejectStream(MessageStreamStatePublishing, publish.PublishingName())
+		}),
+		WithOnPlayValidators(func(ctx context.Context, play Play) map[string]interface{} {
+			conn, ok := ConnFromContext(ctx)
+			if !ok || !s.overStreamLimit(conn.ConnectParams().App, MessageStreamStatePlaying, false) {
+				return nil
+			}
+			return s.rejectStream(MessageStreamStatePlaying, play.StreamName())
+		}),
+		withStreamAdmission(s),
+	}
+}
+
+func (s *Server) admitStream(conn Conn, stream MessageStream) map[string]interface{} {
+	if !s.overStreamLimit(conn.ConnectParams().App, stream.State, true) {
+		return nil
+	}
+	return s.rejectStream(stream.State, stream.Name)
+}
+
+func (s *Server) releaseStream(conn Conn, stream MessageStream) {
+	app := conn.ConnectParams().App
+	a := &s.admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n, ok := a.streams[app]
+	if !ok {
+		return
+	}
+	switch stream.State {
+	case MessageStreamStatePublishing:
+		n.publishers--
+	case MessageStreamStatePlaying:
+		n.players--
+	}
+	if n.publishers <= 0 && n.players <= 0 {
+		delete(a.streams, app)
+	}
+}
+
+// overStreamLimit reports whether app already has as many streams in state
+// as its cap allows. Otherwise, with count, the stream is counted.
+func (s *Server) overStreamLimit(app string, state MessageStreamState, count bool) bool {
+	a := &s.admission
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := a.streams[app]
+	if n == nil {
+		n = &appStreams{}
+	}
+	var current *int
+	var max int
+	switch state {
+	case MessageStreamStatePublishing:
+		current, max = &n.publishers, s.MaxPublishersPerApp
+	case MessageStreamStatePlaying:
+		current, max = &n.players, s.MaxPlayersPerApp
+	default:
+		return false
+	}
+	if max > 0 && *current >= max {
+		return true
+	}
+	if count {
+		*current++
+		if a.streams == nil {
+			a.streams = map[string]*appStreams{}
+		}
+		a.streams[app] = n
+	}
+	return false
+}
+
+// rejectStream counts a stream over its cap and returns its status.
+func (s *Server) rejectStream(state MessageStreamState, name string) map[string]interface{} {
+	if state == MessageStreamStatePublishing {
+		atomic.AddUint64(&s.admission.stats.MaxPublishers, 1)
+		s.metrics().Rejected("MaxPublishers")
+		return NewStatus(StatusCodeNetStreamPublishFailed).
+			WithDescription("too many publishers").
+			WithDetails(name).
+			InfoObject()
+	}
+	atomic.AddUint64(&s.admission.stats.MaxPlayers, 1)
+	s.metrics().Rejected("MaxPlayers")
+	return NewStatus(StatusCodeNetStreamPlayFailed).
+		WithDescription("too many players").
+		WithDetails(name).
+		InfoObject()
+}
+
+func remoteIP(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+func (b *tokenBucket) take(now time.Time) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,219 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(2, 2)
+	assert.True(t, b.take(now))
+	assert.True(t, b.take(now))
+	assert.False(t, b.take(now))
+	assert.False(t, b.take(now.Add(400*time.Millisecond)))
+	assert.True(t, b.take(now.Add(500*time.Millisecond)))
+	assert.True(t, b.take(now.Add(10*time.Second)))
+	assert.True(t, b.take(now.Add(10*time.Second)))
+	assert.False(t, b.take(now.Add(10*time.Second)))
+}
+
+func TestServerAdmission(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	s.MaxConns = 2
+	s.MaxPublishersPerApp = 1
+	go s.Serve(l)
+
+	statuses := make(chan Status, 4)
+	client := NewClient(ctx, zap.NewNop(),
+		WithConnInitializers(GenerateCommonConnInitializer()),
+		WithStatusHandlers(func(ctx context.Context, messageStreamID uint32, status Status) ConnError {
+			statuses <- status
+			return nil
+		}),
+	)
+	defer client.Close()
+	url := "rtmp://" + l.Addr().String() + "/live"
+
+	var conns []Conn
+	for i := 0; i < 2; i++ {
+		conn, err := client.DialAndConnect(ctx, url, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		conns = append(conns, conn)
+	}
+	_, err = client.DialAndConnect(ctx, url, nil)
+	if e, ok := err.(*StatusError); assert.True(t, ok, "%v", err) {
+		assert.Equal(t, StatusCodeNetConnectionConnectRejected, e.Status.Code)
+		assert.Equal(t, "too many connections", e.Status.Description)
+	}
+
+	for i, conn := range conns {
+		assert.NoError(t, conn.CreateStream(ctx, conn.TransactionID(), nil))
+		assert.NoError(t, conn.Publish(ctx, ChunkStreamIDFor(MessageTypeIDCommandAMF0, 1), 1, "room"+string(rune('a'+i)), PublishingTypeLive))
+		status := <-statuses
+		if i == 0 {
+			assert.Equal(t, StatusCodeNetStreamPublishStart, status.Code)
+			continue
+		}
+		assert.Equal(t, StatusCodeNetStreamPublishFailed, status.Code)
+		assert.Equal(t, "too many publishers", status.Description)
+	}
+	assert.Equal(t, AdmissionStats{MaxConns: 1, MaxPublishers: 1}, s.AdmissionStats())
+}
+
+func TestServerAcceptRate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	s.AcceptRate = 0.001
+	s.MaxConnsPerIP = 1
+	go s.Serve(l)
+
+	client := NewClient(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	defer client.Close()
+	url := "rtmp://" + l.Addr().String() + "/live"
+
+	conn, err := client.DialAndConnect(ctx, url, nil)
+	if assert.NoError(t, err) {
+		defer conn.Close()
+	}
+	_, err = client.DialAndConnect(ctx, url, nil)
+	assert.Error(t, err)
+	assert.Equal(t, AdmissionStats{RateLimited: 1}, s.AdmissionStats())
+}
+
+func TestServerAdmissionIdleSockets(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	s.MaxConns = 1
+	s.MaxPendingRejections = 2
+	s.RejectTimeout = 200 * time.Millisecond
+	go s.Serve(l)
+
+	client := NewClient(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	defer client.Close()
+	conn, err := client.DialAndConnect(ctx, "rtmp://"+l.Addr().String()+"/live", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	// none of these ever sends connect
+	closed := make(chan time.Duration, 5)
+	for i := 0; i < 5; i++ {
+		nc, err := net.Dial("tcp", l.Addr().String())
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer nc.Close()
+		start := time.Now()
+		go func() {
+			nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, err := nc.Read(make([]byte, 1))
+			assert.Error(t, err)
+			closed <- time.Since(start)
+		}()
+	}
+	var immediately, timedOut int
+	for i := 0; i < 5; i++ {
+		if d := <-closed; d < 150*time.Millisecond {
+			immediately++
+		} else if d < time.Second {
+			timedOut++
+		}
+	}
+	assert.Equal(t, 3, immediately)
+	assert.Equal(t, 2, timedOut)
+	assert.Equal(t, uint64(5), s.AdmissionStats().MaxConns)
+	for len(s.Conns()) > 1 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(t, s.Conns(), 1)
+}
+
+func TestServerStreamLimit(t *testing.T) {
+	s := NewServer(context.Background(), zap.NewNop())
+	s.MaxPublishersPerApp = 1
+	s.MaxPlayersPerApp = 2
+	conn := &streamMuxTestConn{app: "live"}
+	tables := make([]*messageStreamTable, 8)
+	for i := range tables {
+		tables[i] = newMessageStreamTable(0)
+		var o connOptions
+		for _, op := range s.streamLimitOptions() {
+			op(&o)
+		}
+		tables[i].admit = func(stream MessageStream) map[string]interface{} {
+			return o.streamAdmission.admitStream(conn, stream)
+		}
+		tables[i].release = func(stream MessageStream) {
+			o.streamAdmission.releaseStream(conn, stream)
+		}
+		_, _ = tables[i].Create()
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(tables))
+	for i := range tables {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = tables[i].SetPublishing(1, "room", PublishingTypeLive)
+		}(i)
+	}
+	wg.Wait()
+	publisher := -1
+	for i, err := range errs {
+		if err == nil {
+			assert.Equal(t, -1, publisher, "two publishers admitted")
+			publisher = i
+			continue
+		}
+		if e, ok := err.(*streamAdmissionError); assert.True(t, ok, "%v", err) {
+			assert.Equal(t, "too many publishers", e.errorInfo["description"])
+		}
+		stream, _ := tables[i].Get(1)
+		assert.Equal(t, MessageStreamStateIdle, stream.State)
+	}
+	if !assert.NotEqual(t, -1, publisher) {
+		return
+	}
+	other := (publisher + 1) % len(tables)
+
+	// the publisher turning into a player frees the publisher slot
+	assert.NoError(t, tables[publisher].SetPlaying(1, "room"))
+	assert.NoError(t, tables[other].SetPublishing(1, "room", PublishingTypeLive))
+	assert.NoError(t, tables[(publisher+2)%len(tables)].SetPlaying(1, "room"))
+	assert.Error(t, tables[(publisher+3)%len(tables)].SetPlaying(1, "room"))
+
+	tables[publisher].Delete(1)
+	tables[other].DeleteAll()
+	assert.NoError(t, tables[(publisher+3)%len(tables)].SetPublishing(1, "room", PublishingTypeLive))
+	assert.Equal(t, AdmissionStats{MaxPublishers: uint64(len(tables) - 1), MaxPlayers: 1}, s.AdmissionStats())
+}
@@ -0,0 +1,212 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type ConnRole string
+
+const (
+	ConnRoleNone      ConnRole = ""
+	ConnRolePublisher ConnRole = "publisher"
+	ConnRolePlayer    ConnRole = "player"
+)
+
+// ConnInfo is a snapshot of a connection served by a Server.
+type ConnInfo struct {
+	ID         uint64
+	RemoteAddr net.Addr
+	// App is empty until connect.
+	App     string
+	Streams []MessageStream
+	// Role is ConnRolePublisher if any stream is publishing, else
+	// ConnRolePlayer if any stream is playing.
+	Role         ConnRole
+	StartedAt    time.Time
+	BytesRead    uint64
+	BytesWritten uint64
+}
+
+type serverConn struct {
+	id        uint64
+	conn      Conn
+	startedAt time.Time
+	draining  int32
+}
+
+// startDraining reports false if c is already draining.
+func (c *serverConn) startDraining() bool {
+	return atomic.CompareAndSwapInt32(&c.draining, 0, 1)
+}
+
+func (c *serverConn) info() ConnInfo {
+	streams := c.conn.MessageStreams()
+	role := ConnRoleNone
+	for _, stream := range streams {
+		switch stream.State {
+		case MessageStreamStatePublishing:
+			role = ConnRolePublisher
+		case MessageStreamStatePlaying:
+			if role == ConnRoleNone {
+				role = ConnRolePlayer
+			}
+		}
+	}
+	stats := c.conn.Stats()
+	return ConnInfo{
+		ID:           c.id,
+		RemoteAddr:   c.conn.RemoteAddr(),
+		App:          c.conn.ConnectParams().App,
+		Streams:      streams,
+		Role:         role,
+		StartedAt:    c.startedAt,
+		BytesRead:    stats.BytesRead,
+		BytesWritten: stats.BytesWritten,
+	}
+}
+
+type connRegistry struct {
+	mu     sync.Mutex
+	conns  map[uint64]*serverConn
+	lastID uint64
+}
+
+func (r *connRegistry) add(conn Conn) *serverConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conns == nil {
+		r.conns = map[uint64]*serverConn{}
+	}
+	r.lastID++
+	c := &serverConn{
+		id:        r.lastID,
+		conn:      conn,
+		startedAt: time.Now(),
+	}
+	r.conns[c.id] = c
+	return c
+}
+
+func (r *connRegistry) remove(id uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.conns, id)
+}
+
+func (r *connRegistry) get(id uint64) (*serverConn, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.conns[id]
+	return c, ok
+}
+
+// list returns the connections ordered by ID.
+func (r *connRegistry) list() []*serverConn {
+	r.mu.Lock()
+	conns := make([]*serverConn, 0, len(r.conns))
+	for _, c := range r.conns {
+		conns = append(conns, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].id < conns[j].id
+	})
+	return conns
+}
+
+// Conns returns the connections being served, ordered by ID.
+func (s *Server) Conns() []ConnInfo {
+	conns := s.registry.list()
+	infos := make([]ConnInfo, 0, len(conns))
+	for _, c := range conns {
+		infos = append(infos, c.info())
+	}
+	return infos
+}
+
+func (s *Server) ConnInfo(id uint64) (ConnInfo, bool) {
+	c, ok := s.registry.get(id)
+	if !ok {
+		return ConnInfo{}, false
+	}
+	return c.info(), true
+}
+
+// ConnsByStream returns the connections publishing or playing path, the
+// StreamPath of the app and the stream name.
+func (s *Server) ConnsByStream(path string) []ConnInfo {
+	var infos []ConnInfo
+	for _, c := range s.registry.list() {
+		info := c.info()
+		for _, stream := range info.Streams {
+			if stream.State != MessageStreamStateIdle && StreamPath(info.App, stream.Name) == path {
+				infos = append(infos, info)
+				break
+			}
+		}
+	}
+	return infos
+}
+
+// Kick sends NetConnection.Connect.Closed with reason as its description,
+// waiting at most NotifyTimeout, and closes the connection. A connection
+// still handshaking cannot be kicked yet.
+func (s *Server) Kick(id uint64, reason string) error {
+	c, ok := s.registry.get(id)
+	if !ok {
+		return errors.Errorf("conn not found: id=%d", id)
+	}
+	if dc, ok := c.conn.(*defaultConn); ok && !isDone(dc.handshaked) {
+		return errors.Errorf("conn is handshaking: id=%d", id)
+	}
+	s.logger.Info(
+		"kick conn",
+		zap.Uint64("id", id),
+		zap.String("reason", reason),
+		zap.Stringer("remoteAddr", c.conn.RemoteAddr()),
+	)
+	err := s.notify(c.conn, func() error {
+		return c.conn.OnStatus(
+			s.ctx,
+			ChunkStreamIDFor(MessageTypeIDCommandAMF0, 0),
+			0,
+			NewStatus(StatusCodeNetConnectionConnectClosed).
+				WithDescription(reason).
+				InfoObject(),
+		)
+	})
+	if cerr := c.conn.Close(); err == nil && cerr != nil {
+		err = cerr
+	}
+	return errors.Wrap(err, "failed to kick conn")
+}
+
+// Call sends procedureName to every connection of app and returns the
+// number of connections it was sent to. No response is expected.
+func (s *Server) Call(ctx context.Context, app string, procedureName string, args map[string]interface{}) int {
+	n := 0
+	for _, c := range s.registry.list() {
+		if c.conn.ConnectParams().App != app {
+			continue
+		}
+		if err := c.conn.Call(ctx, procedureName, 0, nil, args); err != nil {
+			s.logger.Warn(
+				"failed to call",
+				zap.Uint64("id", c.id),
+				zap.String("procedureName", procedureName),
+				zap.Error(err),
+			)
+			continue
+		}
+		n++
+	}
+	return n
+}
@@ -0,0 +1,155 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestServerRegistry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	go s.Serve(l)
+
+	calls := make(chan string, 1)
+	statuses := make(chan Status, 1)
+	client := NewClient(ctx, zap.NewNop(),
+		WithConnInitializers(func(c Conn) {
+			h := NewControlMessageHandler(c)
+			h.NetConnectionCommandHandler.CallHandlers = append(h.NetConnectionCommandHandler.CallHandlers,
+				CallHandlerFunc(func(ctx context.Context, call Call) ConnError {
+					calls <- call.ProcedureName()
+					return nil
+				}),
+			)
+			c.AddMessageHandler("ControlMessageHandler", h)
+		}),
+		WithStatusHandlers(func(ctx context.Context, messageStreamID uint32, status Status) ConnError {
+			if messageStreamID == 0 {
+				statuses <- status
+			}
+			return nil
+		}),
+	)
+	defer client.Close()
+
+	conn, err := client.DialAndConnect(ctx, "rtmp://"+l.Addr().String()+"/live", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, conn.CreateStream(ctx, conn.TransactionID(), nil))
+	assert.NoError(t, conn.Publish(ctx, ChunkStreamIDFor(MessageTypeIDCommandAMF0, 1), 1, "room", PublishingTypeLive))
+
+	var infos []ConnInfo
+	for len(infos) == 0 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+		infos = s.ConnsByStream("live/room")
+	}
+	if !assert.Len(t, infos, 1) {
+		return
+	}
+	info := infos[0]
+	assert.Equal(t, "live", info.App)
+	assert.Equal(t, ConnRolePublisher, info.Role)
+	assert.NotZero(t, info.BytesRead)
+	assert.NotZero(t, info.BytesWritten)
+	assert.Equal(t, info.ID, s.Conns()[0].ID)
+	assert.Empty(t, s.ConnsByStream("live/other"))
+
+	assert.Equal(t, 0, s.Call(ctx, "other", "notify", nil))
+	assert.Equal(t, 1, s.Call(ctx, "live", "notify", map[string]interface{}{"message": "hello"}))
+	assert.Equal(t, "notify", <-calls)
+
+	assert.Error(t, s.Kick(info.ID+1, "bye"))
+	assert.NoError(t, s.Kick(info.ID, "bye"))
+	status := <-statuses
+	assert.Equal(t, StatusCodeNetConnectionConnectClosed, status.Code)
+	assert.Equal(t, "bye", status.Description)
+	<-conn.Context().Done()
+	for ctx.Err() == nil {
+		if _, ok := s.ConnInfo(info.ID); !ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Empty(t, s.Conns())
+}
+
+func TestServerKickHandshaking(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	defer s.Close()
+	go s.Serve(l)
+
+	nc, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	var infos []ConnInfo
+	for len(infos) == 0 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+		infos = s.Conns()
+	}
+	if !assert.Len(t, infos, 1) {
+		return
+	}
+	assert.Error(t, s.Kick(infos[0].ID, "bye"))
+	_, ok := s.ConnInfo(infos[0].ID)
+	assert.True(t, ok)
+}
+
+func TestDefaultConnCloseTwice(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewDefaultConn(context.Background(), s, true, zap.NewNop())
+	assert.NoError(t, conn.Close())
+	assert.NoError(t, conn.Close())
+	assert.Error(t, conn.Context().Err())
+}
+
+func TestServerKickStalledPeer(t *testing.T) {
+	s := NewServer(context.Background(), zap.NewNop())
+	defer s.Close()
+	s.NotifyTimeout = 50 * time.Millisecond
+
+	nc, peer := net.Pipe()
+	defer peer.Close()
+	conn := NewDefaultConn(context.Background(), nc, true, zap.NewNop()).(*defaultConn)
+	conn.handshakeDone()
+	sc := s.registry.add(conn)
+
+	// the peer never reads, so the status cannot be written
+	start := time.Now()
+	assert.Error(t, s.Kick(sc.id, "bye"))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Error(t, conn.Context().Err())
+}
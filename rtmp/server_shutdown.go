@@ -0,0 +1,204 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const defaultNotifyTimeout = 5 * time.Second
+
+// Shutdown stops the server gracefully like net/http.Server.Shutdown. It
+// closes the listeners, tells players that their streams ended with
+// NetStream.Play.UnpublishNotify and StreamEOF, and closes everyone but
+// publishers at once. With a PublisherGracePeriod, publishers go on for
+// the period and are then closed at their next video keyframe, so
+// recordings end with a complete GOP. Stream done handlers run as each
+// connection closes, so recorders passed to WithOnStreamDoneHandlers are
+// finalized before Shutdown returns.
+//
+// Shutdown returns when all connections are closed, or closes the
+// connections left and returns ctx.Err() when ctx is done first.
+func (s *Server) Shutdown(ctx context.Context) error {
+	atomic.StoreInt32(&s.inShutdown, 1)
+
+	s.mu.Lock()
+	for l := range s.listeners {
+		if err := l.Close(); err != nil {
+			s.logger.Error(
+				"failed to close listener",
+				zap.Error(err),
+				zap.Stringer("addr", l.Addr()),
+			)
+		}
+	}
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	s.mu.Unlock()
+
+	// conns accepted while closing the listeners show up later, so drain
+	// on every tick
+	pollInterval := time.Millisecond
+	t := time.NewTimer(pollInterval)
+	defer t.Stop()
+	for {
+		if s.drainConns(ctx) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.closeConns()
+			return ctx.Err()
+		case <-t.C:
+			if pollInterval *= 2; pollInterval > 100*time.Millisecond {
+				pollInterval = 100 * time.Millisecond
+			}
+			t.Reset(pollInterval)
+		}
+	}
+}
+
+// RegisterOnShutdown registers a function to call, in its own goroutine,
+// on Shutdown.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+func (s *Server) shuttingDown() bool {
+	return atomic.LoadInt32(&s.inShutdown) != 0
+}
+
+// drainConns starts draining the conns not draining yet and returns the
+// number of conns left.
+func (s *Server) drainConns(shutdownCtx context.Context) int {
+	conns := s.registry.list()
+	for _, c := range conns {
+		if c.startDraining() {
+			go s.drain(shutdownCtx, c)
+		}
+	}
+	return len(conns)
+}
+
+// closeConns closes every registered conn, like net/http.Server.Shutdown
+// does with the connections left when its ctx is done. Drains stuck writing
+// to a peer return with the write error.
+func (s *Server) closeConns() {
+	for _, c := range s.registry.list() {
+		c.conn.Close()
+	}
+}
+
+// drain closes c, waiting for the grace period and the next keyframe of a
+// publisher unless shutdownCtx is done first.
+func (s *Server) drain(shutdownCtx context.Context, c *serverConn) {
+	ctx := c.conn.Context()
+	info := c.info()
+	s.notify(c.conn, func() error {
+		for _, stream := range info.Streams {
+			if stream.State != MessageStreamStatePlaying {
+				continue
+			}
+			if err := c.conn.OnStatus(
+				shutdownCtx,
+				ChunkStreamIDFor(MessageTypeIDCommandAMF0, stream.ID),
+				stream.ID,
+				NewStatus(StatusCodeNetStreamPlayUnpublishNotify).
+					WithDetails(stream.Name).
+					InfoObject(),
+			); err != nil {
+				return err
+			}
+			if err := c.conn.StreamEOF(shutdownCtx, stream.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if info.Role == ConnRolePublisher && s.PublisherGracePeriod > 0 {
+		t := time.NewTimer(s.PublisherGracePeriod)
+		select {
+		case <-ctx.Done():
+		case <-shutdownCtx.Done():
+		case <-t.C:
+			if dc, ok := c.conn.(*defaultConn); ok {
+				dc.closeAtKeyframe()
+				select {
+				case <-ctx.Done():
+				case <-shutdownCtx.Done():
+				}
+			}
+		}
+		t.Stop()
+	}
+	if err := c.conn.Close(); err != nil && !isDone(ctx) {
+		s.logger.Warn(
+			"failed to close conn on shutdown",
+			zap.Uint64("id", c.id),
+			zap.Error(err),
+		)
+	}
+}
+
+// notify runs the writes of f with a write deadline of NotifyTimeout on
+// conn.
+func (s *Server) notify(conn Conn, f func() error) error {
+	nc := conn.NetConn()
+	if err := nc.SetWriteDeadline(time.Now().Add(s.notifyTimeout())); err != nil {
+		return errors.Wrap(err, "failed to set write deadline")
+	}
+	defer nc.SetWriteDeadline(time.Time{})
+	return f()
+}
+
+func (s *Server) notifyTimeout() time.Duration {
+	if s.NotifyTimeout <= 0 {
+		return defaultNotifyTimeout
+	}
+	return s.NotifyTimeout
+}
+
+// closeAtKeyframe ends Serve when the next video keyframe arrives, before
+// it is handled.
+func (conn *defaultConn) closeAtKeyframe() {
+	atomic.StoreInt32(&conn.closingAtKeyframe, 1)
+}
+
+func (s *Server) trackListener(l *onceCloseListener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !add {
+		delete(s.listeners, l)
+		return true
+	}
+	if s.shuttingDown() {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = map[*onceCloseListener]struct{}{}
+	}
+	s.listeners[l] = struct{}{}
+	return true
+}
+
+// onceCloseListener lets Serve and Shutdown both close the listener.
+type onceCloseListener struct {
+	net.Listener
+	once     sync.Once
+	closeErr error
+}
+
+func (l *onceCloseListener) Close() error {
+	l.once.Do(func() {
+		l.closeErr = l.Listener.Close()
+	})
+	return l.closeErr
+}
@@ -0,0 +1,163 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func sendPlay(ctx context.Context, conn Conn, messageStreamID uint32, name string) error {
+	b, err := NewPlay(name, 0, 0, false, EncodingAMFTypeAMF0).MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Writer().WriteMessage(NewMessage(
+		ChunkStreamIDFor(MessageTypeIDCommandAMF0, messageStreamID),
+		MessageTypeIDCommandAMF0,
+		0,
+		messageStreamID,
+		b,
+	)); err != nil {
+		return err
+	}
+	return conn.Writer().Flush()
+}
+
+func sendVideo(conn Conn, messageStreamID, timestamp uint32, payload []byte) error {
+	if _, err := conn.Writer().WriteMessage(NewMessage(
+		ChunkStreamIDFor(MessageTypeIDVideo, messageStreamID),
+		MessageTypeIDVideo,
+		timestamp,
+		messageStreamID,
+		payload,
+	)); err != nil {
+		return err
+	}
+	return conn.Writer().Flush()
+}
+
+func TestServerShutdown(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan MessageStream, 2)
+	s := NewServer(ctx, zap.NewNop(),
+		WithConnInitializers(GenerateCommonConnInitializer()),
+		WithOnStreamDoneHandlers(func(ctx context.Context, stream MessageStream) {
+			done <- stream
+		}),
+	)
+	s.PublisherGracePeriod = 100 * time.Millisecond
+	shutdownCalled := make(chan struct{}, 1)
+	s.RegisterOnShutdown(func() { shutdownCalled <- struct{}{} })
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	notified := make(chan Status, 1)
+	client := NewClient(ctx, zap.NewNop(),
+		WithConnInitializers(GenerateCommonConnInitializer()),
+		WithStatusHandlers(func(ctx context.Context, messageStreamID uint32, status Status) ConnError {
+			if status.Code == StatusCodeNetStreamPlayUnpublishNotify {
+				notified <- status
+			}
+			return nil
+		}),
+	)
+	defer client.Close()
+	url := "rtmp://" + l.Addr().String() + "/live"
+
+	publisher, err := client.DialAndConnect(ctx, url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, publisher.CreateStream(ctx, publisher.TransactionID(), nil))
+	assert.NoError(t, publisher.Publish(ctx, ChunkStreamIDFor(MessageTypeIDCommandAMF0, 1), 1, "room", PublishingTypeLive))
+	player, err := client.DialAndConnect(ctx, url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, player.CreateStream(ctx, player.TransactionID(), nil))
+	assert.NoError(t, sendPlay(ctx, player, 1, "room"))
+	for len(s.ConnsByStream("live/room")) < 2 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	start := time.Now()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(ctx) }()
+
+	// the publisher goes on past the grace period until its next keyframe
+	var keyframeSent time.Duration
+	for i := uint32(0); keyframeSent == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		select {
+		case err := <-shutdown:
+			t.Fatalf("Shutdown returned before the keyframe: %v", err)
+		default:
+		}
+		payload := []byte{0x27, 0x01, 0, 0, 0}
+		if time.Since(start) > 3*s.PublisherGracePeriod {
+			payload = []byte{0x17, 0x01, 0, 0, 0}
+			keyframeSent = time.Since(start)
+		}
+		assert.NoError(t, sendVideo(publisher, 1, i*20, payload))
+	}
+	assert.NoError(t, <-shutdown)
+	assert.True(t, time.Since(start) >= keyframeSent)
+	assert.Empty(t, s.Conns())
+	assert.Equal(t, ErrServerClosed, <-served)
+	<-shutdownCalled
+
+	status := <-notified
+	assert.Equal(t, "room", status.Details)
+	states := map[MessageStreamState]bool{}
+	for i := 0; i < 2; i++ {
+		states[(<-done).State] = true
+	}
+	assert.Equal(t, map[MessageStreamState]bool{
+		MessageStreamStatePublishing: true,
+		MessageStreamStatePlaying:    true,
+	}, states)
+
+	assert.Equal(t, ErrServerClosed, s.Serve(l))
+}
+
+func TestServerShutdownTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	s.PublisherGracePeriod = time.Minute
+	go s.Serve(l)
+
+	client := NewClient(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	defer client.Close()
+	publisher, err := client.DialAndConnect(ctx, "rtmp://"+l.Addr().String()+"/live", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, publisher.CreateStream(ctx, publisher.TransactionID(), nil))
+	assert.NoError(t, publisher.Publish(ctx, ChunkStreamIDFor(MessageTypeIDCommandAMF0, 1), 1, "room", PublishingTypeLive))
+	for len(s.ConnsByStream("live/room")) < 1 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shutdownCancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(shutdownCtx))
+	// conns left when ctx is done are closed
+	assert.Eventually(t, func() bool { return len(s.Conns()) == 0 }, time.Second, time.Millisecond)
+	s.Close()
+}
@@ -0,0 +1,113 @@
+package rtmp
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// StreamStats returns the stats of the streams being published, ordered by
+// app and name.
+func (s *Server) StreamStats() []StreamStats {
+	conns := s.registry.list()
+	var l []StreamStats
+	for _, c := range conns {
+		dc, ok := c.conn.(*defaultConn)
+		if !ok {
+			continue
+		}
+		for _, st := range dc.publishingStats() {
+			st.ConnID = c.id
+			l = append(l, st)
+		}
+	}
+	if len(l) == 0 {
+		return nil
+	}
+
+	subscribers := map[string]int{}
+	for _, c := range conns {
+		app := c.conn.ConnectParams().App
+		for _, stream := range c.conn.MessageStreams() {
+			if stream.State == MessageStreamStatePlaying {
+				subscribers[StreamPath(app, stream.Name)]++
+			}
+		}
+	}
+	for i := range l {
+		l[i].Subscribers = subscribers[l[i].Path]
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].App != l[j].App {
+			return l[i].App < l[j].App
+		}
+		if l[i].Name != l[j].Name {
+			return l[i].Name < l[j].Name
+		}
+		return l[i].ConnID < l[j].ConnID
+	})
+	return l
+}
+
+// StreamStatsByPath returns the stats of the stream published at path.
+func (s *Server) StreamStatsByPath(path string) (StreamStats, bool) {
+	for _, st := range s.StreamStats() {
+		if st.Path == path {
+			return st, true
+		}
+	}
+	return StreamStats{}, false
+}
+
+// Stat is the document served by StatHandler.
+type Stat struct {
+	Time         time.Time         `json:"time"`
+	Connections  int               `json:"connections"`
+	Applications []ApplicationStat `json:"applications"`
+}
+
+type ApplicationStat struct {
+	Name    string        `json:"name"`
+	Streams []StreamStats `json:"streams"`
+}
+
+// Stat returns the stats of the streams grouped by app, like the stat page
+// of nginx-rtmp.
+func (s *Server) Stat() Stat {
+	stat := Stat{
+		Time:         time.Now(),
+		Connections:  len(s.registry.list()),
+		Applications: []ApplicationStat{},
+	}
+	for _, st := range s.StreamStats() {
+		if n := len(stat.Applications); n == 0 || stat.Applications[n-1].Name != st.App {
+			stat.Applications = append(stat.Applications, ApplicationStat{Name: st.App})
+		}
+		app := &stat.Applications[len(stat.Applications)-1]
+		app.Streams = append(app.Streams, st)
+	}
+	return stat
+}
+
+// StatHandler serves Stat as JSON. The app query parameter selects one app.
+func (s *Server) StatHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stat := s.Stat()
+		if app := r.URL.Query().Get("app"); app != "" {
+			apps := []ApplicationStat{}
+			for _, a := range stat.Applications {
+				if a.Name == app {
+					apps = append(apps, a)
+				}
+			}
+			stat.Applications = apps
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(stat); err != nil {
+			s.logger.Warn("failed to write stat", zap.Error(err))
+		}
+	})
+}
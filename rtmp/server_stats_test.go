@@ -0,0 +1,88 @@
+package rtmp
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestServerStat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	go s.Serve(l)
+
+	client := NewClient(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()))
+	defer client.Close()
+	url := "rtmp://" + l.Addr().String() + "/live"
+
+	publisher, err := client.DialAndConnect(ctx, url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, publisher.CreateStream(ctx, publisher.TransactionID(), nil))
+	assert.NoError(t, publisher.Publish(ctx, ChunkStreamIDFor(MessageTypeIDCommandAMF0, 1), 1, "room", PublishingTypeLive))
+	for _, m := range []Message{
+		NewMessage(6, MessageTypeIDAudio, 0, 1, []byte{0xaf, 0x00, 0x11, 0x90}),
+		NewMessage(6, MessageTypeIDVideo, 0, 1, []byte{0x17, 0x01, 0, 0, 0}),
+	} {
+		_, err := publisher.Writer().WriteMessage(m)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, publisher.Writer().Flush())
+
+	player, err := client.DialAndConnect(ctx, url, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, player.CreateStream(ctx, player.TransactionID(), nil))
+	assert.NoError(t, sendPlay(ctx, player, 1, "room"))
+
+	var st StreamStats
+	for ctx.Err() == nil {
+		var ok bool
+		if st, ok = s.StreamStatsByPath("live/room"); ok && st.Subscribers == 1 && st.Video.Codec != "" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, "live", st.App)
+	assert.Equal(t, "room", st.Name)
+	assert.Equal(t, AudioCodec{Codec: "AAC", Profile: "LC", SampleRate: 48000, Channels: 2}, st.Audio)
+	assert.Equal(t, "H264", st.Video.Codec)
+	assert.Equal(t, 1, st.Subscribers)
+
+	rec := httptest.NewRecorder()
+	s.StatHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/stat?app=live", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	var stat Stat
+	if assert.NoError(t, json.NewDecoder(rec.Body).Decode(&stat)) {
+		assert.Equal(t, 2, stat.Connections)
+		if assert.Len(t, stat.Applications, 1) && assert.Len(t, stat.Applications[0].Streams, 1) {
+			assert.Equal(t, "live/room", stat.Applications[0].Streams[0].Path)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.StatHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/stat?app=other", nil))
+	assert.JSONEq(t, `[]`, string(mustJSONField(t, rec.Body.Bytes(), "applications")))
+}
+
+func mustJSONField(t *testing.T, b []byte, name string) json.RawMessage {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	return m[name]
+}
@@ -0,0 +1,237 @@
+package rtmp
+
+//go:generate stringer -type SharedObjectEventType -trimprefix SharedObjectEventType -output shared_object_event_type_string_gen.go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/hori-ryota/go-rtmp/rtmp/amf"
+	"github.com/pkg/errors"
+)
+
+type SharedObjectEventType uint8
+
+const (
+	SharedObjectEventTypeUse SharedObjectEventType = iota + 1
+	SharedObjectEventTypeRelease
+	SharedObjectEventTypeRequestChange
+	SharedObjectEventTypeChange
+	SharedObjectEventTypeSuccess
+	SharedObjectEventTypeSendMessage
+	SharedObjectEventTypeStatus
+	SharedObjectEventTypeClear
+	SharedObjectEventTypeRemove
+	SharedObjectEventTypeRequestRemove
+	SharedObjectEventTypeUseSuccess
+)
+
+// SharedObjectEvent is one event of a shared object message.
+type SharedObjectEvent struct {
+	Type SharedObjectEventType
+	// Name is the property of RequestChange, Change, Success, Remove and
+	// RequestRemove, the handler of SendMessage and the code of Status.
+	Name string
+	// Value is the property value of RequestChange and Change, and the
+	// level string of Status.
+	Value interface{}
+	// Args are the arguments of SendMessage.
+	Args []interface{}
+}
+
+// SharedObjectMessage is the payload of a shared object message. The AMF3
+// message type is framed like an AMF3 command: a format byte of 0x00, then
+// AMF0 values that switch to AMF3 where needed.
+type SharedObjectMessage struct {
+	Name       string
+	Version    uint32
+	Persistent bool
+	Events     []SharedObjectEvent
+}
+
+const sharedObjectPersistentFlag = 0x02
+
+// SharedObjectMessageTypeID is the message type for shared object messages
+// in encodingAMFType.
+func SharedObjectMessageTypeID(encodingAMFType EncodingAMFType) MessageTypeID {
+	if encodingAMFType == EncodingAMFTypeAMF3 {
+		return MessageTypeIDSharedObjectAMF3
+	}
+	return MessageTypeIDSharedObjectAMF0
+}
+
+func MarshalSharedObjectMessageBinary(m SharedObjectMessage, encodingAMFType EncodingAMFType) ([]byte, error) {
+	b := &bytes.Buffer{}
+	if encodingAMFType == EncodingAMFTypeAMF3 {
+		b.WriteByte(amf3FormatSelector)
+	}
+	if err := writeSharedObjectString(b, m.Name); err != nil {
+		return nil, errors.Wrap(err, "failed to write name")
+	}
+	binary.Write(b, binary.BigEndian, m.Version)
+	var flags uint32
+	if m.Persistent {
+		flags = sharedObjectPersistentFlag
+	}
+	binary.Write(b, binary.BigEndian, flags)
+	binary.Write(b, binary.BigEndian, uint32(0))
+
+	for _, ev := range m.Events {
+		data := &bytes.Buffer{}
+		e := amf.NewEncoder(data, amf.AMF0)
+		var err error
+		switch ev.Type {
+		case SharedObjectEventTypeRequestChange, SharedObjectEventTypeChange:
+			if err = writeSharedObjectString(data, ev.Name); err == nil {
+				err = e.Encode(ev.Value)
+			}
+		case SharedObjectEventTypeSuccess, SharedObjectEventTypeRemove, SharedObjectEventTypeRequestRemove:
+			err = writeSharedObjectString(data, ev.Name)
+		case SharedObjectEventTypeSendMessage:
+			if err = e.Encode(ev.Name); err == nil {
+				for _, arg := range ev.Args {
+					if err = e.Encode(arg); err != nil {
+						break
+					}
+				}
+			}
+		case SharedObjectEventTypeStatus:
+			level, _ := ev.Value.(string)
+			if err = writeSharedObjectString(data, ev.Name); err == nil {
+				err = writeSharedObjectString(data, level)
+			}
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to write %s event", ev.Type)
+		}
+		b.WriteByte(byte(ev.Type))
+		binary.Write(b, binary.BigEndian, uint32(data.Len()))
+		b.Write(data.Bytes())
+	}
+	return b.Bytes(), nil
+}
+
+func UnmarshalSharedObjectMessageBinary(b []byte, encodingAMFType EncodingAMFType) (SharedObjectMessage, error) {
+	var m SharedObjectMessage
+	if encodingAMFType == EncodingAMFTypeAMF3 {
+		var err error
+		if b, err = stripFormatSelector(b); err != nil {
+			return m, err
+		}
+	}
+	r := bytes.NewReader(b)
+	var err error
+	if m.Name, err = readSharedObjectString(r); err != nil {
+		return m, errors.Wrap(err, "failed to read name")
+	}
+	var header struct {
+		Version uint32
+		Flags   uint32
+		_       uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return m, errors.Wrap(err, "failed to read header")
+	}
+	m.Version = header.Version
+	m.Persistent = header.Flags != 0
+
+	for r.Len() > 0 {
+		var eventHeader struct {
+			Type   SharedObjectEventType
+			Length uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &eventHeader); err != nil {
+			return m, errors.Wrap(err, "failed to read event header")
+		}
+		if int64(eventHeader.Length) > int64(r.Len()) {
+			return m, errors.Errorf("%s event is longer than the message: %d", eventHeader.Type, eventHeader.Length)
+		}
+		data := make([]byte, eventHeader.Length)
+		r.Read(data)
+		events, err := unmarshalSharedObjectEvent(eventHeader.Type, data)
+		if err != nil {
+			return m, errors.Wrapf(err, "failed to read %s event", eventHeader.Type)
+		}
+		m.Events = append(m.Events, events...)
+	}
+	return m, nil
+}
+
+// unmarshalSharedObjectEvent returns one event for each property of a
+// RequestChange or Change that carries several.
+func unmarshalSharedObjectEvent(t SharedObjectEventType, data []byte) ([]SharedObjectEvent, error) {
+	r := bytes.NewReader(data)
+	d := amf.NewDecoder(r, amf.AMF0)
+	switch t {
+	case SharedObjectEventTypeUse, SharedObjectEventTypeRelease, SharedObjectEventTypeClear, SharedObjectEventTypeUseSuccess:
+		return []SharedObjectEvent{{Type: t}}, nil
+	case SharedObjectEventTypeRequestChange, SharedObjectEventTypeChange:
+		var events []SharedObjectEvent
+		for r.Len() > 0 {
+			name, err := readSharedObjectString(r)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.DecodeValue()
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, SharedObjectEvent{Type: t, Name: name, Value: v})
+		}
+		return events, nil
+	case SharedObjectEventTypeSuccess, SharedObjectEventTypeRemove, SharedObjectEventTypeRequestRemove:
+		name, err := readSharedObjectString(r)
+		if err != nil {
+			return nil, err
+		}
+		return []SharedObjectEvent{{Type: t, Name: name}}, nil
+	case SharedObjectEventTypeSendMessage:
+		ev := SharedObjectEvent{Type: t}
+		if err := d.Decode(&ev.Name); err != nil {
+			return nil, errors.Wrap(err, "failed to read handler name")
+		}
+		for r.Len() > 0 {
+			v, err := d.DecodeValue()
+			if err != nil {
+				return nil, err
+			}
+			ev.Args = append(ev.Args, v)
+		}
+		return []SharedObjectEvent{ev}, nil
+	case SharedObjectEventTypeStatus:
+		code, err := readSharedObjectString(r)
+		if err != nil {
+			return nil, err
+		}
+		level, err := readSharedObjectString(r)
+		if err != nil {
+			return nil, err
+		}
+		return []SharedObjectEvent{{Type: t, Name: code, Value: level}}, nil
+	}
+	return nil, errors.Errorf("unknown event type: %d", t)
+}
+
+func writeSharedObjectString(w io.Writer, s string) error {
+	if len(s) > math.MaxUint16 {
+		return errors.Errorf("string too long: %d bytes", len(s))
+	}
+	binary.Write(w, binary.BigEndian, uint16(len(s)))
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func readSharedObjectString(r *bytes.Reader) (string, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return "", err
+	}
+	if int(n) > r.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return string(b), nil
+}
@@ -0,0 +1,517 @@
+package rtmp
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// SharedObjectPersistence keeps persistent shared objects across restarts
+// and releases. Scope is the app of the connections using the object.
+type SharedObjectPersistence interface {
+	Load(scope, name string) (data map[string]interface{}, version uint32, ok bool, err error)
+	Save(scope, name string, data map[string]interface{}, version uint32) error
+}
+
+// SharedObjectStore holds the remote shared objects of a server. Each
+// change increments the version of its object and is sent to every
+// connection using the object. Objects are scoped by the app of the
+// connection.
+type SharedObjectStore struct {
+	// MaxObjectsPerScope limits the objects in use per app, 1024 by
+	// default. MaxProperties limits the properties of an object, 1024 by
+	// default.
+	MaxObjectsPerScope int
+	MaxProperties      int
+
+	persistence SharedObjectPersistence
+	logger      *zap.Logger
+
+	mu      sync.Mutex
+	objects map[sharedObjectKey]*sharedObject
+	// scopes counts the objects in s.objects by scope.
+	scopes map[string]int
+
+	sendersMu sync.Mutex
+	senders   map[Conn]*sharedObjectSender
+}
+
+type sharedObjectKey struct {
+	scope string
+	name  string
+}
+
+type sharedObject struct {
+	key        sharedObjectKey
+	persistent bool
+
+	// updateMu serializes changes across their save, which is done
+	// without mu so a slow persistence holds up no one but other changes.
+	updateMu sync.Mutex
+
+	// mu also serializes queueing, so every subscriber sees the changes in
+	// version order. data is replaced, never changed in place.
+	mu          sync.Mutex
+	version     uint32
+	data        map[string]interface{}
+	subscribers map[Conn]sharedObjectSubscriber
+}
+
+const (
+	defaultMaxSharedObjectsPerScope  = 1024
+	defaultMaxSharedObjectProperties = 1024
+)
+
+type sharedObjectSubscriber struct {
+	encodingAMFType EncodingAMFType
+	sender          *sharedObjectSender
+}
+
+// sharedObjectQueueSize is the number of messages queued for a connection.
+// A connection too slow to keep up with its queue is closed.
+const sharedObjectQueueSize = 256
+
+// sharedObjectSender writes the shared object messages of a connection
+// from its own goroutine, so a slow connection does not hold up the others.
+type sharedObjectSender struct {
+	conn      Conn
+	messages  chan Message
+	closeOnce sync.Once
+}
+
+// NewSharedObjectStore returns a store. persistence may be nil to keep
+// persistent objects in memory only.
+func NewSharedObjectStore(persistence SharedObjectPersistence, logger *zap.Logger) *SharedObjectStore {
+	return &SharedObjectStore{
+		persistence: persistence,
+		logger:      logger,
+		objects:     map[sharedObjectKey]*sharedObject{},
+		scopes:      map[string]int{},
+		senders:     map[Conn]*sharedObjectSender{},
+	}
+}
+
+// WithSharedObjectStore serves the shared object messages of each
+// connection from store.
+func WithSharedObjectStore(store *SharedObjectStore) ConnOption {
+	return WithConnInitializers(func(c Conn) {
+		c.AddMessageHandler("SharedObjectHandler", store.MessageHandler(c))
+	})
+}
+
+// MessageHandler handles the shared object messages of conn.
+func (s *SharedObjectStore) MessageHandler(conn Conn) MessageHandler {
+	var once sync.Once
+	return MessageHandlerFunc(func(ctx context.Context, m Message) ConnError {
+		var encodingAMFType EncodingAMFType
+		switch m.TypeID() {
+		case MessageTypeIDSharedObjectAMF0:
+			encodingAMFType = EncodingAMFTypeAMF0
+		case MessageTypeIDSharedObjectAMF3:
+			encodingAMFType = EncodingAMFTypeAMF3
+		default:
+			return nil
+		}
+		p, err := UnmarshalSharedObjectMessageBinary(m.Payload(), encodingAMFType)
+		if err != nil {
+			return NewConnWarnError(
+				errors.Wrap(err, "failed to unmarshal SharedObjectMessage"),
+				zap.Object("message", m),
+			)
+		}
+		once.Do(func() {
+			go func() {
+				<-conn.Context().Done()
+				s.releaseAll(conn)
+			}()
+		})
+		if err := s.handle(conn, encodingAMFType, p); err != nil {
+			return NewConnWarnError(
+				errors.Wrap(err, "failed to handle SharedObjectMessage"),
+				zap.String("name", p.Name),
+			)
+		}
+		return nil
+	})
+}
+
+func (s *SharedObjectStore) handle(conn Conn, encodingAMFType EncodingAMFType, p SharedObjectMessage) error {
+	key := sharedObjectKey{scope: conn.ConnectParams().App, name: p.Name}
+	for _, ev := range p.Events {
+		switch ev.Type {
+		case SharedObjectEventTypeUse:
+			if err := s.use(conn, encodingAMFType, key, p.Persistent); err != nil {
+				return err
+			}
+		case SharedObjectEventTypeRelease:
+			s.release(conn, key)
+		case SharedObjectEventTypeRequestChange:
+			if err := s.change(conn, key, ev.Name, ev.Value); err != nil {
+				return err
+			}
+		case SharedObjectEventTypeRequestRemove:
+			if err := s.remove(conn, key, ev.Name); err != nil {
+				return err
+			}
+		case SharedObjectEventTypeSendMessage:
+			if err := s.send(conn, key, ev); err != nil {
+				return err
+			}
+		default:
+			s.logger.Debug("ignored shared object event", zap.String("name", p.Name), zap.Stringer("type", ev.Type))
+		}
+	}
+	return nil
+}
+
+func (s *SharedObjectStore) object(key sharedObjectKey) (*sharedObject, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	so, ok := s.objects[key]
+	return so, ok
+}
+
+func (s *SharedObjectStore) use(conn Conn, encodingAMFType EncodingAMFType, key sharedObjectKey, persistent bool) error {
+	sender := s.sender(conn)
+	var so *sharedObject
+	for so == nil {
+		loaded, err := s.load(key, persistent)
+		if err != nil {
+			return err
+		}
+		s.mu.Lock()
+		// its last subscriber may have released it since it was loaded
+		if s.objects[key] == loaded {
+			so = loaded
+			so.mu.Lock()
+		}
+		s.mu.Unlock()
+	}
+	defer so.mu.Unlock()
+
+	so.subscribers[conn] = sharedObjectSubscriber{encodingAMFType: encodingAMFType, sender: sender}
+	events := []SharedObjectEvent{
+		{Type: SharedObjectEventTypeUseSuccess},
+		{Type: SharedObjectEventTypeClear},
+	}
+	for _, k := range so.keys() {
+		events = append(events, SharedObjectEvent{Type: SharedObjectEventTypeChange, Name: k, Value: so.data[k]})
+	}
+	return s.enqueue(so.subscribers[conn], so, events)
+}
+
+// load returns the object of key, loading it from persistence outside s.mu
+// if it is not in use.
+func (s *SharedObjectStore) load(key sharedObjectKey, persistent bool) (*sharedObject, error) {
+	if so, ok := s.object(key); ok {
+		return so, nil
+	}
+	so := &sharedObject{
+		key:         key,
+		persistent:  persistent,
+		data:        map[string]interface{}{},
+		subscribers: map[Conn]sharedObjectSubscriber{},
+	}
+	if persistent && s.persistence != nil {
+		data, version, ok, err := s.persistence.Load(key.scope, key.name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load shared object %s", key.name)
+		}
+		if ok {
+			so.data, so.version = data, version
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// another connection may have used the object while it was loading
+	if existing, ok := s.objects[key]; ok {
+		return existing, nil
+	}
+	if s.scopes[key.scope] >= s.maxObjectsPerScope() {
+		return nil, errors.Errorf("too many shared objects in %s", key.scope)
+	}
+	s.objects[key] = so
+	s.scopes[key.scope]++
+	return so, nil
+}
+
+func (s *SharedObjectStore) release(conn Conn, key sharedObjectKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	so, ok := s.objects[key]
+	if !ok {
+		return
+	}
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	delete(so.subscribers, conn)
+	if len(so.subscribers) == 0 && (!so.persistent || s.persistence != nil) {
+		// persistent objects are loaded again on the next use
+		delete(s.objects, key)
+		if s.scopes[key.scope]--; s.scopes[key.scope] == 0 {
+			delete(s.scopes, key.scope)
+		}
+	}
+}
+
+func (s *SharedObjectStore) releaseAll(conn Conn) {
+	s.mu.Lock()
+	var keys []sharedObjectKey
+	for k, so := range s.objects {
+		so.mu.Lock()
+		if _, ok := so.subscribers[conn]; ok {
+			keys = append(keys, k)
+		}
+		so.mu.Unlock()
+	}
+	s.mu.Unlock()
+	for _, k := range keys {
+		s.release(conn, k)
+	}
+	s.sendersMu.Lock()
+	delete(s.senders, conn)
+	s.sendersMu.Unlock()
+}
+
+func (s *SharedObjectStore) change(from Conn, key sharedObjectKey, name string, value interface{}) error {
+	so, ok := s.object(key)
+	if !ok {
+		return errors.Errorf("shared object is not in use: %s", key.name)
+	}
+	return s.update(so, from, name, value, false)
+}
+
+func (s *SharedObjectStore) remove(from Conn, key sharedObjectKey, name string) error {
+	so, ok := s.object(key)
+	if !ok {
+		return errors.Errorf("shared object is not in use: %s", key.name)
+	}
+	return s.update(so, from, name, nil, true)
+}
+
+// update sets or removes a property, requested by from or, if from is nil,
+// by the server. The new data is saved before it is committed and sent, so
+// subscribers never see a change that failed to persist.
+func (s *SharedObjectStore) update(so *sharedObject, from Conn, name string, value interface{}, remove bool) error {
+	so.updateMu.Lock()
+	defer so.updateMu.Unlock()
+
+	so.mu.Lock()
+	if err := so.checkSubscriber(from); err != nil {
+		so.mu.Unlock()
+		return err
+	}
+	_, exists := so.data[name]
+	if remove && !exists {
+		so.mu.Unlock()
+		return nil
+	}
+	if !remove && !exists && len(so.data) >= s.maxProperties() {
+		so.mu.Unlock()
+		return errors.Errorf("too many properties in shared object %s", so.key.name)
+	}
+	data := make(map[string]interface{}, len(so.data)+1)
+	for k, v := range so.data {
+		data[k] = v
+	}
+	if remove {
+		delete(data, name)
+	} else {
+		data[name] = value
+	}
+	version := so.version + 1
+	so.mu.Unlock()
+
+	if err := s.save(so, data, version); err != nil {
+		return err
+	}
+
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	so.data, so.version = data, version
+	for conn, sub := range so.subscribers {
+		ev := SharedObjectEvent{Type: SharedObjectEventTypeChange, Name: name, Value: value}
+		if remove {
+			ev = SharedObjectEvent{Type: SharedObjectEventTypeRemove, Name: name}
+		} else if conn == from {
+			ev = SharedObjectEvent{Type: SharedObjectEventTypeSuccess, Name: name}
+		}
+		s.enqueue(sub, so, []SharedObjectEvent{ev})
+	}
+	return nil
+}
+
+func (s *SharedObjectStore) send(from Conn, key sharedObjectKey, ev SharedObjectEvent) error {
+	so, ok := s.object(key)
+	if !ok {
+		return errors.Errorf("shared object is not in use: %s", key.name)
+	}
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	if err := so.checkSubscriber(from); err != nil {
+		return err
+	}
+	s.broadcast(so, ev)
+	return nil
+}
+
+// SetProperty changes a property from the server side.
+func (s *SharedObjectStore) SetProperty(scope, name, property string, value interface{}) error {
+	so, ok := s.object(sharedObjectKey{scope: scope, name: name})
+	if !ok {
+		return errors.Errorf("shared object is not in use: %s", name)
+	}
+	return s.update(so, nil, property, value, false)
+}
+
+// Send calls handler with args on every connection using the object.
+func (s *SharedObjectStore) Send(scope, name, handler string, args ...interface{}) error {
+	return s.send(nil, sharedObjectKey{scope: scope, name: name}, SharedObjectEvent{
+		Type: SharedObjectEventTypeSendMessage,
+		Name: handler,
+		Args: args,
+	})
+}
+
+// Properties returns a copy of the properties of an object in use and its
+// version.
+func (s *SharedObjectStore) Properties(scope, name string) (map[string]interface{}, uint32, bool) {
+	so, ok := s.object(sharedObjectKey{scope: scope, name: name})
+	if !ok {
+		return nil, 0, false
+	}
+	so.mu.Lock()
+	defer so.mu.Unlock()
+	data := make(map[string]interface{}, len(so.data))
+	for k, v := range so.data {
+		data[k] = v
+	}
+	return data, so.version, true
+}
+
+func (s *SharedObjectStore) save(so *sharedObject, data map[string]interface{}, version uint32) error {
+	if !so.persistent || s.persistence == nil {
+		return nil
+	}
+	if err := s.persistence.Save(so.key.scope, so.key.name, data, version); err != nil {
+		return errors.Wrapf(err, "failed to save shared object %s", so.key.name)
+	}
+	return nil
+}
+
+func (s *SharedObjectStore) broadcast(so *sharedObject, ev SharedObjectEvent) {
+	for _, sub := range so.subscribers {
+		s.enqueue(sub, so, []SharedObjectEvent{ev})
+	}
+}
+
+// enqueue queues events for a subscriber. so.mu must be held.
+func (s *SharedObjectStore) enqueue(sub sharedObjectSubscriber, so *sharedObject, events []SharedObjectEvent) error {
+	b, err := MarshalSharedObjectMessageBinary(SharedObjectMessage{
+		Name:       so.key.name,
+		Version:    so.version,
+		Persistent: so.persistent,
+		Events:     events,
+	}, sub.encodingAMFType)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal SharedObjectMessage")
+	}
+	typeID := SharedObjectMessageTypeID(sub.encodingAMFType)
+	m := NewMessage(ChunkStreamIDFor(typeID, 0), typeID, connTimestamp(sub.sender.conn), 0, b)
+	select {
+	case sub.sender.messages <- m:
+	default:
+		sub.sender.closeOnce.Do(func() {
+			s.logger.Warn("closing conn too slow for shared objects", zap.String("name", so.key.name))
+			if err := sub.sender.conn.Close(); err != nil {
+				s.logger.Warn("failed to close conn", zap.Error(err))
+			}
+		})
+	}
+	return nil
+}
+
+// sender returns the sender of conn, starting it on first use.
+func (s *SharedObjectStore) sender(conn Conn) *sharedObjectSender {
+	s.sendersMu.Lock()
+	defer s.sendersMu.Unlock()
+	if sender, ok := s.senders[conn]; ok {
+		return sender
+	}
+	sender := &sharedObjectSender{
+		conn:     conn,
+		messages: make(chan Message, sharedObjectQueueSize),
+	}
+	s.senders[conn] = sender
+	go s.writeLoop(sender)
+	return sender
+}
+
+// writeLoop writes the queued messages of sender until its connection
+// closes. A failed write is logged; the connection releases its objects when
+// it closes.
+func (s *SharedObjectStore) writeLoop(sender *sharedObjectSender) {
+	w := sender.conn.Writer()
+	for {
+		select {
+		case <-sender.conn.Context().Done():
+			return
+		case m := <-sender.messages:
+			if _, err := w.WriteMessage(m); err != nil {
+				s.logger.Warn("failed to write SharedObjectMessage", zap.Error(err))
+				continue
+			}
+			if len(sender.messages) > 0 {
+				continue
+			}
+			if err := w.Flush(); err != nil {
+				s.logger.Warn("failed to flush SharedObjectMessage", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *SharedObjectStore) maxObjectsPerScope() int {
+	if s.MaxObjectsPerScope <= 0 {
+		return defaultMaxSharedObjectsPerScope
+	}
+	return s.MaxObjectsPerScope
+}
+
+func (s *SharedObjectStore) maxProperties() int {
+	if s.MaxProperties <= 0 {
+		return defaultMaxSharedObjectProperties
+	}
+	return s.MaxProperties
+}
+
+// checkSubscriber fails unless from uses the object. A nil from is the
+// server. so.mu must be held.
+func (so *sharedObject) checkSubscriber(from Conn) error {
+	if from == nil {
+		return nil
+	}
+	if _, ok := so.subscribers[from]; !ok {
+		return errors.Errorf("shared object is not used by the conn: %s", so.key.name)
+	}
+	return nil
+}
+
+func (so *sharedObject) keys() []string {
+	keys := make([]string, 0, len(so.data))
+	for k := range so.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func connTimestamp(conn Conn) uint32 {
+	if c, ok := conn.(interface{ Timestamp() uint32 }); ok {
+		return c.Timestamp()
+	}
+	return 0
+}
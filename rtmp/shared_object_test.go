@@ -0,0 +1,366 @@
+package rtmp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestSharedObjectMessageBinary(t *testing.T) {
+	m := SharedObjectMessage{
+		Name:       "chat",
+		Version:    3,
+		Persistent: true,
+		Events: []SharedObjectEvent{
+			{Type: SharedObjectEventTypeUse},
+			{Type: SharedObjectEventTypeRequestChange, Name: "topic", Value: "go"},
+			{Type: SharedObjectEventTypeChange, Name: "users", Value: []interface{}{"a", "b"}},
+			{Type: SharedObjectEventTypeSuccess, Name: "topic"},
+			{Type: SharedObjectEventTypeSendMessage, Name: "say", Args: []interface{}{"hello", true}},
+			{Type: SharedObjectEventTypeStatus, Name: "SharedObject.BadPersistence", Value: "error"},
+			{Type: SharedObjectEventTypeClear},
+			{Type: SharedObjectEventTypeRemove, Name: "topic"},
+			{Type: SharedObjectEventTypeRequestRemove, Name: "topic"},
+			{Type: SharedObjectEventTypeUseSuccess},
+			{Type: SharedObjectEventTypeRelease},
+		},
+	}
+	for _, encodingAMFType := range []EncodingAMFType{EncodingAMFTypeAMF0, EncodingAMFTypeAMF3} {
+		t.Run(encodingAMFType.String(), func(t *testing.T) {
+			b, err := MarshalSharedObjectMessageBinary(m, encodingAMFType)
+			if !assert.NoError(t, err) {
+				return
+			}
+			got, err := UnmarshalSharedObjectMessageBinary(b, encodingAMFType)
+			assert.NoError(t, err)
+			assert.Equal(t, m, got)
+
+			_, err = UnmarshalSharedObjectMessageBinary(b[:len(b)-1], encodingAMFType)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSharedObjectMessageBinaryMultipleChanges(t *testing.T) {
+	b := []byte{
+		0x00, 0x01, 'o', // name
+		0x00, 0x00, 0x00, 0x01, // version
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // flags
+		0x04, 0x00, 0x00, 0x00, 0x09, // Change with two properties
+		0x00, 0x01, 'a', 0x05,
+		0x00, 0x01, 'b', 0x01, 0x01,
+	}
+	got, err := UnmarshalSharedObjectMessageBinary(b, EncodingAMFTypeAMF0)
+	assert.NoError(t, err)
+	assert.Equal(t, SharedObjectMessage{
+		Name:    "o",
+		Version: 1,
+		Events: []SharedObjectEvent{
+			{Type: SharedObjectEventTypeChange, Name: "a", Value: nil},
+			{Type: SharedObjectEventTypeChange, Name: "b", Value: true},
+		},
+	}, got)
+}
+
+func TestSharedObjectMessageBinaryAMF3Framing(t *testing.T) {
+	// the format byte, then AMF0 with an AMF3 integer behind avmplus-object
+	b := []byte{
+		0x00,
+		0x00, 0x01, 'o', // name
+		0x00, 0x00, 0x00, 0x01, // version
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // flags
+		0x04, 0x00, 0x00, 0x00, 0x06, // Change
+		0x00, 0x01, 'a', 0x11, 0x04, 0x05,
+	}
+	got, err := UnmarshalSharedObjectMessageBinary(b, EncodingAMFTypeAMF3)
+	assert.NoError(t, err)
+	assert.Equal(t, []SharedObjectEvent{{Type: SharedObjectEventTypeChange, Name: "a", Value: 5}}, got.Events)
+
+	_, err = UnmarshalSharedObjectMessageBinary(append([]byte{0x11}, b[1:]...), EncodingAMFTypeAMF3)
+	assert.Error(t, err)
+}
+
+type recordingWriter struct {
+	Writer
+	mu       sync.Mutex
+	messages []SharedObjectMessage
+}
+
+func (w *recordingWriter) WriteMessage(m Message) (int, error) {
+	encodingAMFType := EncodingAMFTypeAMF0
+	if m.TypeID() == MessageTypeIDSharedObjectAMF3 {
+		encodingAMFType = EncodingAMFTypeAMF3
+	}
+	p, err := UnmarshalSharedObjectMessageBinary(m.Payload(), encodingAMFType)
+	if err != nil {
+		return 0, err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.messages = append(w.messages, p)
+	return len(m.Payload()), nil
+}
+
+func (w *recordingWriter) Flush() error {
+	return nil
+}
+
+// take waits for the messages written by the store and returns them.
+func (w *recordingWriter) take() []SharedObjectMessage {
+	deadline := time.Now().Add(time.Second)
+	for {
+		w.mu.Lock()
+		ms := w.messages
+		if len(ms) > 0 || time.Now().After(deadline) {
+			w.messages = nil
+			w.mu.Unlock()
+			return ms
+		}
+		w.mu.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type sharedObjectTestConn struct {
+	Conn
+	ctx context.Context
+	w   *recordingWriter
+}
+
+func (c *sharedObjectTestConn) Context() context.Context {
+	return c.ctx
+}
+
+func (c *sharedObjectTestConn) Writer() Writer {
+	return c.w
+}
+
+func (c *sharedObjectTestConn) ConnectParams() ConnectParams {
+	return ConnectParams{App: "live"}
+}
+
+// blockingWriter blocks every write until release is done.
+type blockingWriter struct {
+	recordingWriter
+	release context.Context
+}
+
+func (w *blockingWriter) WriteMessage(m Message) (int, error) {
+	<-w.release.Done()
+	return w.recordingWriter.WriteMessage(m)
+}
+
+type slowSharedObjectTestConn struct {
+	Conn
+	ctx    context.Context
+	cancel context.CancelFunc
+	w      *blockingWriter
+}
+
+func (c *slowSharedObjectTestConn) Context() context.Context {
+	return c.ctx
+}
+
+func (c *slowSharedObjectTestConn) Writer() Writer {
+	return c.w
+}
+
+func (c *slowSharedObjectTestConn) ConnectParams() ConnectParams {
+	return ConnectParams{App: "live"}
+}
+
+func (c *slowSharedObjectTestConn) Close() error {
+	c.cancel()
+	return nil
+}
+
+type memoryPersistence struct {
+	data    map[string]map[string]interface{}
+	version map[string]uint32
+}
+
+func (p *memoryPersistence) Load(scope, name string) (map[string]interface{}, uint32, bool, error) {
+	data, ok := p.data[scope+"/"+name]
+	return data, p.version[scope+"/"+name], ok, nil
+}
+
+func (p *memoryPersistence) Save(scope, name string, data map[string]interface{}, version uint32) error {
+	copied := map[string]interface{}{}
+	for k, v := range data {
+		copied[k] = v
+	}
+	p.data[scope+"/"+name] = copied
+	p.version[scope+"/"+name] = version
+	return nil
+}
+
+func TestSharedObjectStore(t *testing.T) {
+	persistence := &memoryPersistence{data: map[string]map[string]interface{}{}, version: map[string]uint32{}}
+	store := NewSharedObjectStore(persistence, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &sharedObjectTestConn{ctx: ctx, w: &recordingWriter{}}
+	b := &sharedObjectTestConn{ctx: context.Background(), w: &recordingWriter{}}
+	ha, hb := store.MessageHandler(a), store.MessageHandler(b)
+
+	send := func(h MessageHandler, encodingAMFType EncodingAMFType, events ...SharedObjectEvent) {
+		p, err := MarshalSharedObjectMessageBinary(SharedObjectMessage{Name: "room", Persistent: true, Events: events}, encodingAMFType)
+		assert.NoError(t, err)
+		typeID := SharedObjectMessageTypeID(encodingAMFType)
+		assert.Nil(t, h.HandleMessage(context.Background(), NewMessage(3, typeID, 0, 0, p)))
+	}
+
+	send(ha, EncodingAMFTypeAMF0, SharedObjectEvent{Type: SharedObjectEventTypeUse})
+	assert.Equal(t, []SharedObjectMessage{{
+		Name:       "room",
+		Persistent: true,
+		Events: []SharedObjectEvent{
+			{Type: SharedObjectEventTypeUseSuccess},
+			{Type: SharedObjectEventTypeClear},
+		},
+	}}, a.w.take())
+
+	send(ha, EncodingAMFTypeAMF0, SharedObjectEvent{Type: SharedObjectEventTypeRequestChange, Name: "topic", Value: "go"})
+	assert.Equal(t, []SharedObjectEvent{{Type: SharedObjectEventTypeSuccess, Name: "topic"}}, a.w.take()[0].Events)
+
+	send(hb, EncodingAMFTypeAMF3, SharedObjectEvent{Type: SharedObjectEventTypeUse})
+	ms := b.w.take()
+	if assert.Len(t, ms, 1) {
+		assert.Equal(t, uint32(1), ms[0].Version)
+		assert.Equal(t, SharedObjectEvent{Type: SharedObjectEventTypeChange, Name: "topic", Value: "go"}, ms[0].Events[2])
+	}
+
+	send(hb, EncodingAMFTypeAMF3, SharedObjectEvent{Type: SharedObjectEventTypeRequestChange, Name: "count", Value: 2})
+	ms = a.w.take()
+	if assert.Len(t, ms, 1) {
+		assert.Equal(t, uint32(2), ms[0].Version)
+		assert.Equal(t, []SharedObjectEvent{{Type: SharedObjectEventTypeChange, Name: "count", Value: 2.0}}, ms[0].Events)
+	}
+	b.w.take()
+
+	send(ha, EncodingAMFTypeAMF0, SharedObjectEvent{Type: SharedObjectEventTypeSendMessage, Name: "say", Args: []interface{}{"hi"}})
+	want := []SharedObjectEvent{{Type: SharedObjectEventTypeSendMessage, Name: "say", Args: []interface{}{"hi"}}}
+	assert.Equal(t, want, a.w.take()[0].Events)
+	assert.Equal(t, want, b.w.take()[0].Events)
+
+	send(hb, EncodingAMFTypeAMF3, SharedObjectEvent{Type: SharedObjectEventTypeRequestRemove, Name: "topic"})
+	assert.Equal(t, SharedObjectEventTypeRemove, a.w.take()[0].Events[0].Type)
+	assert.Equal(t, SharedObjectEventTypeRemove, b.w.take()[0].Events[0].Type)
+
+	data, version, ok := store.Properties("live", "room")
+	assert.True(t, ok)
+	assert.Equal(t, uint32(3), version)
+	assert.Equal(t, map[string]interface{}{"count": 2.0}, data)
+
+	assert.NoError(t, store.SetProperty("live", "room", "count", 3))
+	assert.Equal(t, uint32(4), a.w.take()[0].Version)
+	b.w.take()
+
+	// a leaves by closing, b releases; the persisted object survives
+	cancel()
+	assert.Eventually(t, func() bool {
+		so, _ := store.object(sharedObjectKey{"live", "room"})
+		so.mu.Lock()
+		defer so.mu.Unlock()
+		return len(so.subscribers) == 1
+	}, time.Second, time.Millisecond)
+	send(hb, EncodingAMFTypeAMF3, SharedObjectEvent{Type: SharedObjectEventTypeRelease})
+	_, _, ok = store.Properties("live", "room")
+	assert.False(t, ok)
+	assert.Equal(t, uint32(4), persistence.version["live/room"])
+
+	send(hb, EncodingAMFTypeAMF3, SharedObjectEvent{Type: SharedObjectEventTypeUse})
+	ms = b.w.take()
+	if assert.Len(t, ms, 1) {
+		assert.Equal(t, uint32(4), ms[0].Version)
+		assert.Equal(t, SharedObjectEvent{Type: SharedObjectEventTypeChange, Name: "count", Value: 3.0}, ms[0].Events[2])
+	}
+}
+
+func TestSharedObjectStoreSlowSubscriber(t *testing.T) {
+	store := NewSharedObjectStore(nil, zap.NewNop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release, unblock := context.WithCancel(context.Background())
+	defer unblock()
+	slow := &slowSharedObjectTestConn{w: &blockingWriter{release: release}}
+	slow.ctx, slow.cancel = context.WithCancel(context.Background())
+	fast := &sharedObjectTestConn{ctx: ctx, w: &recordingWriter{}}
+	key := sharedObjectKey{"live", "room"}
+	assert.NoError(t, store.use(slow, EncodingAMFTypeAMF0, key, false))
+	assert.NoError(t, store.use(fast, EncodingAMFTypeAMF0, key, false))
+	fast.w.take()
+
+	// the slow conn holds up neither the fast one nor the store, and is
+	// closed once its queue is full
+	for i := 0; i <= sharedObjectQueueSize+1; i++ {
+		assert.NoError(t, store.SetProperty("live", "room", "count", i))
+		assert.Len(t, fast.w.take(), 1)
+	}
+	select {
+	case <-slow.ctx.Done():
+	case <-time.After(time.Second):
+		t.Error("slow conn is not closed")
+	}
+}
+
+// blockingPersistence blocks every save until release is done.
+type blockingPersistence struct {
+	saving  chan struct{}
+	release context.Context
+}
+
+func (p *blockingPersistence) Load(scope, name string) (map[string]interface{}, uint32, bool, error) {
+	return nil, 0, false, nil
+}
+
+func (p *blockingPersistence) Save(scope, name string, data map[string]interface{}, version uint32) error {
+	p.saving <- struct{}{}
+	<-p.release.Done()
+	return nil
+}
+
+func TestSharedObjectStoreUpdate(t *testing.T) {
+	release, unblock := context.WithCancel(context.Background())
+	defer unblock()
+	persistence := &blockingPersistence{saving: make(chan struct{}, 1), release: release}
+	store := NewSharedObjectStore(persistence, zap.NewNop())
+	store.MaxObjectsPerScope = 1
+	store.MaxProperties = 1
+
+	a := &sharedObjectTestConn{ctx: context.Background(), w: &recordingWriter{}}
+	b := &sharedObjectTestConn{ctx: context.Background(), w: &recordingWriter{}}
+	key := sharedObjectKey{"live", "room"}
+	assert.NoError(t, store.use(a, EncodingAMFTypeAMF0, key, true))
+	a.w.take()
+	assert.Error(t, store.use(a, EncodingAMFTypeAMF0, sharedObjectKey{"live", "other"}, true))
+
+	// only subscribers change the object
+	assert.Error(t, store.change(b, key, "topic", "go"))
+	assert.Error(t, store.remove(b, key, "topic"))
+	assert.Error(t, store.send(b, key, SharedObjectEvent{Type: SharedObjectEventTypeSendMessage, Name: "say"}))
+
+	// the change is neither visible nor sent before it is saved, and the
+	// save does not hold up readers
+	changed := make(chan error, 1)
+	go func() { changed <- store.change(a, key, "topic", "go") }()
+	<-persistence.saving
+	data, version, ok := store.Properties("live", "room")
+	assert.True(t, ok)
+	assert.Empty(t, data)
+	assert.Equal(t, uint32(0), version)
+	unblock()
+	assert.NoError(t, <-changed)
+	assert.Equal(t, []SharedObjectEvent{{Type: SharedObjectEventTypeSuccess, Name: "topic"}}, a.w.take()[0].Events)
+	data, version, _ = store.Properties("live", "room")
+	assert.Equal(t, map[string]interface{}{"topic": "go"}, data)
+	assert.Equal(t, uint32(1), version)
+
+	go func() { <-persistence.saving }()
+	assert.Error(t, store.change(a, key, "count", 1))
+}
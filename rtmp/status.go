@@ -0,0 +1,320 @@
+package rtmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type StatusLevel string
+
+const (
+	StatusLevelStatus  StatusLevel = "status"
+	StatusLevelWarning StatusLevel = "warning"
+	StatusLevelError   StatusLevel = "error"
+)
+
+// StatusCode is the code of an info object sent by onStatus, _result and
+// _error.
+type StatusCode string
+
+const (
+	StatusCodeNetConnectionCallBadVersion          StatusCode = "NetConnection.Call.BadVersion"
+	StatusCodeNetConnectionCallFailed              StatusCode = "NetConnection.Call.Failed"
+	StatusCodeNetConnectionCallProhibited          StatusCode = "NetConnection.Call.Prohibited"
+	StatusCodeNetConnectionConnectAppShutdown      StatusCode = "NetConnection.Connect.AppShutdown"
+	StatusCodeNetConnectionConnectClosed           StatusCode = "NetConnection.Connect.Closed"
+	StatusCodeNetConnectionConnectFailed           StatusCode = "NetConnection.Connect.Failed"
+	StatusCodeNetConnectionConnectIdleTimeout      StatusCode = "NetConnection.Connect.IdleTimeout"
+	StatusCodeNetConnectionConnectInvalidApp       StatusCode = "NetConnection.Connect.InvalidApp"
+	StatusCodeNetConnectionConnectNetworkChange    StatusCode = "NetConnection.Connect.NetworkChange"
+	StatusCodeNetConnectionConnectReconnectRequest StatusCode = "NetConnection.Connect.ReconnectRequest"
+	StatusCodeNetConnectionConnectRejected         StatusCode = "NetConnection.Connect.Rejected"
+	StatusCodeNetConnectionConnectSuccess          StatusCode = "NetConnection.Connect.Success"
+	StatusCodeNetStreamBufferEmpty                 StatusCode = "NetStream.Buffer.Empty"
+	StatusCodeNetStreamBufferFlush                 StatusCode = "NetStream.Buffer.Flush"
+	StatusCodeNetStreamBufferFull                  StatusCode = "NetStream.Buffer.Full"
+	StatusCodeNetStreamConnectClosed               StatusCode = "NetStream.Connect.Closed"
+	StatusCodeNetStreamConnectFailed               StatusCode = "NetStream.Connect.Failed"
+	StatusCodeNetStreamConnectRejected             StatusCode = "NetStream.Connect.Rejected"
+	StatusCodeNetStreamConnectSuccess              StatusCode = "NetStream.Connect.Success"
+	StatusCodeNetStreamDRMUpdateNeeded             StatusCode = "NetStream.DRM.UpdateNeeded"
+	StatusCodeNetStreamFailed                      StatusCode = "NetStream.Failed"
+	StatusCodeNetStreamMulticastStreamReset        StatusCode = "NetStream.MulticastStream.Reset"
+	StatusCodeNetStreamPauseNotify                 StatusCode = "NetStream.Pause.Notify"
+	StatusCodeNetStreamPlayComplete                StatusCode = "NetStream.Play.Complete"
+	StatusCodeNetStreamPlayFailed                  StatusCode = "NetStream.Play.Failed"
+	StatusCodeNetStreamPlayFileStructureInvalid    StatusCode = "NetStream.Play.FileStructureInvalid"
+	StatusCodeNetStreamPlayInsufficientBW          StatusCode = "NetStream.Play.InsufficientBW"
+	StatusCodeNetStreamPlayNoSupportedTrackFound   StatusCode = "NetStream.Play.NoSupportedTrackFound"
+	StatusCodeNetStreamPlayPublishNotify           StatusCode = "NetStream.Play.PublishNotify"
+	StatusCodeNetStreamPlayReset                   StatusCode = "NetStream.Play.Reset"
+	StatusCodeNetStreamPlayStart                   StatusCode = "NetStream.Play.Start"
+	StatusCodeNetStreamPlayStop                    StatusCode = "NetStream.Play.Stop"
+	StatusCodeNetStreamPlayStreamNotFound          StatusCode = "NetStream.Play.StreamNotFound"
+	StatusCodeNetStreamPlaySwitch                  StatusCode = "NetStream.Play.Switch"
+	StatusCodeNetStreamPlayTransition              StatusCode = "NetStream.Play.Transition"
+	StatusCodeNetStreamPlayTransitionComplete      StatusCode = "NetStream.Play.TransitionComplete"
+	StatusCodeNetStreamPlayUnpublishNotify         StatusCode = "NetStream.Play.UnpublishNotify"
+	StatusCodeNetStreamPublishBadName              StatusCode = "NetStream.Publish.BadName"
+	StatusCodeNetStreamPublishFailed               StatusCode = "NetStream.Publish.Failed"
+	StatusCodeNetStreamPublishIdle                 StatusCode = "NetStream.Publish.Idle"
+	StatusCodeNetStreamPublishStart                StatusCode = "NetStream.Publish.Start"
+	StatusCodeNetStreamRecordAlreadyExists         StatusCode = "NetStream.Record.AlreadyExists"
+	StatusCodeNetStreamRecordDiskQuotaExceeded     StatusCode = "NetStream.Record.DiskQuotaExceeded"
+	StatusCodeNetStreamRecordFailed                StatusCode = "NetStream.Record.Failed"
+	StatusCodeNetStreamRecordNoAccess              StatusCode = "NetStream.Record.NoAccess"
+	StatusCodeNetStreamRecordStart                 StatusCode = "NetStream.Record.Start"
+	StatusCodeNetStreamRecordStop                  StatusCode = "NetStream.Record.Stop"
+	StatusCodeNetStreamSeekFailed                  StatusCode = "NetStream.Seek.Failed"
+	StatusCodeNetStreamSeekInvalidTime             StatusCode = "NetStream.Seek.InvalidTime"
+	StatusCodeNetStreamSeekNotify                  StatusCode = "NetStream.Seek.Notify"
+	StatusCodeNetStreamStepNotify                  StatusCode = "NetStream.Step.Notify"
+	StatusCodeNetStreamUnpauseNotify               StatusCode = "NetStream.Unpause.Notify"
+	StatusCodeNetStreamUnpublishSuccess            StatusCode = "NetStream.Unpublish.Success"
+	StatusCodeNetStreamVideoDimensionChange        StatusCode = "NetStream.Video.DimensionChange"
+	StatusCodeSharedObjectBadPersistence           StatusCode = "SharedObject.BadPersistence"
+	StatusCodeSharedObjectFlushFailed              StatusCode = "SharedObject.Flush.Failed"
+	StatusCodeSharedObjectFlushSuccess             StatusCode = "SharedObject.Flush.Success"
+	StatusCodeSharedObjectURIMismatch              StatusCode = "SharedObject.UriMismatch"
+)
+
+type statusCodeInfo struct {
+	level       StatusLevel
+	description string
+}
+
+var statusCodes = map[StatusCode]statusCodeInfo{
+	StatusCodeNetConnectionCallBadVersion:          {StatusLevelError, "Packet encoded in an unidentified format."},
+	StatusCodeNetConnectionCallFailed:              {StatusLevelError, "The call was not able to invoke the server-side method or command."},
+	StatusCodeNetConnectionCallProhibited:          {StatusLevelError, "An AMF operation is prevented for security reasons."},
+	StatusCodeNetConnectionConnectAppShutdown:      {StatusLevelError, "The server-side application is shutting down."},
+	StatusCodeNetConnectionConnectClosed:           {StatusLevelStatus, "The connection was closed successfully."},
+	StatusCodeNetConnectionConnectFailed:           {StatusLevelError, "The connection attempt failed."},
+	StatusCodeNetConnectionConnectIdleTimeout:      {StatusLevelStatus, "The server disconnected the client because it was idle too long."},
+	StatusCodeNetConnectionConnectInvalidApp:       {StatusLevelError, "The application name specified in connect is invalid."},
+	StatusCodeNetConnectionConnectNetworkChange:    {StatusLevelStatus, "A network change was detected."},
+	StatusCodeNetConnectionConnectReconnectRequest: {StatusLevelStatus, "The server asks the client to reconnect."},
+	StatusCodeNetConnectionConnectRejected:         {StatusLevelError, "The connection attempt did not have permission to access the application."},
+	StatusCodeNetConnectionConnectSuccess:          {StatusLevelStatus, "Connection succeeded."},
+	StatusCodeNetStreamBufferEmpty:                 {StatusLevelStatus, "Data is not being received quickly enough to fill the buffer."},
+	StatusCodeNetStreamBufferFlush:                 {StatusLevelStatus, "Data has finished streaming, and the remaining buffer will be emptied."},
+	StatusCodeNetStreamBufferFull:                  {StatusLevelStatus, "The buffer is full and the stream will begin playing."},
+	StatusCodeNetStreamConnectClosed:               {StatusLevelStatus, "The P2P connection was closed successfully."},
+	StatusCodeNetStreamConnectFailed:               {StatusLevelError, "The P2P connection attempt failed."},
+	StatusCodeNetStreamConnectRejected:             {StatusLevelError, "The P2P connection attempt did not have permission to access the other peer."},
+	StatusCodeNetStreamConnectSuccess:              {StatusLevelStatus, "The P2P connection attempt succeeded."},
+	StatusCodeNetStreamDRMUpdateNeeded:             {StatusLevelStatus, "The DRM module needs to be updated."},
+	StatusCodeNetStreamFailed:                      {StatusLevelError, "An error has occurred for a reason other than those listed in other codes."},
+	StatusCodeNetStreamMulticastStreamReset:        {StatusLevelStatus, "A multicast subscription has changed focus to a different stream."},
+	StatusCodeNetStreamPauseNotify:                 {StatusLevelStatus, "The stream is paused."},
+	StatusCodeNetStreamPlayComplete:                {StatusLevelStatus, "Playback has completed."},
+	StatusCodeNetStreamPlayFailed:                  {StatusLevelError, "An error has occurred in playback."},
+	StatusCodeNetStreamPlayFileStructureInvalid:    {StatusLevelError, "The file structure is invalid."},
+	StatusCodeNetStreamPlayInsufficientBW:          {StatusLevelWarning, "The client does not have sufficient bandwidth to play the data at normal speed."},
+	StatusCodeNetStreamPlayNoSupportedTrackFound:   {StatusLevelError, "The file does not contain any supported tracks."},
+	StatusCodeNetStreamPlayPublishNotify:           {StatusLevelStatus, "The initial publish to a stream is sent to all subscribers."},
+	StatusCodeNetStreamPlayReset:                   {StatusLevelStatus, "The playlist has reset."},
+	StatusCodeNetStreamPlayStart:                   {StatusLevelStatus, "Playback has started."},
+	StatusCodeNetStreamPlayStop:                    {StatusLevelStatus, "Playback has stopped."},
+	StatusCodeNetStreamPlayStreamNotFound:          {StatusLevelError, "The stream could not be found."},
+	StatusCodeNetStreamPlaySwitch:                  {StatusLevelStatus, "The subscriber is switching from one stream to another in a playlist."},
+	StatusCodeNetStreamPlayTransition:              {StatusLevelStatus, "The stream is transitioning to another stream."},
+	StatusCodeNetStreamPlayTransitionComplete:      {StatusLevelStatus, "The transition to another stream has completed."},
+	StatusCodeNetStreamPlayUnpublishNotify:         {StatusLevelStatus, "An unpublish from a stream is sent to all subscribers."},
+	StatusCodeNetStreamPublishBadName:              {StatusLevelError, "The stream is already being published or its name is not allowed."},
+	StatusCodeNetStreamPublishFailed:               {StatusLevelError, "The publish attempt failed."},
+	StatusCodeNetStreamPublishIdle:                 {StatusLevelStatus, "The publisher of the stream has been idle for too long."},
+	StatusCodeNetStreamPublishStart:                {StatusLevelStatus, "Publishing has started."},
+	StatusCodeNetStreamRecordAlreadyExists:         {StatusLevelStatus, "The stream being recorded maps to a file that is already being recorded."},
+	StatusCodeNetStreamRecordDiskQuotaExceeded:     {StatusLevelError, "The disk quota for recording has been exceeded."},
+	StatusCodeNetStreamRecordFailed:                {StatusLevelError, "An attempt to record a stream failed."},
+	StatusCodeNetStreamRecordNoAccess:              {StatusLevelError, "The stream may not be recorded."},
+	StatusCodeNetStreamRecordStart:                 {StatusLevelStatus, "Recording has started."},
+	StatusCodeNetStreamRecordStop:                  {StatusLevelStatus, "Recording has stopped."},
+	StatusCodeNetStreamSeekFailed:                  {StatusLevelError, "The seek failed."},
+	StatusCodeNetStreamSeekInvalidTime:             {StatusLevelError, "The seek time is outside the available data."},
+	StatusCodeNetStreamSeekNotify:                  {StatusLevelStatus, "The seek operation is complete."},
+	StatusCodeNetStreamStepNotify:                  {StatusLevelStatus, "The step operation is complete."},
+	StatusCodeNetStreamUnpauseNotify:               {StatusLevelStatus, "The stream is resumed."},
+	StatusCodeNetStreamUnpublishSuccess:            {StatusLevelStatus, "The unpublish operation was successful."},
+	StatusCodeNetStreamVideoDimensionChange:        {StatusLevelStatus, "The video dimensions are available or have changed."},
+	StatusCodeSharedObjectBadPersistence:           {StatusLevelError, "A request was made for a shared object with persistence flags that do not match."},
+	StatusCodeSharedObjectFlushFailed:              {StatusLevelError, "The pending status was resolved, but the flush failed."},
+	StatusCodeSharedObjectFlushSuccess:             {StatusLevelStatus, "The pending status was resolved and the flush succeeded."},
+	StatusCodeSharedObjectURIMismatch:              {StatusLevelError, "The shared object was used with a different connection URI."},
+}
+
+// Level returns the level the code is sent with. Codes missing from the
+// catalogue are guessed from their last part, e.g. "Failed" is an error.
+func (c StatusCode) Level() StatusLevel {
+	if info, ok := statusCodes[c]; ok {
+		return info.level
+	}
+	last := string(c)
+	if i := strings.LastIndex(last, "."); i >= 0 {
+		last = last[i+1:]
+	}
+	switch last {
+	case "Failed", "Rejected", "BadName", "BadVersion", "Prohibited", "InvalidApp", "NotFound", "StreamNotFound", "NoAccess":
+		return StatusLevelError
+	}
+	return StatusLevelStatus
+}
+
+// Description returns the default description of the code.
+func (c StatusCode) Description() string {
+	return statusCodes[c].description
+}
+
+// Status is a typed info object.
+type Status struct {
+	Level       StatusLevel
+	Code        StatusCode
+	Description string
+	Details     string
+	ClientID    string
+	// Properties holds the other properties of the info object, such as
+	// objectEncoding of a connect result.
+	Properties map[string]interface{}
+}
+
+// statusInfoObject holds the properties of an info object that Status has
+// fields for.
+type statusInfoObject struct {
+	Level       StatusLevel `amf:"level"`
+	Code        StatusCode  `amf:"code"`
+	Description string      `amf:"description,omitempty"`
+	Details     string      `amf:"details,omitempty"`
+	// ClientID is a string or, from some servers, a number.
+	ClientID interface{} `amf:"clientid,omitempty"`
+}
+
+// NewStatus returns the status for code with its level and default
+// description.
+func NewStatus(code StatusCode) Status {
+	return Status{
+		Level:       code.Level(),
+		Code:        code,
+		Description: code.Description(),
+	}
+}
+
+func (s Status) WithDescription(description string) Status {
+	s.Description = description
+	return s
+}
+
+// WithDetails sets details, usually the stream name the status is about.
+func (s Status) WithDetails(details string) Status {
+	s.Details = details
+	return s
+}
+
+func (s Status) WithClientID(clientID string) Status {
+	s.ClientID = clientID
+	return s
+}
+
+// With adds a property to the info object.
+func (s Status) With(name string, value interface{}) Status {
+	properties := make(map[string]interface{}, len(s.Properties)+1)
+	for k, v := range s.Properties {
+		properties[k] = v
+	}
+	properties[name] = value
+	s.Properties = properties
+	return s
+}
+
+// InfoObject returns the info object to send, leaving out empty fields.
+func (s Status) InfoObject() map[string]interface{} {
+	info := statusInfoObject{
+		Level:       s.Level,
+		Code:        s.Code,
+		Description: s.Description,
+		Details:     s.Details,
+	}
+	if s.ClientID != "" {
+		info.ClientID = s.ClientID
+	}
+	o, err := marshalObject(info)
+	if err != nil {
+		// strings only, which always marshal
+		panic(err)
+	}
+	for k, v := range s.Properties {
+		if _, ok := o[k]; !ok {
+			o[k] = v
+		}
+	}
+	return o
+}
+
+// IsError reports whether the level is error.
+func (s Status) IsError() bool {
+	return s.Level == StatusLevelError
+}
+
+// Err returns the status as an error if its level is error, and nil
+// otherwise.
+func (s Status) Err() error {
+	if !s.IsError() {
+		return nil
+	}
+	return &StatusError{Status: s}
+}
+
+// StatusError is an info object of level error received from the peer.
+type StatusError struct {
+	Status Status
+}
+
+func (e *StatusError) Error() string {
+	if e.Status.Description == "" {
+		return string(e.Status.Code)
+	}
+	return fmt.Sprintf("%s: %s", e.Status.Code, e.Status.Description)
+}
+
+// ParseStatus reads an info object. Missing levels are taken from the
+// catalogue, while a known property of the wrong type is an error.
+func ParseStatus(infoObject map[string]interface{}) (Status, error) {
+	var info statusInfoObject
+	if err := unmarshalObject(infoObject, &info); err != nil {
+		return Status{}, errors.Wrap(err, "failed to read info object")
+	}
+	s := Status{
+		Code:        info.Code,
+		Level:       info.Level,
+		Description: info.Description,
+		Details:     info.Details,
+	}
+	if s.Level == "" {
+		s.Level = s.Code.Level()
+	}
+	switch v := info.ClientID.(type) {
+	case string:
+		s.ClientID = v
+	case float64:
+		s.ClientID = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for k, v := range infoObject {
+		switch k {
+		case "code", "level", "description", "details", "clientid":
+			continue
+		}
+		if s.Properties == nil {
+			s.Properties = map[string]interface{}{}
+		}
+		s.Properties[k] = v
+	}
+	return s, nil
+}
+
+// ParseOnStatus reads the info object of an onStatus command.
+func ParseOnStatus(onStatus OnStatus) (Status, error) {
+	return ParseStatus(onStatus.InfoObject())
+}
@@ -0,0 +1,49 @@
+package rtmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	s := NewStatus(StatusCodeNetStreamPlayStart).
+		WithDetails("live/stream").
+		WithClientID("1234").
+		With("isFastPlay", false)
+	assert.Equal(t, map[string]interface{}{
+		"level":       "status",
+		"code":        "NetStream.Play.Start",
+		"description": "Playback has started.",
+		"details":     "live/stream",
+		"clientid":    "1234",
+		"isFastPlay":  false,
+	}, s.InfoObject())
+	assert.Nil(t, s.Err())
+
+	parsed, err := ParseOnStatus(NewOnStatus(s.InfoObject(), EncodingAMFTypeAMF0))
+	assert.NoError(t, err)
+	assert.Equal(t, s, parsed)
+
+	rejected := NewStatus(StatusCodeNetConnectionConnectRejected).WithDescription("denied")
+	assert.True(t, rejected.IsError())
+	assert.EqualError(t, rejected.Err(), "NetConnection.Connect.Rejected: denied")
+}
+
+func TestParseStatus(t *testing.T) {
+	s, err := ParseStatus(map[string]interface{}{
+		"code":     "NetStream.Publish.BadName",
+		"clientid": float64(42),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCodeNetStreamPublishBadName, s.Code)
+	assert.Equal(t, StatusLevelError, s.Level)
+	assert.Equal(t, "42", s.ClientID)
+	assert.Nil(t, s.Properties)
+
+	_, err = ParseStatus(map[string]interface{}{"code": float64(1)})
+	assert.Error(t, err)
+
+	assert.Equal(t, StatusLevelError, StatusCode("Custom.Thing.Failed").Level())
+	assert.Equal(t, StatusLevelStatus, StatusCode("Custom.Thing.Done").Level())
+}
@@ -0,0 +1,327 @@
+package rtmp
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// VideoCodec is read from a video sequence header.
+type VideoCodec struct {
+	Codec   string `json:"codec,omitempty"`
+	Profile string `json:"profile,omitempty"`
+	Level   string `json:"level,omitempty"`
+	Width   int    `json:"width,omitempty"`
+	Height  int    `json:"height,omitempty"`
+}
+
+// AudioCodec is read from an audio message, and for AAC from its sequence
+// header.
+type AudioCodec struct {
+	Codec      string `json:"codec,omitempty"`
+	Profile    string `json:"profile,omitempty"`
+	SampleRate int    `json:"sampleRate,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+}
+
+var videoCodecNames = map[byte]string{
+	2:  "H263",
+	3:  "ScreenVideo",
+	4:  "VP6",
+	5:  "VP6Alpha",
+	6:  "ScreenVideo2",
+	7:  "H264",
+	12: "HEVC",
+}
+
+var videoFourCCNames = map[string]string{
+	"avc1": "H264",
+	"hvc1": "HEVC",
+	"av01": "AV1",
+	"vp09": "VP9",
+}
+
+var audioCodecNames = map[byte]string{
+	0:  "LinearPCM",
+	1:  "ADPCM",
+	2:  "MP3",
+	3:  "LinearPCMLE",
+	4:  "Nellymoser",
+	5:  "Nellymoser",
+	6:  "Nellymoser",
+	7:  "G711A",
+	8:  "G711U",
+	10: "AAC",
+	11: "Speex",
+	14: "MP3",
+	15: "DeviceSpecific",
+}
+
+var audioFourCCNames = map[string]string{
+	"Opus": "Opus",
+	"fLaC": "FLAC",
+	"ac-3": "AC3",
+	"ec-3": "EAC3",
+	"mp4a": "AAC",
+	".mp3": "MP3",
+}
+
+var avcProfileNames = map[byte]string{
+	66:  "Baseline",
+	77:  "Main",
+	88:  "Extended",
+	100: "High",
+	110: "High 10",
+	122: "High 4:2:2",
+	244: "High 4:4:4",
+}
+
+var aacProfileNames = map[byte]string{
+	1:  "Main",
+	2:  "LC",
+	3:  "SSR",
+	4:  "LTP",
+	5:  "HE-AAC",
+	29: "HE-AACv2",
+}
+
+var aacSampleRates = []int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// parseVideoSequenceHeader reads the codec of a video sequence header, and
+// for H.264 the profile, level and resolution from its first SPS.
+func parseVideoSequenceHeader(p []byte) VideoCodec {
+	v := VideoCodec{Codec: videoCodecName(p)}
+	if len(p) > 5 && p[0]&0x80 == 0 && p[0]&0x0f == 7 {
+		if sps, err := firstSPS(p[5:]); err == nil {
+			v.Profile, v.Level, v.Width, v.Height, _ = parseSPS(sps)
+		}
+	}
+	return v
+}
+
+// videoCodecName reads the codec of any video message.
+func videoCodecName(p []byte) string {
+	if len(p) == 0 {
+		return ""
+	}
+	if p[0]&0x80 != 0 {
+		if len(p) < 5 {
+			return ""
+		}
+		fourCC := string(p[1:5])
+		if name, ok := videoFourCCNames[fourCC]; ok {
+			return name
+		}
+		return fourCC
+	}
+	return videoCodecNames[p[0]&0x0f]
+}
+
+// parseAudioHeader reads the codec of any audio message; AAC details need
+// the sequence header.
+func parseAudioHeader(p []byte) AudioCodec {
+	if len(p) == 0 {
+		return AudioCodec{}
+	}
+	format := p[0] >> 4
+	if format == 9 {
+		// enhanced RTMP: ExHeader with a FourCC
+		if len(p) < 5 {
+			return AudioCodec{}
+		}
+		fourCC := string(p[1:5])
+		a := AudioCodec{Codec: fourCC}
+		if name, ok := audioFourCCNames[fourCC]; ok {
+			a.Codec = name
+		}
+		return a
+	}
+	a := AudioCodec{
+		Codec:      audioCodecNames[format],
+		SampleRate: []int{5512, 11025, 22050, 44100}[(p[0]>>2)&0x3],
+		Channels:   int(p[0]&0x1) + 1,
+	}
+	if format == 10 && len(p) > 3 && p[1] == 0 {
+		// AudioSpecificConfig
+		objectType := p[2] >> 3
+		a.Profile = aacProfileNames[objectType]
+		if i := int((p[2]&0x7)<<1 | p[3]>>7); i < len(aacSampleRates) {
+			a.SampleRate = aacSampleRates[i]
+		}
+		if channels := int((p[3] >> 3) & 0xf); channels > 0 {
+			a.Channels = channels
+		}
+	}
+	return a
+}
+
+func isAudioSequenceHeader(p []byte) bool {
+	return len(p) > 1 && p[0]>>4 == 10 && p[1] == 0
+}
+
+// firstSPS returns the first SPS of an AVCDecoderConfigurationRecord.
+func firstSPS(record []byte) ([]byte, error) {
+	if len(record) < 8 || record[5]&0x1f == 0 {
+		return nil, errors.New("no SPS")
+	}
+	n := int(record[6])<<8 | int(record[7])
+	if len(record) < 8+n {
+		return nil, errors.New("short SPS")
+	}
+	return record[8 : 8+n], nil
+}
+
+// parseSPS reads a H.264 sequence parameter set NAL unit.
+func parseSPS(nal []byte) (profile string, level string, width int, height int, err error) {
+	if len(nal) < 4 {
+		return "", "", 0, 0, errors.New("short SPS")
+	}
+	r := &bitReader{b: unescapeRBSP(nal[1:])}
+	profileIdc := r.bits(8)
+	r.bits(8) // constraint flags
+	levelIdc := r.bits(8)
+	profile = avcProfileNames[byte(profileIdc)]
+	if profile == "" {
+		profile = fmt.Sprint(profileIdc)
+	}
+	level = fmt.Sprintf("%d.%d", levelIdc/10, levelIdc%10)
+
+	r.ue() // seq_parameter_set_id
+	chromaFormatIdc := uint32(1)
+	separateColourPlane := false
+	switch profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormatIdc = r.ue()
+		if chromaFormatIdc == 3 {
+			separateColourPlane = r.bits(1) == 1
+		}
+		r.ue()    // bit_depth_luma_minus8
+		r.ue()    // bit_depth_chroma_minus8
+		r.bits(1) // qpprime_y_zero_transform_bypass_flag
+		if r.bits(1) == 1 {
+			lists := 8
+			if chromaFormatIdc == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if r.bits(1) == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := int32(8), int32(8)
+				for j := 0; j < size; j++ {
+					if next != 0 {
+						next = (last + r.se() + 256) % 256
+					}
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+	r.ue() // log2_max_frame_num_minus4
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bits(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+		for n := r.ue(); n > 0 && r.err == nil; n-- {
+			r.se()
+		}
+	}
+	r.ue()    // max_num_ref_frames
+	r.bits(1) // gaps_in_frame_num_value_allowed_flag
+	widthInMbs := r.ue() + 1
+	heightInMapUnits := r.ue() + 1
+	frameMbsOnly := r.bits(1)
+	if frameMbsOnly == 0 {
+		r.bits(1) // mb_adaptive_frame_field_flag
+	}
+	r.bits(1) // direct_8x8_inference_flag
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	if r.bits(1) == 1 {
+		cropLeft, cropRight, cropTop, cropBottom = r.ue(), r.ue(), r.ue(), r.ue()
+	}
+	if r.err != nil {
+		return profile, level, 0, 0, r.err
+	}
+
+	cropUnitX, cropUnitY := uint32(1), 2-frameMbsOnly
+	if chromaFormatIdc != 0 && !separateColourPlane {
+		if chromaFormatIdc < 3 {
+			cropUnitX = 2
+		}
+		if chromaFormatIdc == 1 {
+			cropUnitY *= 2
+		}
+	}
+	width = int(widthInMbs*16 - (cropLeft+cropRight)*cropUnitX)
+	height = int((2-frameMbsOnly)*heightInMapUnits*16 - (cropTop+cropBottom)*cropUnitY)
+	return profile, level, width, height, nil
+}
+
+// unescapeRBSP removes the emulation prevention bytes of a NAL unit.
+func unescapeRBSP(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+type bitReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *bitReader) bits(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		if r.pos >= len(r.b)*8 {
+			r.err = errors.New("short bitstream")
+			return 0
+		}
+		v = v<<1 | uint32(r.b[r.pos/8]>>(7-r.pos%8))&1
+		r.pos++
+	}
+	return v
+}
+
+// ue reads an unsigned Exp-Golomb code.
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.bits(1) == 0 {
+		if r.err != nil || zeros >= 32 {
+			r.err = errors.New("invalid Exp-Golomb code")
+			return 0
+		}
+		zeros++
+	}
+	return (1<<uint(zeros) - 1) + r.bits(zeros)
+}
+
+// se reads a signed Exp-Golomb code.
+func (r *bitReader) se() int32 {
+	v := r.ue()
+	if v%2 == 1 {
+		return int32(v/2 + 1)
+	}
+	return -int32(v / 2)
+}
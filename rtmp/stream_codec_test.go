@@ -0,0 +1,27 @@
+package rtmp
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVideoSequenceHeader(t *testing.T) {
+	sps, _ := hex.DecodeString("6764002aacd940780227e5c044000003000400000300783c60c658")
+	record := append([]byte{0x01, 0x64, 0x00, 0x2a, 0xff, 0xe1, 0x00, byte(len(sps))}, sps...)
+	p := append([]byte{0x17, 0x00, 0, 0, 0}, record...)
+	assert.Equal(t, VideoCodec{Codec: "H264", Profile: "High", Level: "4.2", Width: 1920, Height: 1080}, parseVideoSequenceHeader(p))
+
+	assert.Equal(t, VideoCodec{Codec: "HEVC"}, parseVideoSequenceHeader([]byte{0x1c, 0x00, 0, 0, 0}))
+	assert.Equal(t, VideoCodec{Codec: "AV1"}, parseVideoSequenceHeader([]byte{0x90, 'a', 'v', '0', '1'}))
+	assert.Equal(t, VideoCodec{}, parseVideoSequenceHeader(nil))
+}
+
+func TestParseAudioHeader(t *testing.T) {
+	// AAC LC, 48kHz, stereo
+	assert.Equal(t, AudioCodec{Codec: "AAC", Profile: "LC", SampleRate: 48000, Channels: 2}, parseAudioHeader([]byte{0xaf, 0x00, 0x11, 0x90}))
+	assert.Equal(t, AudioCodec{Codec: "AAC", SampleRate: 44100, Channels: 2}, parseAudioHeader([]byte{0xaf, 0x01}))
+	assert.Equal(t, AudioCodec{Codec: "MP3", SampleRate: 22050, Channels: 1}, parseAudioHeader([]byte{0x28}))
+	assert.Equal(t, AudioCodec{Codec: "Opus"}, parseAudioHeader([]byte{0x90, 'O', 'p', 'u', 's'}))
+}
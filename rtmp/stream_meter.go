@@ -0,0 +1,340 @@
+package rtmp
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// streamSampleInterval is how long a streamMeter measures a sample.
+const streamSampleInterval = time.Second
+
+// StreamStats is the health of a publishing stream. Rates are measured over
+// the last second. In JSON, the durations are milliseconds named with an Ms
+// suffix, e.g. jitterMs.
+type StreamStats struct {
+	Path   string `json:"path"`
+	App    string `json:"app"`
+	Name   string `json:"name"`
+	ConnID uint64 `json:"connId"`
+	// Since is when the first media message arrived, zero before.
+	Since time.Time `json:"since"`
+
+	Video        VideoCodec `json:"video"`
+	VideoBitrate float64    `json:"videoBitrate"`
+	FPS          float64    `json:"fps"`
+	// GOP is the number of video frames from the last keyframe to the one
+	// before it, and KeyframeInterval their timestamp distance.
+	GOP              int           `json:"gop"`
+	KeyframeInterval time.Duration `json:"-"`
+
+	Audio        AudioCodec `json:"audio"`
+	AudioBitrate float64    `json:"audioBitrate"`
+
+	BytesIn uint64 `json:"bytesIn"`
+	// Jitter estimates how much message arrival deviates from the
+	// timestamps, like the interarrival jitter of RFC 3550.
+	Jitter time.Duration `json:"-"`
+	// AVDrift is the timestamp of the last audio message minus that of the
+	// last video message.
+	AVDrift time.Duration `json:"-"`
+
+	Subscribers int `json:"subscribers"`
+}
+
+type streamStatsJSON struct {
+	streamStats
+	KeyframeIntervalMs float64 `json:"keyframeIntervalMs"`
+	JitterMs           float64 `json:"jitterMs"`
+	AVDriftMs          float64 `json:"avDriftMs"`
+}
+
+// streamStats has the fields of StreamStats without its JSON methods.
+type streamStats StreamStats
+
+func (s StreamStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(streamStatsJSON{
+		streamStats:        streamStats(s),
+		KeyframeIntervalMs: durationToMs(s.KeyframeInterval),
+		JitterMs:           durationToMs(s.Jitter),
+		AVDriftMs:          durationToMs(s.AVDrift),
+	})
+}
+
+func (s *StreamStats) UnmarshalJSON(b []byte) error {
+	var v streamStatsJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = StreamStats(v.streamStats)
+	s.KeyframeInterval = msToDuration(v.KeyframeIntervalMs)
+	s.Jitter = msToDuration(v.JitterMs)
+	s.AVDrift = msToDuration(v.AVDriftMs)
+	return nil
+}
+
+func durationToMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func msToDuration(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// streamMeter measures the media of a publishing stream.
+type streamMeter struct {
+	path string
+
+	since  time.Time
+	video  VideoCodec
+	audio  AudioCodec
+	total  uint64
+	jitter float64 // milliseconds
+
+	windowStart time.Time
+	audioBytes  uint64
+	videoBytes  uint64
+	videoFrames uint64
+	last        StreamSample
+	audioRate   float64
+	videoRate   float64
+
+	lastKeyframe     uint32
+	hasKeyframe      bool
+	framesSinceKey   int
+	gop              int
+	keyframeInterval time.Duration
+
+	lastArrival   time.Time
+	lastTimestamp uint32
+	lastAudio     uint32
+	lastVideo     uint32
+	hasAudio      bool
+	hasVideo      bool
+}
+
+// observe adds m and returns a sample when the interval is over.
+func (s *streamMeter) observe(now time.Time, m Message) (StreamSample, bool) {
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+		s.since = now
+	}
+	p := m.Payload()
+	s.total += uint64(len(p))
+	s.updateJitter(now, m.Timestamp())
+
+	switch m.TypeID() {
+	case MessageTypeIDAudio:
+		s.audioBytes += uint64(len(p))
+		if !s.hasAudio || isAudioSequenceHeader(p) {
+			s.audio = parseAudioHeader(p)
+		}
+		s.lastAudio = m.Timestamp()
+		s.hasAudio = true
+	case MessageTypeIDVideo:
+		s.videoBytes += uint64(len(p))
+		s.lastVideo = m.Timestamp()
+		s.hasVideo = true
+		if isVideoSequenceHeader(p) {
+			s.video = parseVideoSequenceHeader(p)
+			break
+		}
+		if s.video.Codec == "" {
+			s.video.Codec = videoCodecName(p)
+		}
+		s.videoFrames++
+		s.framesSinceKey++
+		if isVideoKeyframe(p) {
+			if s.hasKeyframe {
+				if d := TimestampDiff(m.Timestamp(), s.lastKeyframe); d > 0 {
+					s.keyframeInterval = time.Duration(d) * time.Millisecond
+				}
+				s.gop = s.framesSinceKey - 1
+			}
+			s.lastKeyframe = m.Timestamp()
+			s.hasKeyframe = true
+			s.framesSinceKey = 1
+		}
+	}
+
+	return s.sample(now)
+}
+
+// sample returns a sample when the interval is over, also when no message
+// arrived in it.
+func (s *streamMeter) sample(now time.Time) (StreamSample, bool) {
+	elapsed := now.Sub(s.windowStart)
+	if s.windowStart.IsZero() || elapsed < streamSampleInterval {
+		return StreamSample{}, false
+	}
+	s.audioRate, s.videoRate, s.last.FPS = s.rates(now)
+	s.last.Bitrate = s.audioRate + s.videoRate
+	s.last.KeyframeInterval = s.keyframeInterval
+	s.windowStart = now
+	s.audioBytes = 0
+	s.videoBytes = 0
+	s.videoFrames = 0
+	return s.last, true
+}
+
+// rates measures the current window, zero when nothing arrived for an
+// interval.
+func (s *streamMeter) rates(now time.Time) (audioRate, videoRate, fps float64) {
+	if now.Sub(s.lastArrival) >= streamSampleInterval {
+		return 0, 0, 0
+	}
+	elapsed := now.Sub(s.windowStart)
+	return float64(s.audioBytes*8) / elapsed.Seconds(),
+		float64(s.videoBytes*8) / elapsed.Seconds(),
+		float64(s.videoFrames) / elapsed.Seconds()
+}
+
+func (s *streamMeter) updateJitter(now time.Time, timestamp uint32) {
+	if !s.lastArrival.IsZero() {
+		d := durationToMs(now.Sub(s.lastArrival)) - float64(TimestampDiff(timestamp, s.lastTimestamp))
+		if d < 0 {
+			d = -d
+		}
+		s.jitter += (d - s.jitter) / 16
+	}
+	s.lastArrival = now
+	s.lastTimestamp = timestamp
+}
+
+func (s *streamMeter) stats(now time.Time) StreamStats {
+	audioRate, videoRate, fps := s.audioRate, s.videoRate, s.last.FPS
+	if now.Sub(s.windowStart) >= streamSampleInterval {
+		// no message ended the window, so the publisher stalls
+		audioRate, videoRate, fps = s.rates(now)
+	}
+	st := StreamStats{
+		Path:             s.path,
+		Since:            s.since,
+		Video:            s.video,
+		VideoBitrate:     videoRate,
+		FPS:              fps,
+		GOP:              s.gop,
+		KeyframeInterval: s.keyframeInterval,
+		Audio:            s.audio,
+		AudioBitrate:     audioRate,
+		BytesIn:          s.total,
+		Jitter:           msToDuration(s.jitter),
+	}
+	if s.hasAudio && s.hasVideo {
+		st.AVDrift = time.Duration(TimestampDiff(s.lastAudio, s.lastVideo)) * time.Millisecond
+	}
+	return st
+}
+
+// isVideoKeyframe reads the frame type of a FLV video tag body, legacy or
+// enhanced.
+func isVideoKeyframe(p []byte) bool {
+	return len(p) > 0 && (p[0]>>4)&0x7 == 1
+}
+
+func isVideoSequenceHeader(p []byte) bool {
+	if len(p) == 0 {
+		return false
+	}
+	if p[0]&0x80 != 0 {
+		// enhanced RTMP: PacketTypeSequenceStart
+		return p[0]&0x0f == 0
+	}
+	codecID := p[0] & 0x0f
+	// AVC and HEVC carry an AVCPacketType
+	return (codecID == 7 || codecID == 12) && len(p) > 1 && p[1] == 0
+}
+
+// streamMeters are the meters of the publishing streams of a conn, by
+// message stream ID.
+type streamMeters struct {
+	mu     sync.Mutex
+	meters map[uint32]*streamMeter
+}
+
+// meterMedia feeds an audio or video message to the meter of its stream.
+func (conn *defaultConn) meterMedia(m Message) {
+	stream, ok := conn.messageStreams.Get(m.StreamID())
+	if !ok || stream.State != MessageStreamStatePublishing {
+		return
+	}
+	path := StreamPath(conn.ConnectParams().App, stream.Name)
+	conn.meters.mu.Lock()
+	if conn.meters.meters == nil {
+		conn.meters.meters = map[uint32]*streamMeter{}
+	}
+	meter := conn.meters.meters[stream.ID]
+	if meter == nil || meter.path != path {
+		meter = &streamMeter{path: path}
+		conn.meters.meters[stream.ID] = meter
+	}
+	sample, ok := meter.observe(time.Now(), m)
+	conn.meters.mu.Unlock()
+	if ok && conn.metrics != nil {
+		conn.metrics.StreamSample(path, sample)
+	}
+}
+
+// sampleStreams reports the samples of publishing streams which receive
+// no media, which observe does not sample.
+func (conn *defaultConn) sampleStreams(ctx context.Context) {
+	ticker := time.NewTicker(streamSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			type pathSample struct {
+				path   string
+				sample StreamSample
+			}
+			var samples []pathSample
+			conn.meters.mu.Lock()
+			for _, meter := range conn.meters.meters {
+				if sample, ok := meter.sample(now); ok {
+					samples = append(samples, pathSample{meter.path, sample})
+				}
+			}
+			conn.meters.mu.Unlock()
+			for _, s := range samples {
+				conn.metrics.StreamSample(s.path, s.sample)
+			}
+		}
+	}
+}
+
+// endStreamMeter drops the meter of a stream which is done.
+func (conn *defaultConn) endStreamMeter(stream MessageStream) {
+	conn.meters.mu.Lock()
+	meter, ok := conn.meters.meters[stream.ID]
+	delete(conn.meters.meters, stream.ID)
+	conn.meters.mu.Unlock()
+	if ok && conn.metrics != nil {
+		conn.metrics.StreamEnded(meter.path)
+	}
+}
+
+// publishingStats returns the stats of the publishing streams of conn,
+// without ConnID and Subscribers.
+func (conn *defaultConn) publishingStats() []StreamStats {
+	app := conn.ConnectParams().App
+	var l []StreamStats
+	for _, stream := range conn.messageStreams.List() {
+		if stream.State != MessageStreamStatePublishing {
+			continue
+		}
+		path := StreamPath(app, stream.Name)
+		st := StreamStats{Path: path}
+		conn.meters.mu.Lock()
+		if meter, ok := conn.meters.meters[stream.ID]; ok && meter.path == path {
+			st = meter.stats(time.Now())
+		}
+		conn.meters.mu.Unlock()
+		st.App = app
+		st.Name = path[len(app)+1:]
+		l = append(l, st)
+	}
+	return l
+}
@@ -0,0 +1,92 @@
+package rtmp
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamMeter(t *testing.T) {
+	start := time.Unix(0, 0)
+	m := &streamMeter{path: "live/room"}
+
+	frames := []struct {
+		typeID    MessageTypeID
+		timestamp uint32
+		payload   []byte
+	}{
+		{MessageTypeIDVideo, 0, []byte{0x17, 0x00, 0, 0, 0}}, // AVC sequence header
+		{MessageTypeIDVideo, 0, []byte{0x17, 0x01, 0, 0, 0}},
+		{MessageTypeIDAudio, 10, []byte{0xaf, 0x01, 0, 0, 0}},
+		{MessageTypeIDVideo, 500, []byte{0x27, 0x01, 0, 0, 0}},
+		{MessageTypeIDVideo, 2000, []byte{0x17, 0x01, 0, 0, 0}},
+	}
+	for i, f := range frames {
+		_, ok := m.observe(start.Add(time.Duration(i)*100*time.Millisecond), NewMessage(6, f.typeID, f.timestamp, 1, f.payload))
+		assert.False(t, ok)
+	}
+	sample, ok := m.observe(start.Add(2*time.Second), NewMessage(6, MessageTypeIDAudio, 2010, 1, []byte{0xaf, 0x01, 0, 0, 0}))
+	if assert.True(t, ok) {
+		assert.Equal(t, float64(6*5*8)/2, sample.Bitrate)
+		assert.Equal(t, float64(3)/2, sample.FPS)
+		assert.Equal(t, 2*time.Second, sample.KeyframeInterval)
+	}
+
+	st := m.stats(start.Add(2 * time.Second))
+	assert.Equal(t, "live/room", st.Path)
+	assert.Equal(t, start, st.Since)
+	assert.Equal(t, "H264", st.Video.Codec)
+	assert.Equal(t, "AAC", st.Audio.Codec)
+	assert.Equal(t, 2, st.GOP)
+	assert.Equal(t, float64(2*5*8)/2, st.AudioBitrate)
+	assert.Equal(t, uint64(6*5), st.BytesIn)
+	assert.Equal(t, 10*time.Millisecond, st.AVDrift)
+	assert.NotZero(t, st.Jitter)
+}
+
+func TestStreamMeterStalled(t *testing.T) {
+	start := time.Unix(0, 0)
+	m := &streamMeter{path: "live/room"}
+	for i := 0; i < 10; i++ {
+		m.observe(start.Add(time.Duration(i)*100*time.Millisecond), NewMessage(6, MessageTypeIDVideo, uint32(i*100), 1, []byte{0x27, 0x01, 0, 0, 0}))
+	}
+	st := m.stats(start.Add(time.Second))
+	assert.Equal(t, float64(10), st.FPS)
+	assert.NotZero(t, st.VideoBitrate)
+
+	// nothing arrives any more
+	st = m.stats(start.Add(3 * time.Second))
+	assert.Zero(t, st.FPS)
+	assert.Zero(t, st.VideoBitrate)
+	sample, ok := m.sample(start.Add(3 * time.Second))
+	if assert.True(t, ok) {
+		assert.Zero(t, sample.Bitrate)
+		assert.Zero(t, sample.FPS)
+	}
+}
+
+func TestStreamStatsJSON(t *testing.T) {
+	st := StreamStats{
+		Path:             "live/room",
+		KeyframeInterval: 2 * time.Second,
+		Jitter:           1500 * time.Microsecond,
+		AVDrift:          -10 * time.Millisecond,
+	}
+	b, err := json.Marshal(st)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var m map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, "live/room", m["path"])
+	assert.Equal(t, float64(2000), m["keyframeIntervalMs"])
+	assert.Equal(t, 1.5, m["jitterMs"])
+	assert.Equal(t, float64(-10), m["avDriftMs"])
+	assert.NotContains(t, m, "jitter")
+
+	var got StreamStats
+	assert.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, st, got)
+}
@@ -0,0 +1,438 @@
+package rtmp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// StreamHandler serves the connects, publishes and plays routed to it by a
+// StreamMux. A nil error info accepts the request.
+type StreamHandler interface {
+	ServeConnect(ctx context.Context, conn Conn, connect Connect) ConnectError
+	ServePublish(ctx context.Context, conn Conn, publish Publish) (errorInfo map[string]interface{})
+	ServePlay(ctx context.Context, conn Conn, play Play) (errorInfo map[string]interface{})
+}
+
+// StreamDoneHandler is implemented by StreamHandlers told when a publish or
+// play they accepted stops.
+type StreamDoneHandler interface {
+	ServeStreamDone(ctx context.Context, conn Conn, stream MessageStream)
+}
+
+// StreamMessageHandler is implemented by StreamHandlers serving the audio,
+// video and data messages of the streams published through them. m is
+// released when ServeMessage returns.
+type StreamMessageHandler interface {
+	ServeMessage(ctx context.Context, conn Conn, stream MessageStream, m Message) ConnError
+}
+
+// StreamHandlerFuncs is a StreamHandler, StreamDoneHandler and
+// StreamMessageHandler built from funcs. Nil funcs accept the request or
+// ignore the call.
+type StreamHandlerFuncs struct {
+	Connect func(ctx context.Context, conn Conn, connect Connect) ConnectError
+	Publish func(ctx context.Context, conn Conn, publish Publish) (errorInfo map[string]interface{})
+	Play    func(ctx context.Context, conn Conn, play Play) (errorInfo map[string]interface{})
+	Done    func(ctx context.Context, conn Conn, stream MessageStream)
+	Message func(ctx context.Context, conn Conn, stream MessageStream, m Message) ConnError
+}
+
+func (h StreamHandlerFuncs) ServeConnect(ctx context.Context, conn Conn, connect Connect) ConnectError {
+	if h.Connect == nil {
+		return nil
+	}
+	return h.Connect(ctx, conn, connect)
+}
+
+func (h StreamHandlerFuncs) ServePublish(ctx context.Context, conn Conn, publish Publish) map[string]interface{} {
+	if h.Publish == nil {
+		return nil
+	}
+	return h.Publish(ctx, conn, publish)
+}
+
+func (h StreamHandlerFuncs) ServePlay(ctx context.Context, conn Conn, play Play) map[string]interface{} {
+	if h.Play == nil {
+		return nil
+	}
+	return h.Play(ctx, conn, play)
+}
+
+func (h StreamHandlerFuncs) ServeStreamDone(ctx context.Context, conn Conn, stream MessageStream) {
+	if h.Done != nil {
+		h.Done(ctx, conn, stream)
+	}
+}
+
+func (h StreamHandlerFuncs) ServeMessage(ctx context.Context, conn Conn, stream MessageStream, m Message) ConnError {
+	if h.Message == nil {
+		return nil
+	}
+	return h.Message(ctx, conn, stream, m)
+}
+
+// StreamMux routes connect by app and publish and play by stream path to
+// StreamHandlers, like http.ServeMux routes requests by path.
+//
+// The stream path is the app and the stream name without its query, e.g.
+// "live/room" for publishing "room?token=x" on app "live". Stream patterns
+// are slash separated segments:
+//
+//	live/room      matches the path exactly
+//	live/*         matches live/room and live/a/b; "*" must be the last segment
+//	vod/{name}.flv matches vod/movie.flv with name "movie"
+//
+// When several patterns match, the one with the most literal characters
+// wins, and a pattern without "*" wins a tie. A publish or play matching no
+// pattern is served by the handler of its app. The end of a publish or play
+// and the messages of a publish go to the handler of the stream path the
+// stream was accepted with, when it implements StreamDoneHandler or
+// StreamMessageHandler. A connect to an app without
+// an app handler is served by the handlers of the stream patterns under the
+// app, which must all accept it. Connects to an app with neither are
+// rejected with NetConnection.Connect.InvalidApp, and publishes and plays
+// without a handler with NetStream.Publish.BadName and
+// NetStream.Play.StreamNotFound.
+type StreamMux struct {
+	mu       sync.RWMutex
+	apps     map[string]StreamHandler
+	patterns []*streamPattern
+}
+
+func NewStreamMux() *StreamMux {
+	return &StreamMux{
+		apps: map[string]StreamHandler{},
+	}
+}
+
+// HandleApp registers the handler for connects to app.
+func (m *StreamMux) HandleApp(app string, h StreamHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.apps[app]; ok {
+		panic("rtmp: multiple registrations for app " + app)
+	}
+	m.apps[app] = h
+}
+
+// Handle registers the handler for publishes and plays whose stream path
+// matches pattern. It panics on a malformed or duplicate pattern.
+func (m *StreamMux) Handle(pattern string, h StreamHandler) {
+	p, err := parseStreamPattern(pattern)
+	if err != nil {
+		panic("rtmp: " + err.Error())
+	}
+	p.handler = h
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, q := range m.patterns {
+		if q.pattern == pattern {
+			panic("rtmp: multiple registrations for " + pattern)
+		}
+	}
+	m.patterns = append(m.patterns, p)
+	sort.SliceStable(m.patterns, func(i, j int) bool {
+		if m.patterns[i].literals != m.patterns[j].literals {
+			return m.patterns[i].literals > m.patterns[j].literals
+		}
+		return !m.patterns[i].rest && m.patterns[j].rest
+	})
+}
+
+// Route returns the handler for path and the values captured by its
+// pattern.
+func (m *StreamMux) Route(path string) (StreamHandler, StreamRoute, bool) {
+	segments := strings.Split(path, "/")
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, p := range m.patterns {
+		if values, ok := p.match(segments); ok {
+			return p.handler, StreamRoute{Pattern: p.pattern, Path: path, Values: values}, true
+		}
+	}
+	return nil, StreamRoute{}, false
+}
+
+// StreamRoute is the route of a publish or play, available to its handler
+// through StreamRouteFromContext.
+type StreamRoute struct {
+	Pattern string
+	Path    string
+	Values  map[string]string
+}
+
+// Value returns the value captured by {name}.
+func (r StreamRoute) Value(name string) string {
+	return r.Values[name]
+}
+
+// StreamPath returns the stream path of a stream name published or played
+// on app, dropping the query of the name.
+func StreamPath(app, name string) string {
+	return app + "/" + withoutQuery(name)
+}
+
+type streamRouteContextKey struct{}
+
+func StreamRouteFromContext(ctx context.Context) (StreamRoute, bool) {
+	route, ok := ctx.Value(streamRouteContextKey{}).(StreamRoute)
+	return route, ok
+}
+
+// WithStreamHandler validates connects, publishes and plays with h. When h
+// implements StreamDoneHandler it is told when streams stop, and when it
+// implements StreamMessageHandler it serves the audio, video and data
+// messages of the streams being published.
+func WithStreamHandler(h StreamHandler) ConnOption {
+	return func(o *connOptions) {
+		if dh, ok := h.(StreamDoneHandler); ok {
+			WithOnStreamDoneHandlers(func(ctx context.Context, stream MessageStream) {
+				if conn, ok := ConnFromContext(ctx); ok {
+					dh.ServeStreamDone(ctx, conn, stream)
+				}
+			})(o)
+		}
+		if mh, ok := h.(StreamMessageHandler); ok {
+			WithConnInitializers(func(c Conn) {
+				c.AddMessageHandler("StreamMessageHandler", streamMessageHandler(c, mh))
+			})(o)
+		}
+		WithOnConnectValidators(func(ctx context.Context, connect Connect) ConnectError {
+			conn, ok := ConnFromContext(ctx)
+			if !ok {
+				return nil
+			}
+			return h.ServeConnect(ctx, conn, connect)
+		})(o)
+		WithOnPublishValidators(func(ctx context.Context, publish Publish) map[string]interface{} {
+			conn, ok := ConnFromContext(ctx)
+			if !ok {
+				return nil
+			}
+			return h.ServePublish(ctx, conn, publish)
+		})(o)
+		WithOnPlayValidators(func(ctx context.Context, play Play) map[string]interface{} {
+			conn, ok := ConnFromContext(ctx)
+			if !ok {
+				return nil
+			}
+			return h.ServePlay(ctx, conn, play)
+		})(o)
+	}
+}
+
+// WithStreamMux validates connects, publishes and plays with the handlers
+// routed by mux.
+func WithStreamMux(mux *StreamMux) ConnOption {
+	return WithStreamHandler(mux)
+}
+
+// streamMessageHandler passes the audio, video and data messages of the
+// streams conn publishes to h.
+func streamMessageHandler(conn Conn, h StreamMessageHandler) MessageHandler {
+	return MessageHandlerFunc(func(ctx context.Context, m Message) ConnError {
+		switch m.TypeID() {
+		case MessageTypeIDAudio, MessageTypeIDVideo, MessageTypeIDDataAMF0, MessageTypeIDDataAMF3:
+		default:
+			return nil
+		}
+		stream, ok := conn.MessageStream(m.StreamID())
+		if !ok || stream.State != MessageStreamStatePublishing {
+			return nil
+		}
+		return h.ServeMessage(ctx, conn, stream, m)
+	})
+}
+
+func (m *StreamMux) ServeConnect(ctx context.Context, conn Conn, connect Connect) ConnectError {
+	app := conn.ConnectParams().App
+	m.mu.RLock()
+	h, ok := m.apps[app]
+	var streamHandlers []StreamHandler
+	if !ok {
+		segments := strings.Split(app, "/")
+		for _, p := range m.patterns {
+			if p.matchPrefix(segments) {
+				streamHandlers = append(streamHandlers, p.handler)
+			}
+		}
+	}
+	m.mu.RUnlock()
+	if ok {
+		return h.ServeConnect(ctx, conn, connect)
+	}
+	if len(streamHandlers) == 0 {
+		return NewConnectError(nil, NewStatus(StatusCodeNetConnectionConnectInvalidApp).
+			WithDescription(fmt.Sprintf("no handler for app %q", app)).
+			InfoObject(), EncodingAMFTypeAMF0)
+	}
+	for _, h := range streamHandlers {
+		if connectError := h.ServeConnect(ctx, conn, connect); connectError != nil {
+			return connectError
+		}
+	}
+	return nil
+}
+
+func (m *StreamMux) ServePublish(ctx context.Context, conn Conn, publish Publish) map[string]interface{} {
+	name := publish.PublishingName()
+	ctx, h, ok := m.serveStream(ctx, conn, name)
+	if !ok {
+		return NewStatus(StatusCodeNetStreamPublishBadName).WithDetails(name).InfoObject()
+	}
+	return h.ServePublish(ctx, conn, publish)
+}
+
+func (m *StreamMux) ServePlay(ctx context.Context, conn Conn, play Play) map[string]interface{} {
+	name := play.StreamName()
+	ctx, h, ok := m.serveStream(ctx, conn, name)
+	if !ok {
+		return NewStatus(StatusCodeNetStreamPlayStreamNotFound).WithDetails(name).InfoObject()
+	}
+	return h.ServePlay(ctx, conn, play)
+}
+
+func (m *StreamMux) ServeStreamDone(ctx context.Context, conn Conn, stream MessageStream) {
+	ctx, h, ok := m.serveStream(ctx, conn, stream.Name)
+	if !ok {
+		return
+	}
+	if h, ok := h.(StreamDoneHandler); ok {
+		h.ServeStreamDone(ctx, conn, stream)
+	}
+}
+
+func (m *StreamMux) ServeMessage(ctx context.Context, conn Conn, stream MessageStream, msg Message) ConnError {
+	ctx, h, ok := m.serveStream(ctx, conn, stream.Name)
+	if !ok {
+		return nil
+	}
+	if h, ok := h.(StreamMessageHandler); ok {
+		return h.ServeMessage(ctx, conn, stream, msg)
+	}
+	return nil
+}
+
+func (m *StreamMux) serveStream(ctx context.Context, conn Conn, name string) (context.Context, StreamHandler, bool) {
+	app := conn.ConnectParams().App
+	path := StreamPath(app, name)
+	if h, route, ok := m.Route(path); ok {
+		return context.WithValue(ctx, streamRouteContextKey{}, route), h, true
+	}
+	m.mu.RLock()
+	h, ok := m.apps[app]
+	m.mu.RUnlock()
+	if !ok {
+		return ctx, nil, false
+	}
+	return context.WithValue(ctx, streamRouteContextKey{}, StreamRoute{Path: path}), h, true
+}
+
+type streamPattern struct {
+	pattern  string
+	segments []streamPatternSegment
+	// rest is true when the pattern ends with "*".
+	rest     bool
+	literals int
+	handler  StreamHandler
+}
+
+// streamPatternSegment matches prefix + {name} + suffix, or prefix alone
+// when name is empty.
+type streamPatternSegment struct {
+	prefix string
+	name   string
+	suffix string
+}
+
+func parseStreamPattern(pattern string) (*streamPattern, error) {
+	if pattern == "" {
+		return nil, errors.New("empty stream pattern")
+	}
+	p := &streamPattern{pattern: pattern}
+	segments := strings.Split(pattern, "/")
+	for i, s := range segments {
+		if s == "*" {
+			if i != len(segments)-1 {
+				return nil, errors.Errorf("\"*\" is not the last segment of %q", pattern)
+			}
+			p.rest = true
+			break
+		}
+		if strings.Contains(s, "*") {
+			return nil, errors.Errorf("\"*\" is not a whole segment of %q", pattern)
+		}
+		seg := streamPatternSegment{prefix: s}
+		if open := strings.IndexByte(s, '{'); open >= 0 {
+			end := strings.IndexByte(s[open:], '}')
+			if end < 0 {
+				return nil, errors.Errorf("unclosed \"{\" in %q", pattern)
+			}
+			end += open
+			seg = streamPatternSegment{prefix: s[:open], name: s[open+1 : end], suffix: s[end+1:]}
+			if seg.name == "" || strings.ContainsAny(seg.suffix, "{}") {
+				return nil, errors.Errorf("bad wildcard in %q", pattern)
+			}
+		} else if strings.IndexByte(s, '}') >= 0 {
+			return nil, errors.Errorf("unopened \"}\" in %q", pattern)
+		}
+		p.literals += len(seg.prefix) + len(seg.suffix)
+		p.segments = append(p.segments, seg)
+	}
+	return p, nil
+}
+
+func (p *streamPattern) match(segments []string) (map[string]string, bool) {
+	if len(segments) < len(p.segments) ||
+		(!p.rest && len(segments) != len(p.segments)) ||
+		(p.rest && len(segments) == len(p.segments)) {
+		return nil, false
+	}
+	var values map[string]string
+	for i, seg := range p.segments {
+		v, ok := seg.match(segments[i])
+		if !ok {
+			return nil, false
+		}
+		if seg.name != "" {
+			if values == nil {
+				values = map[string]string{}
+			}
+			values[seg.name] = v
+		}
+	}
+	return values, true
+}
+
+// matchPrefix reports whether paths starting with segments may match p.
+func (p *streamPattern) matchPrefix(segments []string) bool {
+	if len(segments) >= len(p.segments) {
+		if !p.rest {
+			return false
+		}
+		segments = segments[:len(p.segments)]
+	}
+	for i, s := range segments {
+		if _, ok := p.segments[i].match(s); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (seg streamPatternSegment) match(s string) (string, bool) {
+	if seg.name == "" {
+		return "", s == seg.prefix
+	}
+	if len(s) <= len(seg.prefix)+len(seg.suffix) ||
+		!strings.HasPrefix(s, seg.prefix) ||
+		!strings.HasSuffix(s, seg.suffix) {
+		return "", false
+	}
+	return s[len(seg.prefix) : len(s)-len(seg.suffix)], true
+}
@@ -0,0 +1,173 @@
+package rtmp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamMuxRoute(t *testing.T) {
+	mux := NewStreamMux()
+	live := StreamHandlerFuncs{}
+	room := StreamHandlerFuncs{}
+	vod := StreamHandlerFuncs{}
+	mux.Handle("live/*", live)
+	mux.Handle("live/room", room)
+	mux.Handle("vod/{name}.flv", vod)
+
+	for _, tt := range []struct {
+		path    string
+		pattern string
+		values  map[string]string
+	}{
+		{"live/room", "live/room", nil},
+		{"live/other", "live/*", nil},
+		{"live/a/b", "live/*", nil},
+		{"vod/movie.flv", "vod/{name}.flv", map[string]string{"name": "movie"}},
+		{"vod/.flv", "", nil},
+		{"vod/movie.mp4", "", nil},
+		{"live", "", nil},
+	} {
+		t.Run(tt.path, func(t *testing.T) {
+			_, route, ok := mux.Route(tt.path)
+			assert.Equal(t, tt.pattern != "", ok)
+			assert.Equal(t, tt.pattern, route.Pattern)
+			assert.Equal(t, tt.values, route.Values)
+		})
+	}
+
+	assert.Panics(t, func() { mux.Handle("live/*", live) })
+	assert.Panics(t, func() { mux.Handle("live/*/x", live) })
+	assert.Panics(t, func() { mux.Handle("vod/{name", live) })
+}
+
+type streamMuxTestConn struct {
+	Conn
+	app     string
+	streams map[uint32]MessageStream
+}
+
+func (c *streamMuxTestConn) ConnectParams() ConnectParams {
+	return ConnectParams{App: c.app}
+}
+
+func (c *streamMuxTestConn) MessageStream(messageStreamID uint32) (MessageStream, bool) {
+	stream, ok := c.streams[messageStreamID]
+	return stream, ok
+}
+
+func TestStreamMuxServe(t *testing.T) {
+	mux := NewStreamMux()
+	var published []string
+	mux.HandleApp("relay", StreamHandlerFuncs{})
+	mux.Handle("vod/{name}.flv", StreamHandlerFuncs{
+		Play: func(ctx context.Context, conn Conn, play Play) map[string]interface{} {
+			route, _ := StreamRouteFromContext(ctx)
+			if route.Value("name") == "private" {
+				return NewStatus(StatusCodeNetStreamPlayFailed).InfoObject()
+			}
+			return nil
+		},
+	})
+	mux.Handle("live/*", StreamHandlerFuncs{
+		Publish: func(ctx context.Context, conn Conn, publish Publish) map[string]interface{} {
+			route, _ := StreamRouteFromContext(ctx)
+			published = append(published, route.Path)
+			return nil
+		},
+	})
+	ctx := context.Background()
+	conn := func(app string) Conn {
+		return &streamMuxTestConn{app: app}
+	}
+
+	assert.Nil(t, mux.ServeConnect(ctx, conn("live"), nil))
+	assert.Nil(t, mux.ServeConnect(ctx, conn("vod"), nil))
+	assert.Nil(t, mux.ServeConnect(ctx, conn("relay"), nil))
+	if connectError := mux.ServeConnect(ctx, conn("unknown"), nil); assert.NotNil(t, connectError) {
+		assert.Equal(t, "NetConnection.Connect.InvalidApp", connectError.Information()["code"])
+	}
+
+	assert.Nil(t, mux.ServePublish(ctx, conn("live"), NewPublish("room?token=x", PublishingTypeLive, EncodingAMFTypeAMF0)))
+	assert.Equal(t, []string{"live/room"}, published)
+	assert.Equal(t, "NetStream.Publish.BadName", mux.ServePublish(ctx, conn("vod"), NewPublish("room", PublishingTypeLive, EncodingAMFTypeAMF0))["code"])
+	assert.Nil(t, mux.ServePublish(ctx, conn("relay"), NewPublish("room", PublishingTypeLive, EncodingAMFTypeAMF0)))
+
+	assert.Nil(t, mux.ServePlay(ctx, conn("vod"), NewPlay("movie.flv", 0, 0, false, EncodingAMFTypeAMF0)))
+	assert.Equal(t, "NetStream.Play.Failed", mux.ServePlay(ctx, conn("vod"), NewPlay("private.flv", 0, 0, false, EncodingAMFTypeAMF0))["code"])
+	assert.Equal(t, "NetStream.Play.StreamNotFound", mux.ServePlay(ctx, conn("vod"), NewPlay("movie.mp4", 0, 0, false, EncodingAMFTypeAMF0))["code"])
+}
+
+func TestStreamMuxRedirect(t *testing.T) {
+	mux := NewStreamMux()
+	mux.Handle("live/*", StreamHandlerFuncs{
+		Publish: func(ctx context.Context, conn Conn, publish Publish) map[string]interface{} {
+			switch publish.PublishingName() {
+			case "moved":
+				RedirectStream(ctx, "locked")
+			case "loop":
+				RedirectStream(ctx, "loop2")
+			case "loop2":
+				RedirectStream(ctx, "loop3")
+			}
+			return nil
+		},
+	})
+	mux.Handle("live/locked", StreamHandlerFuncs{
+		Publish: func(ctx context.Context, conn Conn, publish Publish) map[string]interface{} {
+			return NewStatus(StatusCodeNetStreamPublishBadName).InfoObject()
+		},
+	})
+	validate := func(ctx context.Context, name string) map[string]interface{} {
+		return mux.ServePublish(ctx, &streamMuxTestConn{app: "live"}, NewPublish(name, PublishingTypeLive, EncodingAMFTypeAMF0))
+	}
+	ctx := context.Background()
+
+	name, errorInfo := validateStream(ctx, "room", StatusCodeNetStreamPublishBadName, validate)
+	assert.Equal(t, "room", name)
+	assert.Nil(t, errorInfo)
+
+	name, errorInfo = validateStream(ctx, "moved", StatusCodeNetStreamPublishBadName, validate)
+	assert.Equal(t, "locked", name)
+	assert.Equal(t, "NetStream.Publish.BadName", errorInfo["code"])
+
+	name, errorInfo = validateStream(ctx, "loop", StatusCodeNetStreamPublishBadName, validate)
+	assert.Equal(t, "loop2", name)
+	assert.Equal(t, "NetStream.Publish.BadName", errorInfo["code"])
+}
+
+func TestStreamMuxServeStream(t *testing.T) {
+	mux := NewStreamMux()
+	var done, messages []string
+	mux.HandleApp("live", StreamHandlerFuncs{})
+	mux.Handle("live/{name}", StreamHandlerFuncs{
+		Done: func(ctx context.Context, conn Conn, stream MessageStream) {
+			route, _ := StreamRouteFromContext(ctx)
+			done = append(done, route.Value("name"))
+		},
+		Message: func(ctx context.Context, conn Conn, stream MessageStream, m Message) ConnError {
+			route, _ := StreamRouteFromContext(ctx)
+			messages = append(messages, route.Value("name"))
+			return nil
+		},
+	})
+	conn := &streamMuxTestConn{app: "live", streams: map[uint32]MessageStream{
+		1: {ID: 1, State: MessageStreamStatePublishing, Name: "room?token=x"},
+		2: {ID: 2, State: MessageStreamStatePlaying, Name: "room"},
+		3: {ID: 3, State: MessageStreamStatePublishing, Name: "a/b"},
+	}}
+	ctx := context.Background()
+	h := streamMessageHandler(conn, mux)
+
+	assert.Nil(t, h.HandleMessage(ctx, NewMessage(6, MessageTypeIDAudio, 0, 1, nil)))
+	assert.Nil(t, h.HandleMessage(ctx, NewMessage(5, MessageTypeIDDataAMF0, 0, 1, nil)))
+	assert.Nil(t, h.HandleMessage(ctx, NewMessage(4, MessageTypeIDCommandAMF0, 0, 1, nil)))
+	assert.Nil(t, h.HandleMessage(ctx, NewMessage(6, MessageTypeIDAudio, 0, 2, nil)))
+	assert.Nil(t, h.HandleMessage(ctx, NewMessage(6, MessageTypeIDAudio, 0, 3, nil)))
+	assert.Equal(t, []string{"room", "room"}, messages)
+
+	mux.ServeStreamDone(ctx, conn, conn.streams[2])
+	mux.ServeStreamDone(ctx, conn, conn.streams[3])
+	assert.Equal(t, []string{"room"}, done)
+}
@@ -0,0 +1,20 @@
+package rtmp
+
+// RTMP timestamps are 32-bit milliseconds which wrap after ~49.7 days, so
+// they are compared with serial number arithmetic (RFC 1982): a timestamp is
+// "after" another when it is less than 2^31 ahead of it modulo 2^32.
+
+// TimestampDiff returns a - b, taking wraparound into account.
+func TimestampDiff(a, b uint32) int32 {
+	return int32(a - b)
+}
+
+// TimestampBefore reports whether a is earlier than b.
+func TimestampBefore(a, b uint32) bool {
+	return TimestampDiff(a, b) < 0
+}
+
+// TimestampAfter reports whether a is later than b.
+func TimestampAfter(a, b uint32) bool {
+	return TimestampDiff(a, b) > 0
+}
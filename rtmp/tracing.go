@@ -0,0 +1,211 @@
+package rtmp
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/hori-ryota/go-rtmp/rtmp/amf"
+	"github.com/pkg/errors"
+)
+
+// Span names of Tracer.
+const (
+	SpanNameHandshake    = "rtmp.handshake"
+	SpanNameConnect      = "rtmp.connect"
+	SpanNameCreateStream = "rtmp.createStream"
+	SpanNamePublish      = "rtmp.publish"
+	SpanNamePlay         = "rtmp.play"
+	SpanNameCall         = "rtmp.call"
+	// SpanNameFirstMedia lasts from publish or play until the first audio
+	// or video message of the stream is read or written.
+	SpanNameFirstMedia = "rtmp.firstMedia"
+)
+
+// Span attribute keys.
+const (
+	SpanAttributeRemoteAddr      = "net.peer.addr"
+	SpanAttributeIsServer        = "rtmp.is_server"
+	SpanAttributeApp             = "rtmp.app"
+	SpanAttributeTcURL           = "rtmp.tc_url"
+	SpanAttributeStream          = "rtmp.stream"
+	SpanAttributeMessageStreamID = "rtmp.message_stream_id"
+	SpanAttributeProcedure       = "rtmp.procedure"
+	SpanAttributeHandshakeResult = "rtmp.handshake.result"
+)
+
+// SpanAttribute values are strings, bools, ints, uint32s or float64s.
+type SpanAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer creates the spans of connections. A server traces the handshake
+// and the connect, createStream, publish, play and RPC commands it handles,
+// each until its handlers return. A Client traces the handshake, its
+// connect request until the response, and its publish until the first
+// media message.
+type Tracer interface {
+	// Start starts a span as a child of the span of ctx, if any. ctx
+	// derives from the context of the Conn, so ConnFromContext returns it.
+	// The returned context is passed to the handlers of the command.
+	Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span)
+}
+
+type Span interface {
+	SetAttributes(attrs ...SpanAttribute)
+	// End ends the span, failed if err is not nil.
+	End(err error)
+}
+
+// WithTracer traces the connection with tracer.
+func WithTracer(tracer Tracer) ConnOption {
+	return func(o *connOptions) {
+		o.tracer = tracer
+	}
+}
+
+// withoutQuery cuts the query off a tcUrl or stream name before it is
+// exported, as it often carries credentials such as ?token=.
+func withoutQuery(s string) string {
+	if i := strings.IndexByte(s, '?'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+var errNoMedia = errors.New("stream ended before the first media message")
+
+// firstMediaSpans are the SpanNameFirstMedia spans of a conn, by message
+// stream ID.
+type firstMediaSpans struct {
+	mu    sync.Mutex
+	spans map[uint32]Span
+}
+
+// startSpan starts a span with the attributes of conn. conn must be traced.
+func (conn *defaultConn) startSpan(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	attrs = append([]SpanAttribute{
+		{Key: SpanAttributeRemoteAddr, Value: conn.RemoteAddr().String()},
+		{Key: SpanAttributeIsServer, Value: conn.isServer},
+	}, attrs...)
+	if app := conn.ConnectParams().App; app != "" {
+		attrs = append(attrs, SpanAttribute{Key: SpanAttributeApp, Value: app})
+	}
+	return conn.tracer.Start(ctx, name, attrs...)
+}
+
+// traceCommand starts the span of a command message the conn handles, and
+// returns the context for its handlers and the func ending the span.
+func (conn *defaultConn) traceCommand(ctx context.Context, m Message) (context.Context, func(ConnError)) {
+	if conn.tracer == nil {
+		return ctx, nopEndCommand
+	}
+	b, err := AMF0Payload(m)
+	if err != nil {
+		return ctx, nopEndCommand
+	}
+	d := amf.NewDecoder(bytes.NewReader(b), amf.AMF0)
+	var name string
+	if err := d.Decode(&name); err != nil {
+		return ctx, nopEndCommand
+	}
+	var span Span
+	switch name {
+	case "connect":
+		ctx, span = conn.startSpan(ctx, SpanNameConnect)
+		return ctx, func(connErr ConnError) {
+			params := conn.ConnectParams()
+			span.SetAttributes(
+				SpanAttribute{Key: SpanAttributeApp, Value: params.App},
+				SpanAttribute{Key: SpanAttributeTcURL, Value: withoutQuery(params.TcURL)},
+			)
+			endSpan(span, connErr)
+		}
+	case "createStream":
+		ctx, span = conn.startSpan(ctx, SpanNameCreateStream)
+	case "publish", "play":
+		spanName, state := SpanNamePublish, MessageStreamStatePublishing
+		if name == "play" {
+			spanName, state = SpanNamePlay, MessageStreamStatePlaying
+		}
+		attrs := []SpanAttribute{{Key: SpanAttributeMessageStreamID, Value: m.StreamID()}}
+		// transaction ID, null command object, then the stream name
+		if _, err := d.DecodeValue(); err == nil {
+			if _, err := d.DecodeValue(); err == nil {
+				if streamName, err := d.DecodeValue(); err == nil {
+					if s, ok := streamName.(string); ok {
+						attrs = append(attrs, SpanAttribute{Key: SpanAttributeStream, Value: StreamPath(conn.ConnectParams().App, s)})
+					}
+				}
+			}
+		}
+		ctx, span = conn.startSpan(ctx, spanName, attrs...)
+		conn.startFirstMedia(ctx, m.StreamID(), attrs...)
+		return ctx, func(connErr ConnError) {
+			endSpan(span, connErr)
+			if stream, ok := conn.messageStreams.Get(m.StreamID()); !ok || stream.State != state {
+				conn.endFirstMedia(m.StreamID(), errNoMedia)
+			}
+		}
+	case "_result", "_error", "onStatus", "close", "play2", "deleteStream",
+		"closeStream", "receiveAudio", "receiveVideo", "seek", "pause":
+		return ctx, nopEndCommand
+	default:
+		ctx, span = conn.startSpan(ctx, SpanNameCall, SpanAttribute{Key: SpanAttributeProcedure, Value: name})
+	}
+	return ctx, func(connErr ConnError) {
+		endSpan(span, connErr)
+	}
+}
+
+func nopEndCommand(ConnError) {}
+
+func (conn *defaultConn) startFirstMedia(ctx context.Context, messageStreamID uint32, attrs ...SpanAttribute) {
+	if conn.tracer == nil {
+		return
+	}
+	_, span := conn.startSpan(ctx, SpanNameFirstMedia, attrs...)
+	conn.firstMedia.mu.Lock()
+	if conn.firstMedia.spans == nil {
+		conn.firstMedia.spans = map[uint32]Span{}
+	}
+	prev := conn.firstMedia.spans[messageStreamID]
+	conn.firstMedia.spans[messageStreamID] = span
+	conn.firstMedia.mu.Unlock()
+	if prev != nil {
+		prev.End(errNoMedia)
+	}
+}
+
+// endFirstMedia ends the SpanNameFirstMedia span of a stream, if it has not
+// ended yet.
+func (conn *defaultConn) endFirstMedia(messageStreamID uint32, err error) {
+	conn.firstMedia.mu.Lock()
+	span, ok := conn.firstMedia.spans[messageStreamID]
+	delete(conn.firstMedia.spans, messageStreamID)
+	conn.firstMedia.mu.Unlock()
+	if ok {
+		span.End(err)
+	}
+}
+
+// endFirstMediaAll ends the SpanNameFirstMedia spans of a closed conn.
+func (conn *defaultConn) endFirstMediaAll() {
+	conn.firstMedia.mu.Lock()
+	spans := conn.firstMedia.spans
+	conn.firstMedia.spans = nil
+	conn.firstMedia.mu.Unlock()
+	for _, span := range spans {
+		span.End(errNoMedia)
+	}
+}
+
+func endSpan(span Span, connErr ConnError) {
+	if connErr != nil {
+		span.End(connErr)
+		return
+	}
+	span.End(nil)
+}
@@ -0,0 +1,145 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]interface{}
+	conn  Conn
+	ended bool
+	err   error
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...SpanAttribute) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	conn, _ := ConnFromContext(ctx)
+	s := &recordedSpan{name: name, attrs: map[string]interface{}{}, conn: conn}
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+	t.spans = append(t.spans, s)
+	return ctx, &recordingSpan{tracer: t, span: s}
+}
+
+// ended returns the ended spans named name.
+func (t *recordingTracer) ended(name string) []recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var l []recordedSpan
+	for _, s := range t.spans {
+		if s.name == name && s.ended {
+			l = append(l, *s)
+		}
+	}
+	return l
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	span   *recordedSpan
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...SpanAttribute) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	for _, a := range attrs {
+		s.span.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.ended = true
+	s.span.err = err
+}
+
+func TestTracer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverTracer := &recordingTracer{}
+	s := NewServer(ctx, zap.NewNop(),
+		WithConnInitializers(func(c Conn) {
+			h := NewControlMessageHandler(c)
+			h.NetConnectionCommandHandler.CallHandlers = append(h.NetConnectionCommandHandler.CallHandlers,
+				CallHandlerFunc(func(ctx context.Context, call Call) ConnError {
+					return NewConnWarnError(assert.AnError)
+				}),
+			)
+			c.AddMessageHandler("ControlMessageHandler", h)
+		}),
+		WithTracer(serverTracer),
+	)
+	go s.Serve(l)
+
+	clientTracer := &recordingTracer{}
+	client := NewClient(ctx, zap.NewNop(), WithConnInitializers(GenerateCommonConnInitializer()), WithTracer(clientTracer))
+	defer client.Close()
+	conn, err := client.DialAndConnect(ctx, "rtmp://"+l.Addr().String()+"/live?token=secret", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	assert.NoError(t, conn.CreateStream(ctx, conn.TransactionID(), nil))
+	assert.NoError(t, conn.Publish(ctx, ChunkStreamIDFor(MessageTypeIDCommandAMF0, 1), 1, "room?token=secret", PublishingTypeLive))
+	assert.NoError(t, conn.Call(ctx, "ping", 0, nil, nil))
+	_, err = conn.Writer().WriteMessage(NewMessage(6, MessageTypeIDVideo, 0, 1, []byte{0x17, 0x01, 0, 0, 0}))
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Writer().Flush())
+
+	for len(serverTracer.ended(SpanNameFirstMedia)) == 0 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, name := range []string{SpanNameHandshake, SpanNameConnect, SpanNameCreateStream, SpanNamePublish, SpanNameCall, SpanNameFirstMedia} {
+		spans := serverTracer.ended(name)
+		if !assert.Len(t, spans, 1, name) {
+			continue
+		}
+		assert.NotNil(t, spans[0].conn, name)
+		assert.Equal(t, true, spans[0].attrs[SpanAttributeIsServer], name)
+	}
+	if spans := serverTracer.ended(SpanNameConnect); len(spans) == 1 {
+		assert.Equal(t, "live", spans[0].attrs[SpanAttributeApp])
+		assert.Equal(t, "rtmp://"+l.Addr().String()+"/live", spans[0].attrs[SpanAttributeTcURL])
+		assert.NoError(t, spans[0].err)
+	}
+	if spans := serverTracer.ended(SpanNamePublish); len(spans) == 1 {
+		assert.Equal(t, "live/room", spans[0].attrs[SpanAttributeStream])
+		assert.Equal(t, uint32(1), spans[0].attrs[SpanAttributeMessageStreamID])
+	}
+	if spans := serverTracer.ended(SpanNameCall); len(spans) == 1 {
+		assert.Equal(t, "ping", spans[0].attrs[SpanAttributeProcedure])
+		assert.Error(t, spans[0].err)
+	}
+	if spans := serverTracer.ended(SpanNameFirstMedia); len(spans) == 1 {
+		assert.NoError(t, spans[0].err)
+	}
+
+	assert.Len(t, clientTracer.ended(SpanNameHandshake), 1)
+	if spans := clientTracer.ended(SpanNameConnect); assert.Len(t, spans, 1) {
+		assert.Equal(t, "rtmp://"+l.Addr().String()+"/live", spans[0].attrs[SpanAttributeTcURL])
+		assert.Equal(t, false, spans[0].attrs[SpanAttributeIsServer])
+	}
+	assert.Len(t, clientTracer.ended(SpanNameFirstMedia), 1)
+}
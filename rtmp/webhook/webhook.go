@@ -0,0 +1,311 @@
+// Package webhook notifies HTTP endpoints of connects, publishes, plays and
+// their ends, like the on_connect, on_publish, on_play and on_done
+// directives of nginx-rtmp.
+//
+// Each notification is a POST of an Event as JSON. For connect, publish and
+// play a 2xx response allows the request. A 3xx response with a Location
+// header redirects a connect to the tcUrl in Location, and a publish or play
+// to the stream name in Location. Any other response, or no response after
+// the retries, rejects the request. Done notifications are sent in the
+// background and their responses are ignored.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hori-ryota/go-rtmp/rtmp"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+type Call string
+
+const (
+	CallConnect     Call = "connect"
+	CallPublish     Call = "publish"
+	CallPlay        Call = "play"
+	CallPublishDone Call = "publish_done"
+	CallPlayDone    Call = "play_done"
+)
+
+// Event is the body of a notification.
+type Event struct {
+	Call Call   `json:"call"`
+	Addr string `json:"addr"`
+	App  string `json:"app"`
+	// Name is the stream name without its query, empty for connect.
+	Name     string `json:"name,omitempty"`
+	Type     string `json:"type,omitempty"`
+	TcURL    string `json:"tcUrl,omitempty"`
+	FlashVer string `json:"flashVer,omitempty"`
+	SwfURL   string `json:"swfUrl,omitempty"`
+	PageURL  string `json:"pageUrl,omitempty"`
+	// Args are the query parameters of connect and of the stream name.
+	Args url.Values `json:"args,omitempty"`
+}
+
+// Hook sends the notifications. It is a rtmp.StreamHandler and
+// rtmp.StreamDoneHandler; pass it to rtmp.WithStreamHandler or register it
+// on a rtmp.StreamMux.
+type Hook struct {
+	onConnect string
+	onPublish string
+	onPlay    string
+	onDone    string
+
+	client        *http.Client
+	timeout       time.Duration
+	retries       int
+	retryInterval time.Duration
+}
+
+type Option func(*Hook)
+
+func WithOnConnect(endpoint string) Option {
+	return func(h *Hook) {
+		h.onConnect = endpoint
+	}
+}
+
+func WithOnPublish(endpoint string) Option {
+	return func(h *Hook) {
+		h.onPublish = endpoint
+	}
+}
+
+func WithOnPlay(endpoint string) Option {
+	return func(h *Hook) {
+		h.onPlay = endpoint
+	}
+}
+
+func WithOnDone(endpoint string) Option {
+	return func(h *Hook) {
+		h.onDone = endpoint
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient. Redirects are never
+// followed.
+func WithHTTPClient(client *http.Client) Option {
+	return func(h *Hook) {
+		h.client = client
+	}
+}
+
+// WithTimeout limits each attempt, 5 seconds by default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(h *Hook) {
+		h.timeout = timeout
+	}
+}
+
+// WithRetries retries a notification failing with a network error or a
+// 5xx response retries times, waiting interval between attempts.
+func WithRetries(retries int, interval time.Duration) Option {
+	return func(h *Hook) {
+		h.retries = retries
+		h.retryInterval = interval
+	}
+}
+
+func New(opts ...Option) *Hook {
+	h := &Hook{
+		client:  http.DefaultClient,
+		timeout: 5 * time.Second,
+	}
+	for _, o := range opts {
+		o(h)
+	}
+	client := *h.client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	h.client = &client
+	return h
+}
+
+func (h *Hook) ServeConnect(ctx context.Context, conn rtmp.Conn, connect rtmp.Connect) rtmp.ConnectError {
+	if h.onConnect == "" {
+		return nil
+	}
+	ev := newEvent(CallConnect, conn, "")
+	res, err := h.post(ctx, h.onConnect, ev)
+	if err == nil && res.StatusCode/100 == 2 {
+		return nil
+	}
+	if err == nil && res.StatusCode/100 == 3 {
+		if location := res.Header.Get("Location"); location != "" {
+			return rtmp.RedirectConnect(location, "redirected")
+		}
+	}
+	h.log(conn, ev, res, err)
+	code := 0
+	if res != nil {
+		code = res.StatusCode
+	}
+	return rtmp.RejectConnect(code, "rejected")
+}
+
+func (h *Hook) ServePublish(ctx context.Context, conn rtmp.Conn, publish rtmp.Publish) map[string]interface{} {
+	if h.onPublish == "" {
+		return nil
+	}
+	ev := newEvent(CallPublish, conn, publish.PublishingName())
+	ev.Type = string(publish.PublishingType())
+	if !h.decide(ctx, h.onPublish, conn, ev) {
+		return rtmp.NewStatus(rtmp.StatusCodeNetStreamPublishBadName).
+			WithDescription("rejected").
+			WithDetails(publish.PublishingName()).
+			InfoObject()
+	}
+	return nil
+}
+
+func (h *Hook) ServePlay(ctx context.Context, conn rtmp.Conn, play rtmp.Play) map[string]interface{} {
+	if h.onPlay == "" {
+		return nil
+	}
+	ev := newEvent(CallPlay, conn, play.StreamName())
+	if !h.decide(ctx, h.onPlay, conn, ev) {
+		return rtmp.NewStatus(rtmp.StatusCodeNetStreamPlayFailed).
+			WithDescription("rejected").
+			WithDetails(play.StreamName()).
+			InfoObject()
+	}
+	return nil
+}
+
+// ServeStreamDone sends the done notification of stream in the background.
+func (h *Hook) ServeStreamDone(ctx context.Context, conn rtmp.Conn, stream rtmp.MessageStream) {
+	if h.onDone == "" {
+		return
+	}
+	call := CallPlayDone
+	if stream.State == rtmp.MessageStreamStatePublishing {
+		call = CallPublishDone
+	}
+	ev := newEvent(call, conn, stream.Name)
+	ev.Type = string(stream.PublishingType)
+	go func() {
+		// the connection may be closing, so ctx is not used
+		if res, err := h.post(context.Background(), h.onDone, ev); err != nil || res.StatusCode/100 != 2 {
+			h.log(conn, ev, res, err)
+		}
+	}()
+}
+
+// decide posts ev and follows a redirect with rtmp.RedirectStream.
+func (h *Hook) decide(ctx context.Context, endpoint string, conn rtmp.Conn, ev Event) bool {
+	res, err := h.post(ctx, endpoint, ev)
+	if err != nil {
+		h.log(conn, ev, nil, err)
+		return false
+	}
+	switch res.StatusCode / 100 {
+	case 2:
+		return true
+	case 3:
+		if location := res.Header.Get("Location"); location != "" && rtmp.RedirectStream(ctx, location) {
+			conn.Logger().Info(
+				"webhook redirected stream",
+				zap.String("call", string(ev.Call)),
+				zap.String("name", ev.Name),
+				zap.String("location", location),
+			)
+			return true
+		}
+	}
+	h.log(conn, ev, res, nil)
+	return false
+}
+
+// post sends ev, retrying on network errors and 5xx responses. The body of
+// the response is discarded.
+func (h *Hook) post(ctx context.Context, endpoint string, ev Event) (*http.Response, error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal event")
+	}
+	for attempt := 0; ; attempt++ {
+		res, err := h.postOnce(ctx, endpoint, body)
+		if (err == nil && res.StatusCode < 500) || attempt >= h.retries {
+			return res, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(h.retryInterval):
+		}
+	}
+}
+
+func (h *Hook) postOnce(ctx context.Context, endpoint string, body []byte) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to post")
+	}
+	res.Body.Close()
+	return res, nil
+}
+
+func (h *Hook) log(conn rtmp.Conn, ev Event, res *http.Response, err error) {
+	fields := []zap.Field{
+		zap.String("call", string(ev.Call)),
+		zap.String("app", ev.App),
+		zap.String("name", ev.Name),
+	}
+	if res != nil {
+		fields = append(fields, zap.Int("status", res.StatusCode))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	conn.Logger().Info("webhook failed", fields...)
+}
+
+func newEvent(call Call, conn rtmp.Conn, name string) Event {
+	params := conn.ConnectParams()
+	ev := Event{
+		Call:     call,
+		App:      params.App,
+		TcURL:    params.TcURL,
+		FlashVer: params.FlashVer,
+		SwfURL:   params.SwfURL,
+		PageURL:  params.PageURL,
+		Args:     url.Values{},
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		ev.Addr = addr.String()
+		if host, _, err := net.SplitHostPort(ev.Addr); err == nil {
+			ev.Addr = host
+		}
+	}
+	for k, v := range params.Query {
+		ev.Args[k] = append(ev.Args[k], v...)
+	}
+	ev.Name = name
+	if i := strings.IndexByte(name, '?'); i >= 0 {
+		ev.Name = name[:i]
+		if q, err := url.ParseQuery(name[i+1:]); err == nil {
+			for k, v := range q {
+				ev.Args[k] = append(ev.Args[k], v...)
+			}
+		}
+	}
+	return ev
+}
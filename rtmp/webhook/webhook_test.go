@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hori-ryota/go-rtmp/rtmp"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newTestConn returns a server conn with one message stream whose output is
+// discarded.
+func newTestConn(t *testing.T, opts ...rtmp.ConnOption) rtmp.Conn {
+	s, c := net.Pipe()
+	go io.Copy(io.Discard, c)
+	conn := rtmp.NewDefaultConn(context.Background(), s, true, zap.NewNop(), opts...)
+	t.Cleanup(func() {
+		conn.Close()
+		c.Close()
+	})
+	h := conn.DefaultNetConnectionCommandHandler()
+	assert.Nil(t, h.OnCreateStream(conn.Context(), rtmp.NewCreateStream(2, nil, rtmp.EncodingAMFTypeAMF0)))
+	return conn
+}
+
+func publish(conn rtmp.Conn, name string) rtmp.ConnError {
+	h := conn.DefaultNetStreamCommandHandler()
+	return h.OnPublish(conn.Context(), 4, 1, rtmp.NewPublish(name, rtmp.PublishingTypeLive, rtmp.EncodingAMFTypeAMF0))
+}
+
+func TestHook(t *testing.T) {
+	events := make(chan Event, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		if err := json.NewDecoder(r.Body).Decode(&ev); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- ev
+		switch ev.Name {
+		case "redirect":
+			w.Header().Set("Location", "redirected")
+			w.WriteHeader(http.StatusFound)
+		case "denied":
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	hook := New(
+		WithOnPublish(srv.URL),
+		WithOnDone(srv.URL),
+	)
+	conn := newTestConn(t, rtmp.WithStreamHandler(hook))
+
+	assert.Nil(t, publish(conn, "room?key=1"))
+	ev := <-events
+	assert.Equal(t, CallPublish, ev.Call)
+	assert.Equal(t, "room", ev.Name)
+	assert.Equal(t, "live", ev.Type)
+	assert.Equal(t, url.Values{"key": {"1"}}, ev.Args)
+
+	assert.Nil(t, publish(conn, "redirect"))
+	<-events
+	ev = <-events
+	assert.Equal(t, CallPublish, ev.Call)
+	assert.Equal(t, "redirected", ev.Name)
+	ev = <-events
+	assert.Equal(t, CallPublishDone, ev.Call)
+	assert.Equal(t, "room", ev.Name)
+	stream, _ := conn.MessageStream(1)
+	assert.Equal(t, "redirected", stream.Name)
+
+	err := publish(conn, "denied")
+	assert.True(t, rtmp.IsConnRejectedError(err))
+	<-events
+}
+
+func TestHookRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	conn := newTestConn(t)
+	hook := New(WithOnPublish(srv.URL), WithRetries(2, time.Millisecond))
+	assert.Nil(t, hook.ServePublish(conn.Context(), conn, rtmp.NewPublish("room", rtmp.PublishingTypeLive, rtmp.EncodingAMFTypeAMF0)))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	hook = New(WithOnPublish(srv.URL), WithRetries(1, time.Millisecond))
+	assert.NotNil(t, hook.ServePublish(conn.Context(), conn, rtmp.NewPublish("room", rtmp.PublishingTypeLive, rtmp.EncodingAMFTypeAMF0)))
+}
+
+func TestHookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	conn := newTestConn(t)
+	hook := New(WithOnConnect(srv.URL), WithTimeout(10*time.Millisecond))
+	if connectError := hook.ServeConnect(conn.Context(), conn, nil); assert.NotNil(t, connectError) {
+		assert.Equal(t, "NetConnection.Connect.Rejected", connectError.Information()["code"])
+	}
+}
@@ -3,6 +3,7 @@ package rtmp
 import (
 	"bufio"
 	"io"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -17,30 +18,47 @@ type Writer interface {
 type writer Writer
 
 type defaultWriter struct {
+	mu           sync.Mutex
 	conn         Conn
 	w            *bufio.Writer
 	chunkSize    uint32
 	chunkStreams map[ /* chunkStreamID */ uint32]chunkStream
+	metrics      Metrics
+	// traced is the conn whose first media spans the writer ends.
+	traced *defaultConn
 }
 
 func NewDefaultWriter(conn Conn, w io.Writer) Writer {
+	var traced *defaultConn
+	if c, ok := conn.(*defaultConn); ok && c.tracer != nil {
+		traced = c
+	}
 	return &defaultWriter{
 		conn:         conn,
 		w:            bufio.NewWriter(w),
 		chunkSize:    128, /* default RTMP Chunk size */
 		chunkStreams: map[uint32]chunkStream{},
+		metrics:      connMetrics(conn),
+		traced:       traced,
 	}
 }
 
 func (w *defaultWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return w.w.Write(p)
 }
 
 func (w *defaultWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	return w.w.Flush()
 }
 
+// WriteMessage is safe to call concurrently, e.g. from the keepalive.
 func (w *defaultWriter) WriteMessage(m Message) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
 	csID := m.ChunkStreamID()
 	cs := w.chunkStreams[csID]
@@ -55,7 +73,7 @@ func (w *defaultWriter) WriteMessage(m Message) (n int, err error) {
 	messageLength := uint32(len(p))
 	timestampDelta := m.Timestamp() - cs.timestamp
 	switch {
-	case !isNotFirst || cs.messageStreamID != m.StreamID() || m.Timestamp() < cs.timestamp: // type 0
+	case !isNotFirst || cs.messageStreamID != m.StreamID() || TimestampBefore(m.Timestamp(), cs.timestamp): // type 0
 		cs.messageLength = messageLength
 		cs.messageTypeID = m.TypeID()
 		cs.messageStreamID = m.StreamID()
@@ -103,9 +121,13 @@ func (w *defaultWriter) WriteMessage(m Message) (n int, err error) {
 		)
 	default: //type 3
 		cs.timestamp += timestampDelta
+		// a type 3 chunk repeats the extended timestamp of the header it
+		// inherits its delta from
+		extendedTimestamp = cs.extendedTimestamp
 		format = 3
 		mh = NewChunkMessageHeaderType3()
 	}
+	cs.extendedTimestamp = extendedTimestamp
 
 	bh := GenerateChunkBasicHeader(format, csID)
 	h := NewChunkHeader(bh, mh, extendedTimestamp)
@@ -115,11 +137,12 @@ func (w *defaultWriter) WriteMessage(m Message) (n int, err error) {
 		if err != nil {
 			return 0, errors.Wrap(err, "failed to marshal chunk")
 		}
-		n, err = w.Write(b)
+		n, err = w.w.Write(b)
 		if err != nil {
 			return 0, errors.Wrap(err, "failed to writer chunk")
 		}
 		w.chunkStreams[csID] = cs
+		w.written(m)
 		return n, nil
 	}
 
@@ -127,7 +150,7 @@ func (w *defaultWriter) WriteMessage(m Message) (n int, err error) {
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to marshal chunk")
 	}
-	nn, err := w.Write(b)
+	nn, err := w.w.Write(b)
 	if err != nil {
 		return 0, errors.Wrap(err, "failed to write chunk")
 	}
@@ -136,7 +159,7 @@ func (w *defaultWriter) WriteMessage(m Message) (n int, err error) {
 	h = NewChunkHeader(
 		GenerateChunkBasicHeader(3, csID),
 		NewChunkMessageHeaderType3(),
-		0,
+		extendedTimestamp,
 	)
 	remain := p[w.chunkSize:]
 
@@ -149,7 +172,7 @@ func (w *defaultWriter) WriteMessage(m Message) (n int, err error) {
 		if err != nil {
 			return 0, errors.Wrap(err, "failed to marshal chunk")
 		}
-		nn, err := w.Write(b)
+		nn, err := w.w.Write(b)
 		if err != nil {
 			return 0, errors.Wrap(err, "failed to write chunk")
 		}
@@ -158,10 +181,20 @@ func (w *defaultWriter) WriteMessage(m Message) (n int, err error) {
 		remain = remain[l:]
 	}
 	w.chunkStreams[csID] = cs
+	w.written(m)
 
 	return n, nil
 }
 
+func (w *defaultWriter) written(m Message) {
+	w.metrics.MessageWritten(m.TypeID())
+	if w.traced != nil && isMediaMessage(m.TypeID()) {
+		w.traced.endFirstMedia(m.StreamID(), nil)
+	}
+}
+
 func (w *defaultWriter) SetChunkSize(chunkSize uint32) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	w.chunkSize = chunkSize
 }
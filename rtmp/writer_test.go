@@ -0,0 +1,133 @@
+package rtmp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDefaultWriter_WriteMessage_Timestamps(t *testing.T) {
+	payload := func(n int, v byte) []byte {
+		return bytes.Repeat([]byte{v}, n)
+	}
+
+	testCases := []struct {
+		name     string
+		messages []Message
+	}{
+		{
+			name: "extended timestamp over multiple chunks",
+			messages: []Message{
+				NewMessage(4, MessageTypeIDVideo, 0x1000000, 1, payload(300, 0x1)),
+				NewMessage(4, MessageTypeIDVideo, 0x2000000, 1, payload(300, 0x2)),
+				NewMessage(4, MessageTypeIDVideo, 0x3000000, 1, payload(300, 0x3)),
+				NewMessage(4, MessageTypeIDVideo, 0x3000010, 1, payload(300, 0x4)),
+			},
+		},
+		{
+			name: "wraparound",
+			messages: []Message{
+				NewMessage(4, MessageTypeIDAudio, 0xffffffe0, 1, payload(10, 0x1)),
+				NewMessage(4, MessageTypeIDAudio, 0xfffffff0, 1, payload(10, 0x2)),
+				NewMessage(4, MessageTypeIDAudio, 0x00000000, 1, payload(10, 0x3)),
+				NewMessage(4, MessageTypeIDAudio, 0x00000010, 1, payload(200, 0x4)),
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			b := new(bytes.Buffer)
+			w := NewDefaultWriter(nil, b)
+			for _, m := range tt.messages {
+				_, err := w.WriteMessage(m)
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, w.Flush())
+
+			// each message after the first reuses the chunk stream header
+			assert.True(t, b.Len() < len(tt.messages)*(12+4+300+3*5))
+
+			r := NewDefaultReader(nil, b, defaultWindowAcknowledgementSize, zap.NewNop())
+			for _, want := range tt.messages {
+				got, err := r.ReadMessage()
+				if !assert.NoError(t, err) {
+					return
+				}
+				assert.Equal(t, want.Timestamp(), got.Timestamp())
+				assert.Equal(t, want.Payload(), got.Payload())
+				got.Release()
+			}
+		})
+	}
+}
+
+func TestDefaultReader_ReadMessage_Type3WithoutExtendedTimestamp(t *testing.T) {
+	h, err := NewChunkHeader(
+		GenerateChunkBasicHeader(0, 4),
+		NewChunkMessageHeaderType0(0xffffff, 200, MessageTypeIDVideo, 1),
+		0x1000000,
+	).MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	b := append(h, payload200[:128]...)
+	b = append(b, 0xc4) // fmt 3, chunk stream 4, extended timestamp omitted
+	b = append(b, payload200[128:]...)
+
+	r := NewDefaultReader(nil, bytes.NewReader(b), defaultWindowAcknowledgementSize, zap.NewNop())
+	m, err := r.ReadMessage()
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(0x1000000), m.Timestamp())
+		assert.Equal(t, payload200, m.Payload())
+	}
+}
+
+func TestDefaultReader_ReadMessage_Type3ExtendedTimestampPerChunkStream(t *testing.T) {
+	h, err := NewChunkHeader(
+		GenerateChunkBasicHeader(0, 4),
+		NewChunkMessageHeaderType0(0xffffff, 300, MessageTypeIDVideo, 1),
+		0x1000000,
+	).MarshalBinary()
+	if !assert.NoError(t, err) {
+		return
+	}
+	// the third chunk starts with bytes equal to the extended timestamp,
+	// which the peer omits on type 3 chunks
+	payload := append(append(bytes.Repeat([]byte{0xab}, 256), 0x01, 0x00, 0x00, 0x00), bytes.Repeat([]byte{0xcd}, 40)...)
+	message := func() []byte {
+		b := append([]byte{}, h...)
+		b = append(b, payload[:128]...)
+		b = append(b, 0xc4) // fmt 3, chunk stream 4, extended timestamp omitted
+		b = append(b, payload[128:256]...)
+		b = append(b, 0xc4)
+		return append(b, payload[256:]...)
+	}
+
+	r := NewDefaultReader(nil, bytes.NewReader(message()), defaultWindowAcknowledgementSize, zap.NewNop())
+	m, err := r.ReadMessage()
+	if assert.NoError(t, err) {
+		assert.Equal(t, payload, m.Payload())
+	}
+
+	// a payload repeating the timestamp in its first continuation chunk
+	// needs the reader option
+	payload = append(append(bytes.Repeat([]byte{0xab}, 128), 0x01, 0x00, 0x00, 0x00), bytes.Repeat([]byte{0xcd}, 168)...)
+	r = NewDefaultReader(nil, bytes.NewReader(message()), defaultWindowAcknowledgementSize, zap.NewNop(), WithType3ExtendedTimestamp(false))
+	m, err = r.ReadMessage()
+	if assert.NoError(t, err) {
+		assert.Equal(t, payload, m.Payload())
+	}
+}
+
+var payload200 = bytes.Repeat([]byte{0xab}, 200)
+
+func TestTimestampDiff(t *testing.T) {
+	assert.Equal(t, int32(0x20), TimestampDiff(0x10, 0xfffffff0))
+	assert.Equal(t, int32(-0x20), TimestampDiff(0xfffffff0, 0x10))
+	assert.True(t, TimestampBefore(0xfffffff0, 0x10))
+	assert.True(t, TimestampAfter(0x10, 0xfffffff0))
+	assert.False(t, TimestampAfter(0x10, 0x10))
+}